@@ -6,6 +6,8 @@ import (
 	"github.com/Desk888/api/internal/controllers"
 	"github.com/Desk888/api/internal/initializers"
 	"github.com/Desk888/api/internal/middleware"
+	"github.com/Desk888/api/internal/services"
+	"github.com/Desk888/api/internal/workers"
 	"github.com/gin-gonic/gin"
 )
 
@@ -22,6 +24,14 @@ func init() {
 	initializers.InitRedis()      // Initialize the Redis connection
 	initializers.InitGoogleAuth() // Initialize the Google Auth
 	initializers.InitS3() 		// Initialize the S3 connection
+	services.InitPasswordPolicy() // Load the password policy
+	services.InitPasswordHasher() // Initialize the password hasher
+	services.InitMailer()         // Initialize the email sender
+	services.InitGeoIP()          // Load the offline GeoIP database
+	services.InitPostcodes()      // Load the postcode district centroids
+	services.InitPayments()       // Initialize the payment provider
+	services.InitShipping()       // Initialize the shipping rate calculator
+	services.InitSMS()            // Initialize the SMS gateway
 }
 
 func main() {
@@ -31,9 +41,33 @@ func main() {
 
 	r := gin.Default() // Initiliase Gin Router
 
+	// Background workers
+	workers.StartAccountPurger()
+	workers.StartDataExporter()
+	workers.StartOfferExpirer()
+	workers.StartSavedSearchMatcher()
+	workers.StartAdExpirer()
+	workers.StartAdStatsFlusher()
+	workers.StartPromotionScheduler()
+	workers.StartOrderPayouts()
+	workers.StartAdGeocoder()
+
 	// Route Groups
 	authGroup := r.Group("/auth")
 	profileGroup := r.Group("/profile")
+	sellerGroup := r.Group("/sellers")
+	adsGroup := r.Group("/ads")
+	conversationGroup := r.Group("/conversations", middleware.RequireAuth)
+	offerGroup := r.Group("/offers", middleware.RequireAuth)
+	reviewGroup := r.Group("/reviews", middleware.RequireAuth)
+	reportGroup := r.Group("/reports", middleware.RequireAuth)
+	moderationGroup := r.Group("/moderation", middleware.RequireAuth, middleware.RequireModerator)
+	favoriteGroup := r.Group("/favorites", middleware.RequireAuth)
+	savedSearchGroup := r.Group("/saved-searches", middleware.RequireAuth)
+	promotionGroup := r.Group("/promotions", middleware.RequireAuth)
+	orderGroup := r.Group("/orders", middleware.RequireAuth)
+	paymentGroup := r.Group("/payments")
+	realtimeGroup := r.Group("/realtime", middleware.RequireSession)
 
 	// //////////////////////////
 
@@ -43,9 +77,16 @@ func main() {
 	authGroup.POST("/signout", controllers.Signout)
 	authGroup.GET("/validate", middleware.RequireAuth, controllers.Validate)
 	authGroup.GET("/list_sessions", middleware.RequireAuth, controllers.ListSessions)
+	authGroup.GET("/login_history", middleware.RequireAuth, controllers.ListLoginHistory)
 	authGroup.POST("/initiate-reset", controllers.InitiatePasswordReset)
 	authGroup.POST("/validate-reset-token", controllers.ValidateResetToken)
 	authGroup.POST("/update-password", controllers.UpdatePassword)
+	authGroup.POST("/restore-account", controllers.RestoreAccount)
+
+	// Passwordless Authentication
+	authGroup.POST("/magic-link", controllers.RequestMagicLink)
+	authGroup.GET("/magic-link/consume", controllers.ShowMagicLink)
+	authGroup.POST("/magic-link/consume", controllers.ConsumeMagicLink)
 
 	// Google Authentication
 	authGroup.GET("/:provider", controllers.SignInWithProvider)
@@ -56,8 +97,126 @@ func main() {
 
 	// Profile routes
 	profileGroup.GET("/:userID", middleware.RequireAuth, controllers.ViewProfile)
-	profileGroup.PUT("/:userID", controllers.EditProfile)
+	profileGroup.GET("/settings/privacy", middleware.RequireAuth, controllers.GetPrivacySettings)
+	profileGroup.PATCH("/settings/privacy", middleware.RequireAuth, controllers.UpdatePrivacySettings)
+	profileGroup.PATCH("/:userID", middleware.RequireAuth, controllers.PatchProfile)
 	profileGroup.DELETE("/:userID", middleware.RequireAuth, controllers.DeleteProfile)
 
+	// Avatar routes
+	profileGroup.PUT("/avatar", middleware.RequireAuth, controllers.UploadAvatar)
+	profileGroup.DELETE("/avatar", middleware.RequireAuth, controllers.DeleteAvatar)
+
+	// Data export routes
+	profileGroup.POST("/export", middleware.RequireAuth, controllers.RequestDataExport)
+	profileGroup.GET("/export/:exportID", middleware.RequireAuth, controllers.GetDataExport)
+
+	// Block list routes
+	profileGroup.GET("/blocks", middleware.RequireAuth, controllers.ListBlockedUsers)
+	profileGroup.POST("/blocks/:userID", middleware.RequireAuth, controllers.BlockUser)
+	profileGroup.DELETE("/blocks/:userID", middleware.RequireAuth, controllers.UnblockUser)
+
+	// Seller analytics routes
+	profileGroup.GET("/ad-stats", middleware.RequireAuth, controllers.GetSellerStats)
+
+	// Phone verification routes
+	profileGroup.POST("/phone/send-code", middleware.RequireAuth, controllers.SendPhoneVerificationCode)
+	profileGroup.POST("/phone/verify", middleware.RequireAuth, controllers.VerifyPhoneNumber)
+
+	// //////////////////////////
+
+	// Public seller routes
+	sellerGroup.GET("/:userID", middleware.OptionalAuth, controllers.ViewSellerProfile)
+	sellerGroup.GET("/:userID/reviews", controllers.ListUserReviews)
+
+	// Ad routes
+	adsGroup.GET("", middleware.OptionalAuth, controllers.SearchAds)
+	adsGroup.GET("/featured", middleware.OptionalAuth, controllers.FeaturedAds)
+	adsGroup.POST("", middleware.RequireAuth, controllers.CreateAd)
+	adsGroup.GET("/:adID", middleware.OptionalAuth, controllers.ViewAd)
+	adsGroup.PATCH("/:adID", middleware.RequireAuth, controllers.UpdateAd)
+	adsGroup.POST("/:adID/relist", middleware.RequireAuth, controllers.RelistAd)
+	adsGroup.GET("/:adID/delivery", controllers.QuoteAdDelivery)
+	adsGroup.GET("/:adID/stats", middleware.RequireAuth, controllers.GetAdStats)
+	adsGroup.POST("/:adID/promotions", middleware.RequireAuth, controllers.PromoteAd)
+	adsGroup.POST("/:adID/favorite", middleware.RequireAuth, controllers.AddFavorite)
+	adsGroup.DELETE("/:adID/favorite", middleware.RequireAuth, controllers.RemoveFavorite)
+	adsGroup.POST("/:adID/reveal-contact", middleware.RequireAuth, controllers.RevealAdContact)
+	adsGroup.POST("/:adID/conversations", middleware.RequireAuth, controllers.StartConversation)
+	adsGroup.POST("/:adID/offers", middleware.RequireAuth, controllers.MakeOffer)
+	adsGroup.POST("/:adID/release", middleware.RequireAuth, controllers.ReleaseAdReservation)
+	adsGroup.POST("/:adID/orders", middleware.RequireAuth, controllers.BuyAd)
+
+	// Offer routes
+	offerGroup.GET("", controllers.ListOffers)
+	offerGroup.GET("/:offerID", controllers.GetOffer)
+	offerGroup.POST("/:offerID/accept", controllers.AcceptOffer)
+	offerGroup.POST("/:offerID/reject", controllers.RejectOffer)
+	offerGroup.POST("/:offerID/counter", controllers.CounterOffer)
+	offerGroup.POST("/:offerID/withdraw", controllers.WithdrawOffer)
+	offerGroup.POST("/:offerID/complete", controllers.CompleteOffer)
+	offerGroup.POST("/:offerID/checkout", controllers.CheckoutOffer)
+	offerGroup.POST("/:offerID/review", controllers.CreateReview)
+
+	// Review routes
+	reviewGroup.POST("/:reviewID/reply", controllers.ReplyToReview)
+	reviewGroup.POST("/:reviewID/report", controllers.ReportReview)
+
+	// Messaging routes
+	conversationGroup.GET("", controllers.ListConversations)
+	conversationGroup.GET("/:conversationID/messages", controllers.ListMessages)
+	conversationGroup.POST("/:conversationID/messages", controllers.SendMessage)
+	conversationGroup.POST("/:conversationID/read", controllers.MarkConversationRead)
+	conversationGroup.POST("/:conversationID/typing", controllers.SendTyping)
+
+	// Favorite routes
+	favoriteGroup.GET("", controllers.ListFavorites)
+	favoriteGroup.PATCH("/:adID", controllers.UpdateFavoriteAlerts)
+
+	// Saved search routes
+	savedSearchGroup.GET("", controllers.ListSavedSearches)
+	savedSearchGroup.POST("", controllers.CreateSavedSearch)
+	savedSearchGroup.POST("/:searchID/pause", controllers.PauseSavedSearch)
+	savedSearchGroup.POST("/:searchID/resume", controllers.ResumeSavedSearch)
+	savedSearchGroup.DELETE("/:searchID", controllers.DeleteSavedSearch)
+
+	// Promotion routes
+	promotionGroup.GET("", controllers.ListPromotions)
+	promotionGroup.POST("/:promotionID/cancel", controllers.CancelPromotion)
+
+	// Order routes
+	orderGroup.GET("", controllers.ListOrders)
+	orderGroup.GET("/:orderID", controllers.GetOrder)
+	orderGroup.POST("/:orderID/ship", controllers.ShipOrder)
+	orderGroup.POST("/:orderID/confirm-receipt", controllers.ConfirmOrderReceipt)
+	orderGroup.POST("/:orderID/refund", controllers.RefundOrder)
+	orderGroup.POST("/:orderID/dispute", controllers.DisputeOrder)
+	orderGroup.POST("/:orderID/review", controllers.CreateOrderReview)
+
+	// Payment routes
+	paymentGroup.POST("/webhook", controllers.PaymentWebhook)
+	if services.PaymentSimulation {
+		paymentGroup.POST("/fake/:reference/:event", middleware.RequireAuth, controllers.SimulatePayment)
+	}
+
+	// Reporting routes
+	reportGroup.POST("", controllers.CreateReport)
+
+	// Moderation routes
+	moderationGroup.GET("/cases", controllers.ListModerationCases)
+	moderationGroup.GET("/cases/:caseID", controllers.GetModerationCase)
+	moderationGroup.POST("/cases/:caseID/claim", controllers.ClaimModerationCase)
+	moderationGroup.POST("/cases/:caseID/resolve", controllers.ResolveModerationCase)
+	moderationGroup.POST("/cases/:caseID/dismiss", controllers.DismissModerationCase)
+	moderationGroup.POST("/cases/:caseID/hide", controllers.HideModerationCaseContent)
+	moderationGroup.POST("/cases/:caseID/suspend", controllers.SuspendModerationCaseUser)
+	moderationGroup.POST("/users/:userID/unsuspend", controllers.UnsuspendUser)
+	moderationGroup.GET("/disputes", controllers.ListDisputedOrders)
+	moderationGroup.POST("/disputes/:orderID/resolve", controllers.ResolveOrderDispute)
+
+	// Real-time routes
+	r.POST("/realtime/ticket", middleware.RequireAuth, controllers.CreateRealtimeTicket)
+	realtimeGroup.GET("/ws", controllers.RealtimeWebSocket)
+	realtimeGroup.GET("/events", controllers.RealtimeEvents)
+
 	r.Run()
 }
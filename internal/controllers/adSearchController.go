@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultSearchRadiusKm = 10  // Radius used when a postcode is given without radius_km
+	maxSearchRadiusKm     = 500 // Largest radius_km accepted
+)
+
+// parsePrice reads an optional price query parameter in pence
+func parsePrice(c *gin.Context, name string) (*int64, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, true
+	}
+	price, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || price < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a positive amount in pence"})
+		return nil, false
+	}
+	return &price, true
+}
+
+// addDistances sets the distance in kilometres from origin on the serialized ads, items[i] being ads[i]
+func addDistances(items []gin.H, ads []models.Ad, origin services.Coordinates) {
+	for i, ad := range ads {
+		if ad.Latitude != nil && ad.Longitude != nil {
+			distance := services.DistanceKm(origin, services.Coordinates{Latitude: *ad.Latitude, Longitude: *ad.Longitude})
+			items[i]["distance_km"] = math.Max(1, math.Round(distance))
+		}
+	}
+}
+
+// parseDeliveryMethods reads the comma separated delivery query parameter into a set of methods
+func parseDeliveryMethods(c *gin.Context) (map[string]bool, bool) {
+	value := c.Query("delivery")
+	if value == "" {
+		return nil, true
+	}
+	methods := map[string]bool{}
+	for _, method := range strings.Split(value, ",") {
+		method = strings.TrimSpace(method)
+		if !models.IsDeliveryMethod(method) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery", "allowed": models.DeliveryMethods})
+			return nil, false
+		}
+		methods[method] = true
+	}
+	return methods, true
+}
+
+/*
+SearchAds lists active ads matching the query filters. Given a postcode, results can be limited
+to radius_km around its district and sorted by distance. delivery keeps ads offering any of the
+listed methods; local delivery and shipping reach the buyer, so they lift the default radius.
+Top of category promotions matching the filters are placed at promotedPositions of the first page,
+which holds back as many organic results for the next page, and highlighted ads are labelled.
+*/
+func SearchAds(c *gin.Context) {
+	query := initializers.DB.Model(&models.Ad{}).
+		Scopes(services.HideAdsOfInactiveOwners, services.HideAdsOfBlockers(viewerID(c))).
+		Where("ads.status = ?", models.AdStatusActive)
+
+	if keywords := strings.TrimSpace(c.Query("q")); keywords != "" {
+		query = query.Where("to_tsvector('simple', ads.title || ' ' || ads.description) @@ plainto_tsquery('simple', ?)", keywords)
+	}
+	if value := c.Query("category_id"); value != "" {
+		categoryID, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category_id"})
+			return
+		}
+		query = query.Where("ads.category_id = ?", categoryID)
+	}
+	if condition := c.Query("condition"); condition != "" {
+		if !models.IsAdCondition(condition) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid condition", "allowed": models.AdConditions})
+			return
+		}
+		query = query.Where("ads.condition = ?", condition)
+	}
+	minPrice, ok := parsePrice(c, "min_price")
+	if !ok {
+		return
+	}
+	maxPrice, ok := parsePrice(c, "max_price")
+	if !ok {
+		return
+	}
+	if minPrice != nil {
+		query = query.Where("ads.price >= ?", *minPrice)
+	}
+	if maxPrice != nil {
+		query = query.Where("ads.price <= ?", *maxPrice)
+	}
+
+	deliveries, ok := parseDeliveryMethods(c)
+	if !ok {
+		return
+	}
+	delivered := deliveries[models.DeliveryLocal] || deliveries[models.DeliveryShipping]
+
+	// Distance filtering from the centroid of the postcode's district
+	var origin *services.Coordinates
+	if postcode := c.Query("postcode"); postcode != "" {
+		point, found := services.GeocodePostcode(postcode)
+		if !found {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown postcode"})
+			return
+		}
+		origin = &point
+
+		radius := float64(defaultSearchRadiusKm)
+		if value := c.Query("radius_km"); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed <= 0 || parsed > maxSearchRadiusKm {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "radius_km must be between 0 and 500"})
+				return
+			}
+			radius = parsed
+		} else if delivered {
+			radius = 0
+		}
+		if radius > 0 {
+			query = query.Scopes(services.AdsWithinRadius(point, radius))
+		}
+	} else if c.Query("radius_km") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "radius_km requires a postcode"})
+		return
+	}
+
+	if deliveries != nil {
+		if origin == nil && deliveries[models.DeliveryLocal] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Local delivery requires a postcode"})
+			return
+		}
+		query = query.Scopes(services.AdsOfferingDelivery(deliveries, origin))
+	}
+
+	// Filtered query shared by organic and promoted results
+	query = query.Session(&gorm.Session{})
+	filtered := query
+
+	switch sort := c.DefaultQuery("sort", "newest"); sort {
+	case "newest":
+		query = query.Order("ads.created_at DESC")
+	case "price_asc":
+		query = query.Order("ads.price ASC, ads.created_at DESC")
+	case "price_desc":
+		query = query.Order("ads.price DESC, ads.created_at DESC")
+	case "distance":
+		if origin == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sorting by distance requires a postcode"})
+			return
+		}
+		query = query.Scopes(services.OrderAdsByDistance(*origin))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be newest, price_asc, price_desc or distance"})
+		return
+	}
+
+	page, limit, offset := pagination(c)
+
+	// Promoted positions that fit in a page, the first page has as many fewer organic results
+	promotedSlots := 0
+	for _, position := range promotedPositions {
+		if position < limit {
+			promotedSlots++
+		}
+	}
+	organicLimit := limit
+	if page == 1 {
+		organicLimit -= promotedSlots
+	} else {
+		offset -= promotedSlots
+	}
+
+	var ads []models.Ad
+	if organicLimit > 0 {
+		if err := query.Limit(organicLimit).Offset(offset).Find(&ads).Error; err != nil {
+			log.Printf("Failed to search ads: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search ads"})
+			return
+		}
+	}
+
+	// Top of category promotions matching the filters take fixed positions on the first page
+	var promoted []models.Ad
+	if page == 1 && promotedSlots > 0 {
+		if err := filtered.Scopes(services.PromotedAds(models.PromotionTopOfCategory)).
+			Order("RANDOM()").
+			Limit(promotedSlots).
+			Find(&promoted).Error; err != nil {
+			log.Printf("Failed to load promoted ads: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search ads"})
+			return
+		}
+	}
+	promotedItems, err := labelPromotedAds(promoted, models.PromotionTopOfCategory)
+	if err != nil {
+		log.Printf("Failed to load ad promotions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search ads"})
+		return
+	}
+
+	// Highlighted ads stay in place with a label, promoted ones aren't repeated
+	isPromoted := map[uint]bool{}
+	for _, ad := range promoted {
+		isPromoted[ad.ID] = true
+	}
+	organic := make([]models.Ad, 0, len(ads))
+	for _, ad := range ads {
+		if !isPromoted[ad.ID] {
+			organic = append(organic, ad)
+		}
+	}
+	organicItems, err := labelPromotedAds(organic, models.PromotionHighlight)
+	if err != nil {
+		log.Printf("Failed to load ad promotions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search ads"})
+		return
+	}
+
+	// Distances are rounded like locations so they can't pinpoint a seller
+	if origin != nil {
+		addDistances(promotedItems, promoted, *origin)
+		addDistances(organicItems, organic, *origin)
+	}
+
+	items := make([]gin.H, 0, limit)
+	for _, position := range promotedPositions[:promotedSlots] {
+		for len(items) < position && len(organicItems) > 0 {
+			items, organicItems = append(items, organicItems[0]), organicItems[1:]
+		}
+		if len(promotedItems) > 0 {
+			items, promotedItems = append(items, promotedItems[0]), promotedItems[1:]
+		}
+	}
+	items = append(items, organicItems...)
+
+	c.JSON(http.StatusOK, gin.H{
+		"ads":   items,
+		"page":  page,
+		"limit": limit,
+	})
+}
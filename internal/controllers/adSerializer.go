@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"log"
+
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// serializeAdSummary returns the public fields shown for an ad in listings
+func serializeAdSummary(ad models.Ad) gin.H {
+	return gin.H{
+		"id":          ad.ID,
+		"title":       ad.Title,
+		"category_id": ad.CategoryID,
+		"condition":   ad.Condition,
+		"price":       ad.Price,
+		"city":        ad.City,
+		"location":    serializeAdLocation(ad),
+		"delivery":    serializeAdDelivery(ad),
+		"status":      ad.Status,
+		"created_at":  ad.CreatedAt,
+	}
+}
+
+// serializeAdDelivery returns the delivery methods offered on the ad, shipping priced from the cheapest destination
+func serializeAdDelivery(ad models.Ad) gin.H {
+	data := gin.H{"pickup": ad.PickupAvailable, "local_delivery": nil, "shipping": nil}
+	if ad.LocalDeliveryKm > 0 {
+		data["local_delivery"] = gin.H{"radius_km": ad.LocalDeliveryKm, "price": ad.LocalDeliveryPrice}
+	}
+	if ad.ParcelSize != "" {
+		shipping := gin.H{"parcel_size": ad.ParcelSize}
+		if price, err := services.Shipping.Quote(ad.ParcelSize, ad.Postcode, ""); err == nil {
+			shipping["price_from"] = price
+		} else {
+			log.Printf("Failed to quote shipping of ad %d: %v", ad.ID, err)
+		}
+		data["shipping"] = shipping
+	}
+	return data
+}
+
+// serializeAdLocation returns the ad's district and rounded coordinates, never its full postcode
+func serializeAdLocation(ad models.Ad) interface{} {
+	if ad.Latitude == nil || ad.Longitude == nil {
+		return nil
+	}
+	point := services.FuzzCoordinates(services.Coordinates{Latitude: *ad.Latitude, Longitude: *ad.Longitude})
+	return gin.H{
+		"district":  services.PostcodeDistrict(ad.Postcode),
+		"latitude":  point.Latitude,
+		"longitude": point.Longitude,
+	}
+}
+
+/*
+	serializeAd returns an ad's full details. Contact fields are masked, and only listed at all
+	when the owner's privacy settings allow the viewer to reveal them via RevealAdContact.
+*/
+func serializeAd(ad models.Ad, ownerSettings models.PrivacySettings, viewer uint) gin.H {
+	data := serializeAdSummary(ad)
+	data["description"] = ad.Description
+	data["user_id"] = ad.UserID
+	data["updated_at"] = ad.UpdatedAt
+	data["expires_at"] = ad.ExpiresAt
+	data["reserved_until"] = ad.ReservedUntil
+
+	// The owner always sees their own contact details and full postcode
+	if viewer != 0 && viewer == ad.UserID {
+		data["postcode"] = ad.Postcode
+		data["contact"] = gin.H{"phone_number": ad.PhoneNumber, "email_address": ad.EmailAddress}
+	} else {
+		data["contact"] = maskedAdContact(ad, ownerSettings, viewer)
+	}
+	data["allow_messages"] = ownerSettings.AllowMessages
+	return data
+}
+
+// revealableAdContact returns the contact fields the viewer may reveal, unmasked
+func revealableAdContact(ad models.Ad, ownerSettings models.PrivacySettings, viewer uint) gin.H {
+	contact := gin.H{}
+	if ad.PhoneNumber != "" && services.CanSee(ownerSettings.PhoneVisibility, ad.UserID, viewer) {
+		contact["phone_number"] = ad.PhoneNumber
+	}
+	if ad.EmailAddress != "" && services.CanSee(ownerSettings.EmailVisibility, ad.UserID, viewer) {
+		contact["email_address"] = ad.EmailAddress
+	}
+	return contact
+}
+
+func maskedAdContact(ad models.Ad, ownerSettings models.PrivacySettings, viewer uint) gin.H {
+	contact := gin.H{}
+	revealable := revealableAdContact(ad, ownerSettings, viewer)
+	if phone, ok := revealable["phone_number"].(string); ok {
+		contact["phone_number"] = services.MaskPhoneNumber(phone)
+	}
+	if email, ok := revealable["email_address"].(string); ok {
+		contact["email_address"] = services.MaskEmail(email)
+	}
+	contact["revealable"] = len(revealable) > 0
+	return contact
+}
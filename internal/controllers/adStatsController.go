@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const maxStatsDays = 365 // Longest period the stats endpoints cover
+
+type adStatTotals struct {
+	Views          int64 `json:"views"`
+	Favorites      int64 `json:"favorites"`
+	ContactReveals int64 `json:"contact_reveals"`
+	Messages       int64 `json:"messages"`
+}
+
+// statsPeriod reads the days query parameter, defaulting to 30, and returns the first day of the period
+func statsPeriod(c *gin.Context) (time.Time, int, bool) {
+	days := 30
+	if value := c.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxStatsDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 365"})
+			return time.Time{}, 0, false
+		}
+		days = parsed
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	return today.AddDate(0, 0, 1-days), days, true
+}
+
+// GetAdStats returns the daily stats of one of the user's ads, with missing days filled with zeros
+func GetAdStats(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	adID, err := strconv.Atoi(c.Param("adID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid adID"})
+		return
+	}
+
+	var ad models.Ad
+	if err := initializers.DB.Select("id, user_id").First(&ad, adID).Error; err != nil || ad.UserID != user.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	}
+
+	since, days, ok := statsPeriod(c)
+	if !ok {
+		return
+	}
+
+	var stats []models.AdDailyStat
+	if err := initializers.DB.Where("ad_id = ? AND date >= ?", ad.ID, since).Order("date").Find(&stats).Error; err != nil {
+		log.Printf("Failed to load stats of ad %d: %v", ad.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve stats"})
+		return
+	}
+	byDate := map[string]models.AdDailyStat{}
+	for _, stat := range stats {
+		byDate[stat.Date.Format("2006-01-02")] = stat
+	}
+
+	var totals adStatTotals
+	series := make([]gin.H, 0, days)
+	for day := since; len(series) < days; day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		stat := byDate[date]
+		totals.Views += stat.Views
+		totals.Favorites += stat.Favorites
+		totals.ContactReveals += stat.ContactReveals
+		totals.Messages += stat.Messages
+		series = append(series, gin.H{
+			"date":            date,
+			"views":           stat.Views,
+			"favorites":       stat.Favorites,
+			"contact_reveals": stat.ContactReveals,
+			"messages":        stat.Messages,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ad_id":  ad.ID,
+		"days":   days,
+		"series": series,
+		"totals": totals,
+	})
+}
+
+// GetSellerStats returns the stats of all the user's ads over the period, per ad and combined
+func GetSellerStats(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	since, days, ok := statsPeriod(c)
+	if !ok {
+		return
+	}
+
+	var rows []struct {
+		AdID           uint
+		Title          string
+		Views          int64
+		Favorites      int64
+		ContactReveals int64
+		Messages       int64
+	}
+	if err := initializers.DB.Table("ad_daily_stats s").
+		Select("s.ad_id, a.title, SUM(s.views) AS views, SUM(s.favorites) AS favorites, SUM(s.contact_reveals) AS contact_reveals, SUM(s.messages) AS messages").
+		Joins("JOIN ads a ON a.id = s.ad_id").
+		Where("a.user_id = ? AND a.deleted_at IS NULL AND s.date >= ?", user.ID, since).
+		Group("s.ad_id, a.title").
+		Order("views DESC").
+		Scan(&rows).Error; err != nil {
+		log.Printf("Failed to load ad stats of user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve stats"})
+		return
+	}
+
+	var totals adStatTotals
+	ads := make([]gin.H, 0, len(rows))
+	for _, row := range rows {
+		adTotals := adStatTotals{row.Views, row.Favorites, row.ContactReveals, row.Messages}
+		totals.Views += adTotals.Views
+		totals.Favorites += adTotals.Favorites
+		totals.ContactReveals += adTotals.ContactReveals
+		totals.Messages += adTotals.Messages
+		ads = append(ads, gin.H{"ad_id": row.AdID, "title": row.Title, "totals": adTotals})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"days":   days,
+		"ads":    ads,
+		"totals": totals,
+	})
+}
@@ -0,0 +1,537 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxAdTitleLength        = 120       // Maximum characters of an ad title
+	maxAdDescriptionLength  = 5000      // Maximum characters of an ad description
+	contactRevealRateLimit  = 30        // Maximum contact reveals per viewer within the rate window
+	contactRevealRateWindow = time.Hour // Rate limit window per viewer
+)
+
+type adInput struct {
+	Title        string `json:"title" binding:"required"`
+	Description  string `json:"description"`
+	CategoryID   uint   `json:"category_id" binding:"required"`
+	Condition    string `json:"condition" binding:"required"`
+	City         string `json:"city"`
+	Postcode     string `json:"postcode"`
+	Price        int64  `json:"price"` // In pence
+	PhoneNumber  string `json:"phone_number"`
+	EmailAddress string `json:"email_address"`
+
+	PickupAvailable    *bool  `json:"pickup_available"` // Defaults to true
+	LocalDeliveryKm    int    `json:"local_delivery_km"`
+	LocalDeliveryPrice int64  `json:"local_delivery_price"` // In pence
+	ParcelSize         string `json:"parcel_size"`
+}
+
+type adPatchInput struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	CategoryID  *uint   `json:"category_id"`
+	Condition   *string `json:"condition"`
+	City        *string `json:"city"`
+	Postcode    *string `json:"postcode"`
+	Price       *int64  `json:"price"` // In pence
+	PhoneNumber *string `json:"phone_number"`
+
+	PickupAvailable    *bool   `json:"pickup_available"`
+	LocalDeliveryKm    *int    `json:"local_delivery_km"`
+	LocalDeliveryPrice *int64  `json:"local_delivery_price"` // In pence
+	ParcelSize         *string `json:"parcel_size"`
+}
+
+// adLocation geocodes a postcode to its district centroid. Unknown postcodes leave the ad out of distance searches
+func adLocation(postcode string) (*float64, *float64) {
+	point, ok := services.GeocodePostcode(postcode)
+	if postcode == "" || !ok {
+		return nil, nil
+	}
+	return &point.Latitude, &point.Longitude
+}
+
+/*
+normalizeAdPhone converts the ad's phone number to E.164 so it matches the owner's verified number.
+National numbers are read in the owner's country when it is an ISO alpha-2 code.
+*/
+func normalizeAdPhone(c *gin.Context, input *adInput, owner models.User) bool {
+	if strings.TrimSpace(input.PhoneNumber) == "" {
+		input.PhoneNumber = ""
+		return true
+	}
+	country := ""
+	if services.IsCountryCode(strings.TrimSpace(owner.Country)) {
+		country = strings.TrimSpace(owner.Country)
+	}
+	phoneNumber, err := services.NormalizePhoneNumber(input.PhoneNumber, country)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid phone number, enter it in international format like +447700900123"})
+		return false
+	}
+	input.PhoneNumber = phoneNumber
+	return true
+}
+
+// validateAdInput trims and checks the fields of a new ad
+func validateAdInput(c *gin.Context, input *adInput) bool {
+	input.Title = strings.TrimSpace(input.Title)
+	input.Description = strings.TrimSpace(input.Description)
+	input.City = strings.TrimSpace(input.City)
+	input.Postcode = strings.ToUpper(strings.TrimSpace(input.Postcode))
+
+	if input.Title == "" || utf8.RuneCountInString(input.Title) > maxAdTitleLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Title must be between 1 and 120 characters"})
+		return false
+	}
+	if utf8.RuneCountInString(input.Description) > maxAdDescriptionLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Description must be at most 5000 characters"})
+		return false
+	}
+	if !models.IsAdCondition(input.Condition) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid condition", "allowed": models.AdConditions})
+		return false
+	}
+	if input.Price < 0 || input.Price > maxOfferAmount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Price must be between 0 and 100000000 pence"})
+		return false
+	}
+	if err := initializers.DB.Select("id").First(&models.Category{}, input.CategoryID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Category not found"})
+		return false
+	}
+	return validateAdDelivery(c, input)
+}
+
+// validateAdDelivery checks the delivery options of an ad, at least one has to be offered
+func validateAdDelivery(c *gin.Context, input *adInput) bool {
+	if input.PickupAvailable == nil {
+		pickup := true
+		input.PickupAvailable = &pickup
+	}
+	input.ParcelSize = strings.TrimSpace(input.ParcelSize)
+
+	if input.LocalDeliveryKm < 0 || input.LocalDeliveryKm > maxLocalDeliveryKm {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Local delivery radius must be between 0 and 100 km"})
+		return false
+	}
+	if input.LocalDeliveryKm == 0 {
+		input.LocalDeliveryPrice = 0
+	} else if _, ok := services.GeocodePostcode(input.Postcode); input.Postcode == "" || !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Local delivery needs the ad's postcode"})
+		return false
+	}
+	if input.LocalDeliveryPrice < 0 || input.LocalDeliveryPrice > maxOfferAmount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Local delivery price must be between 0 and 100000000 pence"})
+		return false
+	}
+	if input.ParcelSize != "" && !models.IsParcelSize(input.ParcelSize) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid parcel_size", "allowed": models.ParcelSizes})
+		return false
+	}
+	if !*input.PickupAvailable && input.LocalDeliveryKm == 0 && input.ParcelSize == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Offer at least one of pickup, local delivery or shipping"})
+		return false
+	}
+	return true
+}
+
+// CreateAd publishes a new ad for the authenticated user
+func CreateAd(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var input adInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validateAdInput(c, &input) || !normalizeAdPhone(c, &input, user) {
+		return
+	}
+
+	ad := models.Ad{
+		Title:        input.Title,
+		Description:  input.Description,
+		CategoryID:   input.CategoryID,
+		UserID:       user.ID,
+		Condition:    input.Condition,
+		City:         input.City,
+		Postcode:     input.Postcode,
+		Price:        input.Price,
+		PhoneNumber:  input.PhoneNumber,
+		EmailAddress: strings.TrimSpace(input.EmailAddress),
+		Status:       models.AdStatusActive,
+
+		PickupAvailable:    *input.PickupAvailable,
+		LocalDeliveryKm:    input.LocalDeliveryKm,
+		LocalDeliveryPrice: input.LocalDeliveryPrice,
+		ParcelSize:         input.ParcelSize,
+	}
+	ad.Latitude, ad.Longitude = adLocation(ad.Postcode)
+	expiresAt := time.Now().Add(services.AdLifetime())
+	ad.ExpiresAt = &expiresAt
+	// Selecting every column keeps GORM from replacing a false PickupAvailable with the column default
+	if err := initializers.DB.Select("*").Omit("ID", "Category", "User").Create(&ad).Error; err != nil {
+		if errors.Is(err, models.ErrUnverifiedAdPhone) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Verify your phone number before showing it on an ad"})
+			return
+		}
+		log.Printf("Failed to create ad for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish ad"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"ad": serializeAd(ad, services.PrivacyFor(ad.UserID), user.ID),
+	})
+}
+
+// UpdateAd lets the owner edit an ad that is still listed. Price drops alert the users who favorited it
+func UpdateAd(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	adID, err := strconv.Atoi(c.Param("adID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid adID"})
+		return
+	}
+
+	var ad models.Ad
+	if err := initializers.DB.First(&ad, adID).Error; err != nil || ad.UserID != user.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	}
+	if ad.Status != models.AdStatusActive && ad.Status != models.AdStatusReserved {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only listed ads can be edited"})
+		return
+	}
+
+	var patch adPatchInput
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Validate the ad as it will be after the edit
+	input := adInput{
+		Title:       ad.Title,
+		Description: ad.Description,
+		CategoryID:  ad.CategoryID,
+		Condition:   ad.Condition,
+		City:        ad.City,
+		Postcode:    ad.Postcode,
+		Price:       ad.Price,
+		PhoneNumber: ad.PhoneNumber,
+
+		PickupAvailable:    &ad.PickupAvailable,
+		LocalDeliveryKm:    ad.LocalDeliveryKm,
+		LocalDeliveryPrice: ad.LocalDeliveryPrice,
+		ParcelSize:         ad.ParcelSize,
+	}
+	if patch.Title != nil {
+		input.Title = *patch.Title
+	}
+	if patch.Description != nil {
+		input.Description = *patch.Description
+	}
+	if patch.CategoryID != nil {
+		input.CategoryID = *patch.CategoryID
+	}
+	if patch.Condition != nil {
+		input.Condition = *patch.Condition
+	}
+	if patch.City != nil {
+		input.City = *patch.City
+	}
+	if patch.Postcode != nil {
+		input.Postcode = *patch.Postcode
+	}
+	if patch.Price != nil {
+		input.Price = *patch.Price
+	}
+	if patch.PhoneNumber != nil {
+		input.PhoneNumber = *patch.PhoneNumber
+	}
+	if patch.PickupAvailable != nil {
+		input.PickupAvailable = patch.PickupAvailable
+	}
+	if patch.LocalDeliveryKm != nil {
+		input.LocalDeliveryKm = *patch.LocalDeliveryKm
+	}
+	if patch.LocalDeliveryPrice != nil {
+		input.LocalDeliveryPrice = *patch.LocalDeliveryPrice
+	}
+	if patch.ParcelSize != nil {
+		input.ParcelSize = *patch.ParcelSize
+	}
+	if !validateAdInput(c, &input) || !normalizeAdPhone(c, &input, user) {
+		return
+	}
+
+	// Top of category slots are booked per category, so the category is fixed while one is booked
+	if input.CategoryID != ad.CategoryID {
+		promoted, err := services.HasBookedPromotion(ad.ID, models.PromotionTopOfCategory)
+		if err != nil {
+			log.Printf("Failed to load promotions of ad %d: %v", ad.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ad"})
+			return
+		}
+		if promoted {
+			c.JSON(http.StatusConflict, gin.H{"error": "Cancel the ad's top of category promotion before changing its category"})
+			return
+		}
+	}
+
+	previousPrice := ad.Price
+	latitude, longitude := adLocation(input.Postcode)
+	ad.PhoneNumber = input.PhoneNumber // Checked by Ad.BeforeSave, which sees the ad rather than the updated columns
+	if err := initializers.DB.Model(&ad).Updates(map[string]interface{}{
+		"title":       input.Title,
+		"description": input.Description,
+		"category_id": input.CategoryID,
+		"condition":   input.Condition,
+		"city":        input.City,
+		"postcode":    input.Postcode,
+		"latitude":    latitude,
+		"longitude":   longitude,
+		"price":       input.Price,
+
+		"phone_number": input.PhoneNumber,
+
+		"pickup_available":     *input.PickupAvailable,
+		"local_delivery_km":    input.LocalDeliveryKm,
+		"local_delivery_price": input.LocalDeliveryPrice,
+		"parcel_size":          input.ParcelSize,
+	}).Error; err != nil {
+		if errors.Is(err, models.ErrUnverifiedAdPhone) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Verify your phone number before showing it on an ad"})
+			return
+		}
+		log.Printf("Failed to update ad %d: %v", ad.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ad"})
+		return
+	}
+	ad.Title, ad.Description, ad.CategoryID = input.Title, input.Description, input.CategoryID
+	ad.Condition, ad.City, ad.Postcode, ad.Price = input.Condition, input.City, input.Postcode, input.Price
+	ad.Latitude, ad.Longitude = latitude, longitude
+	ad.PickupAvailable, ad.LocalDeliveryKm = *input.PickupAvailable, input.LocalDeliveryKm
+	ad.LocalDeliveryPrice, ad.ParcelSize = input.LocalDeliveryPrice, input.ParcelSize
+
+	// A rise rearms price drop alerts, so a later drop to an already alerted price is notified again
+	if ad.Price > previousPrice {
+		services.ClearFavoriteAlerts(ad.ID, models.FavoriteAlertPriceDrop)
+	}
+	if ad.Price < previousPrice {
+		services.NotifyFavoriters(ad, models.FavoriteAlertPriceDrop, strconv.FormatInt(ad.Price, 10), fmt.Sprintf(
+			"The price of \"%s\" from your favorites dropped from %s to %s.",
+			ad.Title, formatPence(previousPrice), formatPence(ad.Price),
+		))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ad": serializeAd(ad, services.PrivacyFor(ad.UserID), user.ID),
+	})
+}
+
+/*
+RelistAd lets the owner put an expired ad back on sale, or renew an active one before it expires.
+Either way the ad stays listed for a full lifetime from now.
+*/
+func RelistAd(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	adID, err := strconv.Atoi(c.Param("adID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid adID"})
+		return
+	}
+
+	var ad models.Ad
+	if err := initializers.DB.First(&ad, adID).Error; err != nil || ad.UserID != user.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	}
+
+	expiresAt := time.Now().Add(services.AdLifetime())
+	result := initializers.DB.Model(&ad).
+		Where("status IN ?", []string{models.AdStatusActive, models.AdStatusExpired}).
+		Updates(map[string]interface{}{
+			"status":     models.AdStatusActive,
+			"expires_at": expiresAt,
+		})
+	if result.Error != nil {
+		log.Printf("Failed to relist ad %d: %v", ad.ID, result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to relist ad"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only active or expired ads can be relisted"})
+		return
+	}
+	ad.Status, ad.ExpiresAt = models.AdStatusActive, &expiresAt
+
+	c.JSON(http.StatusOK, gin.H{
+		"ad": serializeAd(ad, services.PrivacyFor(ad.UserID), user.ID),
+	})
+}
+
+func ViewAd(c *gin.Context) {
+	adID, err := strconv.Atoi(c.Param("adID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid adID"})
+		return
+	}
+
+	var ad models.Ad
+	if err := initializers.DB.Scopes(services.HideAdsOfInactiveOwners).First(&ad, adID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	}
+	// Ads removed by a moderator are only visible to their owner
+	if ad.Status == models.AdStatusRemoved && ad.UserID != viewerID(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	}
+	// Users blocked by the seller don't see their ads
+	if viewer := viewerID(c); viewer != 0 && services.HasBlocked(ad.UserID, viewer) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	}
+
+	// Owners viewing their own ad don't count
+	if ad.UserID != viewerID(c) {
+		services.RecordAdView(ad.ID, adVisitor(c))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ad": serializeAd(ad, services.PrivacyFor(ad.UserID), viewerID(c)),
+	})
+}
+
+// adVisitor identifies a viewer for unique view counting, anonymous viewers by IP and user agent
+func adVisitor(c *gin.Context) string {
+	if viewer := viewerID(c); viewer != 0 {
+		return fmt.Sprintf("user:%d", viewer)
+	}
+	sum := sha256.Sum256([]byte(c.ClientIP() + "|" + c.Request.UserAgent()))
+	return "anon:" + hex.EncodeToString(sum[:16])
+}
+
+func getContactRevealRateKey(viewerID uint) string {
+	// Generate a key for rate limiting contact reveals per viewer
+	return fmt.Sprintf("contact_reveal_rate:%d", viewerID)
+}
+
+func RevealAdContact(c *gin.Context) {
+	viewer, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	adID, err := strconv.Atoi(c.Param("adID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid adID"})
+		return
+	}
+
+	var ad models.Ad
+	if err := initializers.DB.Scopes(services.HideAdsOfInactiveOwners).First(&ad, adID).Error; err != nil || ad.Status == models.AdStatusRemoved {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	}
+
+	// Owners see their own details without counting a lead
+	settings := services.PrivacyFor(ad.UserID)
+	if ad.UserID == viewer.ID {
+		c.JSON(http.StatusOK, gin.H{"contact": revealableAdContact(ad, settings, viewer.ID)})
+		return
+	}
+
+	if !requireNotBlocked(c, viewer.ID, ad.UserID) {
+		return
+	}
+
+	contact := revealableAdContact(ad, settings, viewer.ID)
+	if len(contact) == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The seller has not made their contact details available"})
+		return
+	}
+
+	// Rate limit per viewer to stop scraping
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+
+	rateKey := getContactRevealRateKey(viewer.ID)
+	pipe := initializers.RedisClient.TxPipeline()
+	count := pipe.Incr(ctx, rateKey)
+	pipe.ExpireNX(ctx, rateKey, contactRevealRateWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Redis error in RevealAdContact: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reveal contact details"})
+		return
+	}
+	if count.Val() > contactRevealRateLimit {
+		log.Printf("Contact reveal rate limit hit by user %d on ad %d", viewer.ID, ad.ID)
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many contact reveals, please try again later"})
+		return
+	}
+
+	// Log the reveal, one lead per viewer and ad
+	now := time.Now()
+	reveal := models.ContactReveal{
+		AdID:           ad.ID,
+		ViewerID:       viewer.ID,
+		SellerID:       ad.UserID,
+		IP:             c.ClientIP(),
+		RevealCount:    1,
+		LastRevealedAt: now,
+	}
+	if err := initializers.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "ad_id"}, {Name: "viewer_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"reveal_count":     gorm.Expr("contact_reveals.reveal_count + 1"),
+			"last_revealed_at": now,
+			"ip":               reveal.IP,
+			"updated_at":       now,
+		}),
+	}).Create(&reveal).Error; err != nil {
+		log.Printf("Failed to record contact reveal for ad %d: %v", ad.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reveal contact details"})
+		return
+	}
+	log.Printf("User %d revealed contact details of ad %d from %s", viewer.ID, ad.ID, reveal.IP)
+	services.IncrementAdStat(ad.ID, services.AdStatContactReveals)
+
+	c.JSON(http.StatusOK, gin.H{"contact": contact})
+}
@@ -2,9 +2,8 @@ package controllers
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -14,11 +13,11 @@ import (
 
 	"github.com/Desk888/api/internal/initializers"
 	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 	"github.com/markbates/goth/gothic"
 	"github.com/redis/go-redis/v9"
-	"golang.org/x/crypto/bcrypt"
 	"github.com/google/uuid"
 )
 
@@ -48,13 +47,33 @@ func contextWithTimeout() (context.Context, context.CancelFunc) {
 
 func generateTokenHash(token string) string {
 	// Generate a SHA-256 hash of the token
-	hash := sha256.Sum256([]byte(token))
-	return hex.EncodeToString(hash[:])
+	return services.TokenHash(token)
 }
 
 func getUserSessionKey(userID uint) string {
 	// Generate a key for storing user sessions in Redis
-	return fmt.Sprintf("user_sessions:%d", userID)
+	return services.UserSessionKey(userID)
+}
+
+// validatePassword applies the password policy and responds with every failed rule
+func validatePassword(c *gin.Context, password, username, email string) bool {
+	err := services.Policy.Validate(password, username, email)
+	if err == nil {
+		return true
+	}
+
+	var policyErr *services.PolicyError
+	if errors.As(err, &policyErr) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":      "Password does not meet the password policy",
+			"violations": policyErr.Violations,
+		})
+		return false
+	}
+
+	log.Printf("Password validation failed: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate password"})
+	return false
 }
 
 func Signup(c *gin.Context) {
@@ -63,7 +82,7 @@ func Signup(c *gin.Context) {
 		LastName     string `json:"lastName" binding:"required"`
 		Username     string `json:"username" binding:"required"`
 		Email        string `json:"email" binding:"required,email"`
-		Password     string `json:"password" binding:"required,min=8"`
+		Password     string `json:"password" binding:"required"`
 		PhoneNumber  string `json:"phoneNumber"`
 		City         string `json:"city"`
 		Country      string `json:"country"`
@@ -75,8 +94,28 @@ func Signup(c *gin.Context) {
 		return
 	}
 
+	// Validate password against the password policy
+	if !validatePassword(c, body.Password, body.Username, body.Email) {
+		return
+	}
+
+	// Normalize phone number to E.164, it stays unverified until confirmed by OTP.
+	// Country is free text, national numbers only use it when it is an ISO alpha-2 code
+	if body.PhoneNumber != "" {
+		country := ""
+		if services.IsCountryCode(strings.TrimSpace(body.Country)) {
+			country = body.Country
+		}
+		phoneNumber, err := services.NormalizePhoneNumber(body.PhoneNumber, country)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid phone number, enter it in international format like +447700900123"})
+			return
+		}
+		body.PhoneNumber = phoneNumber
+	}
+
 	// Hash password
-	hash, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+	hash, err := services.HashPassword(body.Password)
 	if err != nil {
 		log.Printf("Failed to hash password: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
@@ -89,7 +128,7 @@ func Signup(c *gin.Context) {
 		LastName:     body.LastName,
 		Username:     body.Username,
 		Email:        body.Email,
-		PasswordHash: string(hash),
+		PasswordHash: hash,
 		PhoneNumber:  body.PhoneNumber,
 		City: body.City,
 		Country: body.Country,
@@ -131,29 +170,41 @@ func Signup(c *gin.Context) {
 	})
 }
 
-func Signin(c *gin.Context) {
-	var body struct {
-		Email    string `json:"email" binding:"required,email"`
-		Password string `json:"password" binding:"required"`
-	}
-	// Bind request body to struct for payload validation
-	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+// upgradePasswordHash replaces a stored hash with one using the current hasher settings
+func upgradePasswordHash(user *models.User, password string) {
+	hash, err := services.HashPassword(password)
+	if err != nil {
+		log.Printf("Failed to rehash password for user %d: %v", user.ID, err)
 		return
 	}
 
-	// Find user by email
-	var user models.User
-	if err := initializers.DB.First(&user, "email = ?", body.Email).Error; err != nil {
-		_ = bcrypt.CompareHashAndPassword([]byte("$2a$10$dummyHashForTimingAttack"), []byte(body.Password))
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+	// Only replace the hash that was verified, in case the password changed concurrently
+	result := initializers.DB.Model(&models.User{}).
+		Where("id = ? AND password_hash = ?", user.ID, user.PasswordHash).
+		Update("password_hash", hash)
+	if result.Error != nil {
+		log.Printf("Failed to store upgraded password hash for user %d: %v", user.ID, result.Error)
 		return
 	}
+	user.PasswordHash = hash
+}
 
-	// Compare password hashes to finalize authentication
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(body.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
-		return
+/*
+	startSession signs a JWT for the user, stores its session in Redis, records the login
+	and sets the Authorization cookie. On failure it writes the error response and returns false.
+*/
+func startSession(c *gin.Context, user models.User) (string, bool) {
+	// Accounts pending deletion must be restored first
+	if user.IsDeactivated() {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":                 "Account is scheduled for deletion",
+			"deletion_scheduled_at": user.DeletionScheduledAt,
+		})
+		return "", false
+	}
+	if user.IsSuspended() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is suspended"})
+		return "", false
 	}
 
 	// Create JWT token
@@ -172,7 +223,7 @@ func Signin(c *gin.Context) {
 	if err != nil {
 		log.Printf("Error signing token: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
-		return
+		return "", false
 	}
 
 	// Create session data
@@ -188,7 +239,7 @@ func Signin(c *gin.Context) {
 	if err != nil {
 		log.Printf("Error marshaling session data: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
-		return
+		return "", false
 	}
 
 	// Store session data in Redis
@@ -209,9 +260,12 @@ func Signin(c *gin.Context) {
 	if _, err := pipe.Exec(ctx); err != nil {
 		log.Printf("Redis transaction failed: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
-		return
+		return "", false
 	}
 
+	// Record successful login and notify on new devices or locations
+	services.RecordLogin(user, true, "", sessionData.IP, sessionData.UserAgent)
+
 	// Set token as cookie
 	c.SetSameSite(http.SameSiteStrictMode)
 	c.SetCookie(
@@ -224,6 +278,50 @@ func Signin(c *gin.Context) {
 		true,
 	)
 
+	return tokenString, true
+}
+
+func Signin(c *gin.Context) {
+	var body struct {
+		Email    string `json:"email" binding:"required,email"`
+		Password string `json:"password" binding:"required"`
+	}
+	// Bind request body to struct for payload validation
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Find user by email
+	var user models.User
+	if err := initializers.DB.First(&user, "email = ?", body.Email).Error; err != nil {
+		services.VerifyDummyPassword(body.Password)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+
+	// Compare password hashes to finalize authentication
+	ok, needsRehash, err := services.VerifyPassword(body.Password, user.PasswordHash)
+	if err != nil {
+		log.Printf("Failed to verify password for user %d: %v", user.ID, err)
+	}
+	if !ok {
+		services.RecordLogin(user, false, services.LoginFailureBadPassword, c.ClientIP(), c.GetHeader("User-Agent"))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+
+	// Upgrade hashes created with an older algorithm or settings
+	if needsRehash {
+		upgradePasswordHash(&user, body.Password)
+	}
+
+	// Create JWT token, Redis session and cookie
+	tokenString, ok := startSession(c, user)
+	if !ok {
+		return
+	}
+
 	// Return success response
 	c.JSON(http.StatusOK, gin.H{
 		"token": tokenString,
@@ -237,6 +335,76 @@ func Signin(c *gin.Context) {
 	})
 }
 
+func RestoreAccount(c *gin.Context) {
+	var body struct {
+		Email    string `json:"email" binding:"required,email"`
+		Password string `json:"password" binding:"required"`
+	}
+	// Bind request body to struct for payload validation
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Find user by email
+	var user models.User
+	if err := initializers.DB.First(&user, "email = ?", body.Email).Error; err != nil {
+		services.VerifyDummyPassword(body.Password)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+
+	// Authenticate before revealing anything about the account state
+	ok, _, err := services.VerifyPassword(body.Password, user.PasswordHash)
+	if err != nil {
+		log.Printf("Failed to verify password for user %d: %v", user.ID, err)
+	}
+	if !ok {
+		services.RecordLogin(user, false, services.LoginFailureBadPassword, c.ClientIP(), c.GetHeader("User-Agent"))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+
+	if !user.IsDeactivated() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Account is not scheduled for deletion"})
+		return
+	}
+	if user.DeletionScheduledAt != nil && time.Now().After(*user.DeletionScheduledAt) {
+		c.JSON(http.StatusGone, gin.H{"error": "The restore period for this account has ended"})
+		return
+	}
+
+	// Cancel the deletion
+	if err := initializers.DB.Model(&user).Updates(map[string]interface{}{
+		"deactivated_at":        nil,
+		"deletion_scheduled_at": nil,
+	}).Error; err != nil {
+		log.Printf("Failed to restore user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore account"})
+		return
+	}
+	user.DeactivatedAt, user.DeletionScheduledAt = nil, nil
+	services.Audit(services.AuditAccountRestored, &user.ID, "user", user.ID, nil)
+
+	// Create JWT token, Redis session and cookie
+	tokenString, ok := startSession(c, user)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Account restored successfully",
+		"token":   tokenString,
+		"user": gin.H{
+			"id":        user.ID,
+			"username":  user.Username,
+			"email":     user.Email,
+			"firstName": user.FirstName,
+			"lastName":  user.LastName,
+		},
+	})
+}
+
 func Validate(c *gin.Context) {
 	// Get token from Authorization header
 	tokenString := c.GetHeader("Authorization")
@@ -534,7 +702,7 @@ func UpdatePassword(c *gin.Context) {
 	var body struct {
 		Email    string `json:"email" binding:"required,email"`
 		Token    string `json:"token" binding:"required"`
-		Password string `json:"password" binding:"required,min=8"`
+		Password string `json:"password" binding:"required"`
 	}
 
 	// Bind request body
@@ -556,15 +724,20 @@ func UpdatePassword(c *gin.Context) {
 		return
 	}
 
+	// Validate new password against the password policy
+	if !validatePassword(c, body.Password, user.Username, user.Email) {
+		return
+	}
+
 	// Hash new password
-	hash, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+	hash, err := services.HashPassword(body.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
 	}
 
 	// Update password and clear reset token
-	user.PasswordHash = string(hash)
+	user.PasswordHash = hash
 	user.PasswordResetToken = ""
 	user.PasswordResetExpiry = time.Time{}
 
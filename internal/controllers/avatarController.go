@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	maxAvatarUploadSize = 10 << 20 // Maximum avatar upload size (10 MB)
+	defaultAvatarSize   = 256      // Size returned as the main profile image
+)
+
+var avatarSizes = []int{64, 256, 512} // Square sizes stored for every avatar
+
+func avatarObjectKey(baseKey string, size int) string {
+	// Generate the S3 key for one size of an avatar
+	return fmt.Sprintf("%s_%d.jpg", baseKey, size)
+}
+
+func avatarObjectKeys(baseKey string) []string {
+	keys := make([]string, 0, len(avatarSizes))
+	for _, size := range avatarSizes {
+		keys = append(keys, avatarObjectKey(baseKey, size))
+	}
+	return keys
+}
+
+// avatarURLs returns the main avatar URL and one URL per size
+func avatarURLs(user models.User) (string, gin.H) {
+	if user.ProfilePictureKey == "" {
+		return user.ProfilePictureURL, nil
+	}
+
+	urls := gin.H{}
+	for _, size := range avatarSizes {
+		urls[strconv.Itoa(size)] = services.ObjectURL(avatarObjectKey(user.ProfilePictureKey, size))
+	}
+	return urls[strconv.Itoa(defaultAvatarSize)].(string), urls
+}
+
+func UploadAvatar(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// Read the uploaded file, bounded to the maximum size
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAvatarUploadSize+1<<20)
+	fileHeader, err := c.FormFile("avatar")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing avatar file"})
+		return
+	}
+	if fileHeader.Size > maxAvatarUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Avatar must be 10 MB or smaller"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read avatar file"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxAvatarUploadSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read avatar file"})
+		return
+	}
+
+	// Validate, strip metadata, crop and resize
+	images, err := services.ProcessSquareImage(data, avatarSizes)
+	if err != nil {
+		if errors.Is(err, services.ErrUnsupportedImage) || errors.Is(err, services.ErrImageTooSmall) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Failed to process avatar for user %d: %v", user.ID, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to process avatar image"})
+		return
+	}
+
+	// Upload every size under a new key so cached URLs of the old avatar never show the new one
+	baseKey := fmt.Sprintf("avatars/%d/%s", user.ID, uuid.New().String())
+	for size, image := range images {
+		if err := services.PutObject(avatarObjectKey(baseKey, size), image, "image/jpeg"); err != nil {
+			log.Printf("Failed to upload avatar for user %d: %v", user.ID, err)
+			services.DeleteObjects(avatarObjectKeys(baseKey)...)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store avatar"})
+			return
+		}
+	}
+
+	// Point the profile to the new avatar
+	oldKey := user.ProfilePictureKey
+	if err := initializers.DB.Model(&user).Updates(map[string]interface{}{
+		"profile_picture_key": baseKey,
+		"profile_picture_url": "",
+	}).Error; err != nil {
+		log.Printf("Failed to save avatar for user %d: %v", user.ID, err)
+		services.DeleteObjects(avatarObjectKeys(baseKey)...)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	// Remove the replaced avatar
+	if oldKey != "" {
+		go services.DeleteObjects(avatarObjectKeys(oldKey)...)
+	}
+
+	user.ProfilePictureKey = baseKey
+	profileImage, profileImages := avatarURLs(user)
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Avatar updated successfully",
+		"profile_image":  profileImage,
+		"profile_images": profileImages,
+	})
+}
+
+func DeleteAvatar(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	oldKey := user.ProfilePictureKey
+	if err := initializers.DB.Model(&user).Updates(map[string]interface{}{
+		"profile_picture_key": "",
+		"profile_picture_url": "",
+	}).Error; err != nil {
+		log.Printf("Failed to remove avatar for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	if oldKey != "" {
+		go services.DeleteObjects(avatarObjectKeys(oldKey)...)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Avatar removed successfully"})
+}
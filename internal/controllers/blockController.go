@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BlockUser adds a user to the authenticated user's block list
+func BlockUser(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	blockedID, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	if uint(blockedID) == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't block yourself"})
+		return
+	}
+
+	var blocked models.User
+	if err := initializers.DB.Select("id").First(&blocked, blockedID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	block := models.UserBlock{BlockerID: user.ID, BlockedID: blocked.ID}
+	if err := initializers.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&block).Error; err != nil {
+		log.Printf("Failed to block user %d for user %d: %v", blocked.ID, user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to block user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User blocked", "user_id": blocked.ID})
+}
+
+func UnblockUser(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	blockedID, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+
+	result := initializers.DB.Where("blocker_id = ? AND blocked_id = ?", user.ID, blockedID).Delete(&models.UserBlock{})
+	if result.Error != nil {
+		log.Printf("Failed to unblock user %d for user %d: %v", blockedID, user.ID, result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unblock user"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not blocked"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unblocked", "user_id": blockedID})
+}
+
+func ListBlockedUsers(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	page, limit, offset := pagination(c)
+
+	var blocks []models.UserBlock
+	if err := initializers.DB.
+		Preload("Blocked", func(db *gorm.DB) *gorm.DB { return db.Select("id, username, profile_picture_url, profile_picture_key") }).
+		Where("blocker_id = ?", user.ID).
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&blocks).Error; err != nil {
+		log.Printf("Failed to list blocked users of user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve blocked users"})
+		return
+	}
+
+	items := make([]gin.H, 0, len(blocks))
+	for _, block := range blocks {
+		profileImage, _ := avatarURLs(block.Blocked)
+		items = append(items, gin.H{
+			"user_id":       block.BlockedID,
+			"username":      block.Blocked.Username,
+			"profile_image": profileImage,
+			"blocked_at":    block.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"blocked_users": items,
+		"page":          page,
+		"limit":         limit,
+	})
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 20  // Default number of items per page
+	maxPageSize     = 100 // Maximum number of items per page
+)
+
+// currentUser returns the user set in the context by middleware.RequireAuth
+func currentUser(c *gin.Context) (models.User, bool) {
+	value, exists := c.Get("user")
+	if !exists {
+		return models.User{}, false
+	}
+	user, ok := value.(models.User)
+	return user, ok
+}
+
+// viewerID returns the authenticated user's ID, or 0 for anonymous visitors
+func viewerID(c *gin.Context) uint {
+	if user, ok := currentUser(c); ok {
+		return user.ID
+	}
+	return 0
+}
+
+// requireProfileOwner checks that the :userID route parameter is the authenticated user
+func requireProfileOwner(c *gin.Context) (models.User, bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return models.User{}, false
+	}
+
+	userID, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return models.User{}, false
+	}
+
+	if uint(userID) != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only modify your own profile"})
+		return models.User{}, false
+	}
+	return user, true
+}
+
+/*
+requireNotBlocked checks that neither user has blocked the other before they interact,
+writing a 403 response otherwise. Every endpoint where one user reaches another goes through it.
+*/
+func requireNotBlocked(c *gin.Context, userID, otherID uint) bool {
+	if services.IsBlocked(userID, otherID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can't interact with this user"})
+		return false
+	}
+	return true
+}
+
+// pagination reads the page and limit query parameters and returns limit and offset
+func pagination(c *gin.Context) (page, limit, offset int) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err = strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPageSize)))
+	if err != nil || limit < 1 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	return page, limit, (page - 1) * limit
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+func serializeDataExport(export models.DataExport) gin.H {
+	return gin.H{
+		"id":           export.ID,
+		"status":       export.Status,
+		"error":        export.Error,
+		"created_at":   export.CreatedAt,
+		"completed_at": export.CompletedAt,
+		"expires_at":   export.ExpiresAt,
+	}
+}
+
+func RequestDataExport(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	// Only one export per user at a time, enforced by a partial unique index
+	export := models.DataExport{UserID: user.ID, Status: models.ExportStatusPending}
+	if err := initializers.DB.Create(&export).Error; err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			c.JSON(http.StatusConflict, gin.H{"error": "An export is already in progress"})
+			return
+		}
+		log.Printf("Failed to create data export for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request data export"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Export requested, you will receive an email when it is ready",
+		"export":  serializeDataExport(export),
+	})
+}
+
+func GetDataExport(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	exportID, err := strconv.Atoi(c.Param("exportID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exportID"})
+		return
+	}
+
+	var export models.DataExport
+	if err := initializers.DB.Where("id = ? AND user_id = ?", exportID, user.ID).First(&export).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	}
+
+	response := serializeDataExport(export)
+
+	// Issue a fresh short-lived link while the archive exists
+	if export.Status == models.ExportStatusCompleted && export.ObjectKey != "" {
+		link, err := services.PresignedURL(export.ObjectKey, services.DataExportLinkExpiry, "grabit-data-export.zip")
+		if err != nil {
+			log.Printf("Failed to sign data export %d: %v", export.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create download link"})
+			return
+		}
+		response["download_url"] = link
+	}
+
+	c.JSON(http.StatusOK, gin.H{"export": response})
+}
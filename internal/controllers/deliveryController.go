@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+const maxLocalDeliveryKm = 100 // Largest local delivery radius a seller can offer
+
+// deliveryInput is the buyer's choice of delivery when making an offer or buying
+type deliveryInput struct {
+	DeliveryMethod string `json:"delivery_method"`
+	Postcode       string `json:"postcode"` // Where to deliver, not needed for pickup
+}
+
+// adDeliveryMethods lists the delivery methods the seller offers on the ad
+func adDeliveryMethods(ad models.Ad) []string {
+	methods := []string{}
+	for _, method := range models.DeliveryMethods {
+		if ad.OffersDelivery(method) {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// deliveryError returns the message shown to the buyer when a delivery can't be quoted
+func deliveryError(err error) (int, string) {
+	switch {
+	case errors.Is(err, services.ErrDeliveryUnavailable):
+		return http.StatusBadRequest, "The seller doesn't offer this delivery method"
+	case errors.Is(err, services.ErrDeliveryPostcode):
+		return http.StatusBadRequest, "A valid delivery postcode is required"
+	case errors.Is(err, services.ErrOutsideDeliveryArea):
+		return http.StatusBadRequest, "Your postcode is outside the seller's local delivery area"
+	}
+	return http.StatusBadGateway, "Shipping rates are unavailable, please try again"
+}
+
+/*
+quoteDelivery prices the delivery chosen by the buyer. Without a choice, pickup is used
+when offered, or the seller's only delivery method.
+*/
+func quoteDelivery(c *gin.Context, ad models.Ad, input deliveryInput) (services.Delivery, bool) {
+	methods := adDeliveryMethods(ad)
+	method := input.DeliveryMethod
+	if method == "" {
+		switch {
+		case ad.PickupAvailable:
+			method = models.DeliveryPickup
+		case len(methods) == 1:
+			method = methods[0]
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "delivery_method is required", "allowed": methods})
+			return services.Delivery{}, false
+		}
+	}
+
+	delivery, err := services.QuoteDelivery(ad, method, input.Postcode)
+	if err != nil {
+		status, message := deliveryError(err)
+		if status == http.StatusBadGateway {
+			log.Printf("Failed to quote %s delivery of ad %d: %v", method, ad.ID, err)
+		}
+		c.JSON(status, gin.H{"error": message, "allowed": methods})
+		return services.Delivery{}, false
+	}
+	return delivery, true
+}
+
+// QuoteAdDelivery prices each delivery method offered on an ad to the postcode given in the query
+func QuoteAdDelivery(c *gin.Context) {
+	adID, err := strconv.Atoi(c.Param("adID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid adID"})
+		return
+	}
+
+	var ad models.Ad
+	if err := initializers.DB.First(&ad, adID).Error; err != nil || ad.Status == models.AdStatusRemoved {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	}
+
+	postcode := c.Query("postcode")
+	options := make([]gin.H, 0, len(models.DeliveryMethods))
+	for _, method := range adDeliveryMethods(ad) {
+		option := gin.H{"method": method}
+		delivery, err := services.QuoteDelivery(ad, method, postcode)
+		if err != nil {
+			status, message := deliveryError(err)
+			if status == http.StatusBadGateway {
+				log.Printf("Failed to quote %s delivery of ad %d: %v", method, ad.ID, err)
+			}
+			option["available"] = false
+			option["reason"] = message
+		} else {
+			option["available"] = true
+			option["cost"] = delivery.Cost
+			option["total"] = ad.Price + delivery.Cost
+		}
+		options = append(options, option)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ad_id": ad.ID, "options": options})
+}
@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type favoriteAlertsInput struct {
+	Alerts *bool `json:"alerts"`
+}
+
+func serializeFavorite(favorite models.Favorite) gin.H {
+	return gin.H{
+		"ad":         serializeAdSummary(favorite.Ad),
+		"alerts":     favorite.AlertsEnabled,
+		"created_at": favorite.CreatedAt,
+	}
+}
+
+// AddFavorite bookmarks an ad, with alerts enabled unless the request turns them off
+func AddFavorite(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	adID, err := strconv.Atoi(c.Param("adID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid adID"})
+		return
+	}
+
+	// The body is optional
+	var input favoriteAlertsInput
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var ad models.Ad
+	if err := initializers.DB.First(&ad, adID).Error; err != nil || ad.Status == models.AdStatusRemoved || services.HasBlocked(ad.UserID, user.ID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	}
+
+	favorite := models.Favorite{
+		UserID:        user.ID,
+		AdID:          ad.ID,
+		AlertsEnabled: input.Alerts == nil || *input.Alerts,
+	}
+	// Only the request that inserts the favorite counts it, so concurrent requests count once
+	result := initializers.DB.Select("*").Omit("ID", "Ad", "User").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "ad_id"}},
+		DoNothing: true,
+	}).Create(&favorite)
+	if result.Error != nil {
+		log.Printf("Failed to favorite ad %d for user %d: %v", ad.ID, user.ID, result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save favorite"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		existing := initializers.DB.Unscoped().Where("user_id = ? AND ad_id = ?", user.ID, ad.ID)
+		if err := existing.Session(&gorm.Session{}).Model(&models.Favorite{}).Update("alerts_enabled", favorite.AlertsEnabled).Error; err != nil {
+			log.Printf("Failed to update favorite ad %d for user %d: %v", ad.ID, user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save favorite"})
+			return
+		}
+		if err := existing.Session(&gorm.Session{}).First(&favorite).Error; err != nil {
+			log.Printf("Failed to load favorite ad %d for user %d: %v", ad.ID, user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save favorite"})
+			return
+		}
+	} else if ad.UserID != user.ID {
+		services.IncrementAdStat(ad.ID, services.AdStatFavorites)
+	}
+	favorite.Ad = ad
+
+	c.JSON(http.StatusOK, gin.H{"favorite": serializeFavorite(favorite)})
+}
+
+func RemoveFavorite(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	adID, err := strconv.Atoi(c.Param("adID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid adID"})
+		return
+	}
+
+	if err := initializers.DB.Unscoped().Where("user_id = ? AND ad_id = ?", user.ID, adID).Delete(&models.Favorite{}).Error; err != nil {
+		log.Printf("Failed to remove favorite ad %d for user %d: %v", adID, user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove favorite"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Favorite removed"})
+}
+
+func ListFavorites(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	page, limit, offset := pagination(c)
+
+	var favorites []models.Favorite
+	if err := initializers.DB.Preload("Ad").
+		Where("user_id = ?", user.ID).
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&favorites).Error; err != nil {
+		log.Printf("Failed to list favorites of user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve favorites"})
+		return
+	}
+
+	// Ads of sellers who blocked the user are left out
+	var blockers []uint
+	if err := initializers.DB.Model(&models.UserBlock{}).Where("blocked_id = ?", user.ID).Pluck("blocker_id", &blockers).Error; err != nil {
+		log.Printf("Failed to load blocks of user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve favorites"})
+		return
+	}
+	blockedBy := map[uint]bool{}
+	for _, blocker := range blockers {
+		blockedBy[blocker] = true
+	}
+
+	items := make([]gin.H, 0, len(favorites))
+	for _, favorite := range favorites {
+		if favorite.Ad.Status == models.AdStatusRemoved || blockedBy[favorite.Ad.UserID] {
+			continue
+		}
+		items = append(items, serializeFavorite(favorite))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"favorites": items,
+		"page":      page,
+		"limit":     limit,
+	})
+}
+
+// UpdateFavoriteAlerts opts in or out of the alerts of a single favorite
+func UpdateFavoriteAlerts(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	adID, err := strconv.Atoi(c.Param("adID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid adID"})
+		return
+	}
+
+	var input favoriteAlertsInput
+	if err := c.ShouldBindJSON(&input); err != nil || input.Alerts == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "alerts is required"})
+		return
+	}
+
+	result := initializers.DB.Model(&models.Favorite{}).
+		Where("user_id = ? AND ad_id = ?", user.ID, adID).
+		Update("alerts_enabled", *input.Alerts)
+	if result.Error != nil {
+		log.Printf("Failed to update favorite ad %d for user %d: %v", adID, user.ID, result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update favorite"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Favorite not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ad_id": adID, "alerts": *input.Alerts})
+}
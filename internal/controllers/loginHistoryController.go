@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func ListLoginHistory(c *gin.Context) {
+	// Get authenticated user
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	page, limit, offset := pagination(c)
+
+	// Count total entries for pagination
+	var total int64
+	if err := initializers.DB.Model(&models.LoginHistory{}).Where("user_id = ?", user.ID).Count(&total).Error; err != nil {
+		log.Printf("Failed to count login history: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve login history"})
+		return
+	}
+
+	// Fetch most recent entries first
+	var entries []models.LoginHistory
+	if err := initializers.DB.Where("user_id = ?", user.ID).
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&entries).Error; err != nil {
+		log.Printf("Failed to get login history: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve login history"})
+		return
+	}
+
+	history := make([]gin.H, 0, len(entries))
+	for _, entry := range entries {
+		history = append(history, gin.H{
+			"success":        entry.Success,
+			"failure_reason": entry.FailureReason,
+			"ip":             entry.IP,
+			"device":         entry.Device,
+			"browser":        entry.Browser,
+			"os":             entry.OS,
+			"country":        entry.Country,
+			"city":           entry.City,
+			"created_at":     entry.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"history": history,
+		"page":    page,
+		"limit":   limit,
+		"total":   total,
+	})
+}
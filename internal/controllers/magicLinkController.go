@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	magicLinkExpiry        = 15 * time.Minute // Lifetime of a magic login link
+	magicLinkRateLimit     = 3                // Maximum links sent per email within the rate window
+	magicLinkRateWindow    = 15 * time.Minute // Rate limit window per email
+	magicLinkBindingCookie = "magic_link_binding"
+)
+
+/*
+MagicLinkData is stored in Redis under the hash of a magic link token.
+BindingHash ties the link to the browser that requested it.
+*/
+type MagicLinkData struct {
+	UserID      uint      `json:"user_id"`
+	BindingHash string    `json:"binding_hash"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// consumeMagicLinkScript deletes a magic link only if it still holds the data that was checked, so it is used once
+var consumeMagicLinkScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// magicLinkPage asks for a click before consuming the link, so email scanners and prefetchers opening it don't use it up
+var magicLinkPage = template.Must(template.New("magic-link").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Sign in to Grabit</title></head>
+<body>
+<form method="post" action="/auth/magic-link/consume">
+<input type="hidden" name="token" value="{{.}}">
+<button type="submit">Sign in to Grabit</button>
+</form>
+</body>
+</html>
+`))
+
+func getMagicLinkKey(tokenHash string) string {
+	// Generate a key for storing magic link tokens in Redis
+	return fmt.Sprintf("magic_link:%s", tokenHash)
+}
+
+func getMagicLinkRateKey(email string) string {
+	// Generate a key for rate limiting magic links per email
+	return services.MagicLinkRateKey(email)
+}
+
+func generateRandomToken(size int) (string, error) {
+	// Generate a URL-safe random token
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func RequestMagicLink(c *gin.Context) {
+	var body struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	// Bind request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+
+	// Rate limit per email address
+	rateKey := getMagicLinkRateKey(body.Email)
+	pipe := initializers.RedisClient.TxPipeline()
+	count := pipe.Incr(ctx, rateKey)
+	pipe.ExpireNX(ctx, rateKey, magicLinkRateWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Redis error in RequestMagicLink: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send login link"})
+		return
+	}
+	if count.Val() > magicLinkRateLimit {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many login links requested, please try again later"})
+		return
+	}
+
+	// Generic response so the endpoint can't be used to discover accounts
+	response := gin.H{"message": "If an account exists for this email, a login link has been sent"}
+
+	// The browser binding nonce is issued for unknown emails too, its cookie would otherwise reveal accounts
+	binding, err := generateRandomToken(32)
+	if err != nil {
+		log.Printf("Failed to generate magic link binding: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send login link"})
+		return
+	}
+
+	// Bind the link to this browser. Lax so the cookie is sent when following the link from an email
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(
+		magicLinkBindingCookie,
+		binding,
+		int(magicLinkExpiry.Seconds()),
+		"/auth/magic-link",
+		"",
+		true,
+		true,
+	)
+
+	// Find user by email
+	var user models.User
+	if err := initializers.DB.First(&user, "email = ?", body.Email).Error; err != nil {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	// Generate the link token
+	token, err := generateRandomToken(32)
+	if err != nil {
+		log.Printf("Failed to generate magic link token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send login link"})
+		return
+	}
+
+	linkJSON, err := json.Marshal(MagicLinkData{
+		UserID:      user.ID,
+		BindingHash: generateTokenHash(binding),
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		log.Printf("Error marshaling magic link data: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send login link"})
+		return
+	}
+
+	// Store only the token hash in Redis
+	if err := initializers.RedisClient.Set(ctx, getMagicLinkKey(generateTokenHash(token)), linkJSON, magicLinkExpiry).Err(); err != nil {
+		log.Printf("Failed to store magic link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send login link"})
+		return
+	}
+
+	link := fmt.Sprintf("%s/auth/magic-link/consume?token=%s", os.Getenv("APP_BASE_URL"), url.QueryEscape(token))
+	services.SendEmailAsync(user.Email, "Your Grabit login link", services.EmailBody(
+		fmt.Sprintf("Hi %s,", user.FirstName),
+		"",
+		fmt.Sprintf("Use the link below to sign in. It expires in %d minutes and can only be used once, from the browser where you requested it.", int(magicLinkExpiry.Minutes())),
+		"",
+		link,
+		"",
+		"If you didn't request this, you can ignore this email.",
+	))
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ShowMagicLink serves the page the emailed link opens, which signs in by posting the token to ConsumeMagicLink
+func ShowMagicLink(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing token"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := magicLinkPage.Execute(c.Writer, token); err != nil {
+		log.Printf("Failed to render magic link page: %v", err)
+	}
+}
+
+func ConsumeMagicLink(c *gin.Context) {
+	token := c.PostForm("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing token"})
+		return
+	}
+
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+
+	// The link is only used up once the browser binding matched, so opening it elsewhere doesn't burn it
+	key := getMagicLinkKey(generateTokenHash(token))
+	linkJSON, err := initializers.RedisClient.Get(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login link"})
+			return
+		}
+		log.Printf("Redis error in ConsumeMagicLink: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate login link"})
+		return
+	}
+
+	var link MagicLinkData
+	if err := json.Unmarshal([]byte(linkJSON), &link); err != nil {
+		log.Printf("Error unmarshaling magic link data: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid login link data"})
+		return
+	}
+
+	// Check the link is used from the browser that requested it
+	binding, err := c.Cookie(magicLinkBindingCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(generateTokenHash(binding)), []byte(link.BindingHash)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login link must be opened in the browser that requested it"})
+		return
+	}
+
+	// Compare-and-delete makes the link single-use even under concurrent requests
+	deleted, err := consumeMagicLinkScript.Run(ctx, initializers.RedisClient, []string{key}, linkJSON).Int()
+	if err != nil {
+		log.Printf("Redis error in ConsumeMagicLink: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate login link"})
+		return
+	}
+	if deleted == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login link"})
+		return
+	}
+
+	// Clear binding cookie
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(magicLinkBindingCookie, "", -1, "/auth/magic-link", "", true, true)
+
+	// Get fresh user data from database
+	var user models.User
+	if err := initializers.DB.First(&user, link.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Create the same session as Signin
+	tokenString, ok := startSession(c, user)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token": tokenString,
+		"user": gin.H{
+			"id":        user.ID,
+			"username":  user.Username,
+			"email":     user.Email,
+			"firstName": user.FirstName,
+			"lastName":  user.LastName,
+		},
+	})
+}
@@ -0,0 +1,434 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxMessageLength     = 2000 // Maximum characters per message
+	messagePreviewLength = 100  // Characters of the last message shown in the inbox
+)
+
+type messageInput struct {
+	Body string `json:"body" binding:"required"`
+}
+
+// validateMessageBody trims a message and checks its length
+func validateMessageBody(c *gin.Context, body string) (string, bool) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Message can't be empty"})
+		return "", false
+	}
+	if utf8.RuneCountInString(body) > maxMessageLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Message must be at most 2000 characters"})
+		return "", false
+	}
+	return body, true
+}
+
+func serializeMessage(message models.Message) gin.H {
+	body := message.Body
+	if message.HiddenAt != nil {
+		body = "" // Removed by a moderator
+	}
+	return gin.H{
+		"id":              message.ID,
+		"conversation_id": message.ConversationID,
+		"sender_id":       message.SenderID,
+		"body":            body,
+		"hidden":          message.HiddenAt != nil,
+		"read_at":         message.ReadAt,
+		"created_at":      message.CreatedAt,
+	}
+}
+
+// loadConversation finds a conversation the user takes part in
+func loadConversation(c *gin.Context, userID uint) (models.Conversation, bool) {
+	conversationID, err := strconv.Atoi(c.Param("conversationID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversationID"})
+		return models.Conversation{}, false
+	}
+
+	var conversation models.Conversation
+	if err := initializers.DB.First(&conversation, conversationID).Error; err != nil || !conversation.HasParticipant(userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return models.Conversation{}, false
+	}
+	return conversation, true
+}
+
+// appendMessage stores a message and bumps the conversation in both inboxes
+func appendMessage(tx *gorm.DB, conversation *models.Conversation, senderID uint, body string) (models.Message, error) {
+	message := models.Message{
+		ConversationID: conversation.ID,
+		SenderID:       senderID,
+		Body:           body,
+	}
+	if err := tx.Create(&message).Error; err != nil {
+		return message, err
+	}
+
+	conversation.LastMessageAt = message.CreatedAt
+	err := tx.Model(conversation).Update("last_message_at", message.CreatedAt).Error
+	return message, err
+}
+
+// publishToParticipants delivers a real-time event to the buyer and seller of a conversation
+func publishToParticipants(conversation models.Conversation, eventType string, data interface{}) {
+	services.PublishEvent(conversation.BuyerID, eventType, data, true)
+	services.PublishEvent(conversation.SellerID, eventType, data, true)
+}
+
+// markConversationRead marks messages from the other party as read and notifies both participants
+func markConversationRead(conversation models.Conversation, readerID, upToMessageID uint) (int64, error) {
+	query := initializers.DB.Model(&models.Message{}).
+		Where("conversation_id = ? AND sender_id <> ? AND read_at IS NULL", conversation.ID, readerID)
+	if upToMessageID != 0 {
+		query = query.Where("id <= ?", upToMessageID)
+	}
+
+	readAt := time.Now()
+	result := query.Update("read_at", readAt)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.RowsAffected, result.Error
+	}
+
+	publishToParticipants(conversation, services.EventMessageRead, gin.H{
+		"conversation_id":  conversation.ID,
+		"reader_id":        readerID,
+		"up_to_message_id": upToMessageID,
+		"read_at":          readAt,
+	})
+	return result.RowsAffected, nil
+}
+
+func StartConversation(c *gin.Context) {
+	buyer, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	adID, err := strconv.Atoi(c.Param("adID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid adID"})
+		return
+	}
+
+	var input messageInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	body, ok := validateMessageBody(c, input.Body)
+	if !ok {
+		return
+	}
+
+	var ad models.Ad
+	if err := initializers.DB.First(&ad, adID).Error; err != nil || ad.Status == models.AdStatusRemoved {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	}
+
+	// Sellers can't message their own ads
+	if ad.UserID == buyer.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't message your own ad"})
+		return
+	}
+	if ad.Status == models.AdStatusSold {
+		c.JSON(http.StatusConflict, gin.H{"error": "This item has already been sold"})
+		return
+	}
+	if !services.PrivacyFor(ad.UserID).AllowMessages {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This seller doesn't accept messages"})
+		return
+	}
+	if !requireNotBlocked(c, buyer.ID, ad.UserID) {
+		return
+	}
+
+	// Reuse the existing conversation for this ad and buyer
+	var conversation models.Conversation
+	var message models.Message
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		conversation = models.Conversation{AdID: ad.ID, BuyerID: buyer.ID, SellerID: ad.UserID, LastMessageAt: time.Now()}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&conversation).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("ad_id = ? AND buyer_id = ?", ad.ID, buyer.ID).First(&conversation).Error; err != nil {
+			return err
+		}
+
+		var err error
+		message, err = appendMessage(tx, &conversation, buyer.ID, body)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to start conversation on ad %d: %v", ad.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
+		return
+	}
+
+	publishToParticipants(conversation, services.EventMessageNew, serializeMessage(message))
+	services.IncrementAdStat(conversation.AdID, services.AdStatMessages)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"conversation_id": conversation.ID,
+		"message":         serializeMessage(message),
+	})
+}
+
+func SendMessage(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	conversation, ok := loadConversation(c, user.ID)
+	if !ok {
+		return
+	}
+
+	var input messageInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	body, ok := validateMessageBody(c, input.Body)
+	if !ok {
+		return
+	}
+
+	if !requireNotBlocked(c, user.ID, conversation.OtherParty(user.ID)) {
+		return
+	}
+
+	var message models.Message
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		message, err = appendMessage(tx, &conversation, user.ID, body)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to send message in conversation %d: %v", conversation.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
+		return
+	}
+
+	publishToParticipants(conversation, services.EventMessageNew, serializeMessage(message))
+	if user.ID == conversation.BuyerID {
+		services.IncrementAdStat(conversation.AdID, services.AdStatMessages)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": serializeMessage(message)})
+}
+
+func ListConversations(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	page, limit, offset := pagination(c)
+
+	// Count total conversations for pagination
+	var total int64
+	if err := initializers.DB.Model(&models.Conversation{}).
+		Where("buyer_id = ? OR seller_id = ?", user.ID, user.ID).
+		Count(&total).Error; err != nil {
+		log.Printf("Failed to count conversations for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve conversations"})
+		return
+	}
+
+	var conversations []models.Conversation
+	if err := initializers.DB.
+		Preload("Ad").
+		Preload("Buyer", func(db *gorm.DB) *gorm.DB { return db.Select("id, username, profile_picture_url, profile_picture_key") }).
+		Preload("Seller", func(db *gorm.DB) *gorm.DB { return db.Select("id, username, profile_picture_url, profile_picture_key") }).
+		Where("buyer_id = ? OR seller_id = ?", user.ID, user.ID).
+		Order("last_message_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&conversations).Error; err != nil {
+		log.Printf("Failed to list conversations for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve conversations"})
+		return
+	}
+
+	conversationIDs := make([]uint, 0, len(conversations))
+	for _, conversation := range conversations {
+		conversationIDs = append(conversationIDs, conversation.ID)
+	}
+
+	// Latest message per conversation
+	lastMessages := map[uint]models.Message{}
+	if len(conversationIDs) > 0 {
+		var messages []models.Message
+		if err := initializers.DB.Raw(`SELECT DISTINCT ON (conversation_id) * FROM messages
+			WHERE conversation_id IN ? AND deleted_at IS NULL
+			ORDER BY conversation_id, created_at DESC`, conversationIDs).
+			Scan(&messages).Error; err != nil {
+			log.Printf("Failed to load last messages: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve conversations"})
+			return
+		}
+		for _, message := range messages {
+			lastMessages[message.ConversationID] = message
+		}
+	}
+
+	// Unread messages sent by the other party
+	unreadCounts := map[uint]int64{}
+	if len(conversationIDs) > 0 {
+		var counts []struct {
+			ConversationID uint
+			Count          int64
+		}
+		if err := initializers.DB.Model(&models.Message{}).
+			Select("conversation_id, COUNT(*) AS count").
+			Where("conversation_id IN ? AND sender_id <> ? AND read_at IS NULL", conversationIDs, user.ID).
+			Group("conversation_id").
+			Scan(&counts).Error; err != nil {
+			log.Printf("Failed to count unread messages: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve conversations"})
+			return
+		}
+		for _, count := range counts {
+			unreadCounts[count.ConversationID] = count.Count
+		}
+	}
+
+	inbox := make([]gin.H, 0, len(conversations))
+	for _, conversation := range conversations {
+		role, other := "seller", conversation.Buyer
+		if conversation.BuyerID == user.ID {
+			role, other = "buyer", conversation.Seller
+		}
+		otherImage, _ := avatarURLs(other)
+
+		var lastMessage gin.H
+		if message, found := lastMessages[conversation.ID]; found {
+			preview := []rune(message.Body)
+			if message.HiddenAt != nil {
+				preview = nil
+			}
+			if len(preview) > messagePreviewLength {
+				preview = append(preview[:messagePreviewLength], '…')
+			}
+			lastMessage = gin.H{
+				"sender_id":  message.SenderID,
+				"preview":    string(preview),
+				"created_at": message.CreatedAt,
+			}
+		}
+
+		inbox = append(inbox, gin.H{
+			"id":              conversation.ID,
+			"ad":              serializeAdSummary(conversation.Ad),
+			"role":            role,
+			"other_user":      gin.H{"id": other.ID, "username": other.Username, "profile_image": otherImage},
+			"last_message":    lastMessage,
+			"unread_count":    unreadCounts[conversation.ID],
+			"last_message_at": conversation.LastMessageAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"conversations": inbox,
+		"page":          page,
+		"limit":         limit,
+		"total":         total,
+	})
+}
+
+func ListMessages(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	conversation, ok := loadConversation(c, user.ID)
+	if !ok {
+		return
+	}
+
+	page, limit, offset := pagination(c)
+
+	// Newest first, clients reverse for display
+	var messages []models.Message
+	if err := initializers.DB.Where("conversation_id = ?", conversation.ID).
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&messages).Error; err != nil {
+		log.Printf("Failed to list messages of conversation %d: %v", conversation.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
+		return
+	}
+
+	items := make([]gin.H, 0, len(messages))
+	for _, message := range messages {
+		items = append(items, serializeMessage(message))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"messages": items,
+		"page":     page,
+		"limit":    limit,
+	})
+}
+
+func MarkConversationRead(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	conversation, ok := loadConversation(c, user.ID)
+	if !ok {
+		return
+	}
+
+	// Optionally only up to a given message, for clients that track what was displayed
+	var body struct {
+		UpToMessageID uint `json:"up_to_message_id"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := markConversationRead(conversation, user.ID, body.UpToMessageID)
+	if err != nil {
+		log.Printf("Failed to mark conversation %d as read: %v", conversation.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark messages as read"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Messages marked as read",
+		"updated_count": updated,
+	})
+}
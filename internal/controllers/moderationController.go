@@ -0,0 +1,376 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type moderationInput struct {
+	Notes  string `json:"notes"`
+	Reason string `json:"reason"` // Shown to suspended users
+}
+
+func serializeModerationCase(moderationCase models.ModerationCase) gin.H {
+	return gin.H{
+		"id":             moderationCase.ID,
+		"target_type":    moderationCase.TargetType,
+		"target_id":      moderationCase.TargetID,
+		"status":         moderationCase.Status,
+		"priority":       moderationCase.Priority,
+		"report_count":   moderationCase.ReportCount,
+		"claimed_by_id":  moderationCase.ClaimedByID,
+		"claimed_at":     moderationCase.ClaimedAt,
+		"resolved_by_id": moderationCase.ResolvedByID,
+		"resolved_at":    moderationCase.ResolvedAt,
+		"action":         moderationCase.Action,
+		"notes":          moderationCase.Notes,
+		"created_at":     moderationCase.CreatedAt,
+		"updated_at":     moderationCase.UpdatedAt,
+	}
+}
+
+// loadModerationCase finds a case by the :caseID route parameter
+func loadModerationCase(c *gin.Context) (models.ModerationCase, bool) {
+	caseID, err := strconv.Atoi(c.Param("caseID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid caseID"})
+		return models.ModerationCase{}, false
+	}
+
+	var moderationCase models.ModerationCase
+	if err := initializers.DB.First(&moderationCase, caseID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Case not found"})
+		return models.ModerationCase{}, false
+	}
+	return moderationCase, true
+}
+
+// loadActionableCase loads a case the moderator can act on: open, or claimed by themselves
+func loadActionableCase(c *gin.Context, moderatorID uint) (models.ModerationCase, moderationInput, bool) {
+	var input moderationInput
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return models.ModerationCase{}, input, false
+	}
+	input.Notes = strings.TrimSpace(input.Notes)
+	input.Reason = strings.TrimSpace(input.Reason)
+
+	moderationCase, ok := loadModerationCase(c)
+	if !ok {
+		return moderationCase, input, false
+	}
+	if !caseActionable(moderationCase, moderatorID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Case is closed or claimed by another moderator"})
+		return moderationCase, input, false
+	}
+	return moderationCase, input, true
+}
+
+func caseActionable(moderationCase models.ModerationCase, moderatorID uint) bool {
+	switch moderationCase.Status {
+	case models.CaseStatusOpen:
+		return true
+	case models.CaseStatusClaimed:
+		return moderationCase.ClaimedByID != nil && *moderationCase.ClaimedByID == moderatorID
+	}
+	return false
+}
+
+// closeModerationCase resolves or dismisses a case and records the action in the audit log
+func closeModerationCase(c *gin.Context, moderationCase *models.ModerationCase, moderatorID uint, status, action, notes string) {
+	now := time.Now()
+	result := initializers.DB.Model(moderationCase).
+		Where("status = ? OR (status = ? AND claimed_by_id = ?)", models.CaseStatusOpen, models.CaseStatusClaimed, moderatorID).
+		Updates(map[string]interface{}{
+			"status":         status,
+			"action":         action,
+			"notes":          notes,
+			"resolved_by_id": moderatorID,
+			"resolved_at":    now,
+		})
+	if result.Error != nil {
+		log.Printf("Failed to close moderation case %d: %v", moderationCase.ID, result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update case"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Case is closed or claimed by another moderator"})
+		return
+	}
+	moderationCase.Status = status
+	moderationCase.Action = action
+	moderationCase.Notes = notes
+	moderationCase.ResolvedByID = &moderatorID
+	moderationCase.ResolvedAt = &now
+
+	auditAction := services.AuditCaseResolved
+	if status == models.CaseStatusDismissed {
+		auditAction = services.AuditCaseDismissed
+	}
+	services.Audit(auditAction, &moderatorID, "moderation_case", moderationCase.ID, map[string]interface{}{
+		"target_type": moderationCase.TargetType,
+		"target_id":   moderationCase.TargetID,
+		"action":      action,
+		"notes":       notes,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"case": serializeModerationCase(*moderationCase)})
+}
+
+// ListModerationCases returns the queue, highest priority first. Defaults to open and claimed cases
+func ListModerationCases(c *gin.Context) {
+	statuses := []string{models.CaseStatusOpen, models.CaseStatusClaimed}
+	if status := c.Query("status"); status != "" {
+		statuses = strings.Split(status, ",")
+		for _, status := range statuses {
+			if !models.IsCaseStatus(status) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status", "allowed": models.CaseStatuses})
+				return
+			}
+		}
+	}
+
+	query := initializers.DB.Model(&models.ModerationCase{}).Where("status IN ?", statuses)
+	switch targetType := c.Query("target_type"); targetType {
+	case "":
+	case models.ReportTargetAd, models.ReportTargetUser, models.ReportTargetMessage:
+		query = query.Where("target_type = ?", targetType)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "target_type must be ad, user or message"})
+		return
+	}
+
+	page, limit, offset := pagination(c)
+
+	// Count total cases for pagination
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		log.Printf("Failed to count moderation cases: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve cases"})
+		return
+	}
+
+	var cases []models.ModerationCase
+	if err := query.Order("priority DESC, created_at").Limit(limit).Offset(offset).Find(&cases).Error; err != nil {
+		log.Printf("Failed to list moderation cases: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve cases"})
+		return
+	}
+
+	items := make([]gin.H, 0, len(cases))
+	for _, moderationCase := range cases {
+		items = append(items, serializeModerationCase(moderationCase))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"cases": items,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+// GetModerationCase returns a case with its reports and the user responsible for the target
+func GetModerationCase(c *gin.Context) {
+	moderationCase, ok := loadModerationCase(c)
+	if !ok {
+		return
+	}
+
+	var reports []models.Report
+	if err := initializers.DB.Where("case_id = ?", moderationCase.ID).Order("created_at").Find(&reports).Error; err != nil {
+		log.Printf("Failed to load reports of case %d: %v", moderationCase.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve case"})
+		return
+	}
+
+	items := make([]gin.H, 0, len(reports))
+	for _, report := range reports {
+		items = append(items, gin.H{
+			"id":          report.ID,
+			"reporter_id": report.ReporterID,
+			"reason_code": report.ReasonCode,
+			"details":     report.Details,
+			"created_at":  report.CreatedAt,
+		})
+	}
+
+	data := serializeModerationCase(moderationCase)
+	data["reports"] = items
+	if ownerID, err := services.ReportTargetOwner(moderationCase.TargetType, moderationCase.TargetID); err == nil {
+		data["target_owner_id"] = ownerID
+	}
+
+	c.JSON(http.StatusOK, gin.H{"case": data})
+}
+
+func ClaimModerationCase(c *gin.Context) {
+	moderator, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	moderationCase, ok := loadModerationCase(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	result := initializers.DB.Model(&moderationCase).
+		Where("status = ?", models.CaseStatusOpen).
+		Updates(map[string]interface{}{
+			"status":        models.CaseStatusClaimed,
+			"claimed_by_id": moderator.ID,
+			"claimed_at":    now,
+		})
+	if result.Error != nil {
+		log.Printf("Failed to claim moderation case %d: %v", moderationCase.ID, result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim case"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Case is not open"})
+		return
+	}
+	moderationCase.Status = models.CaseStatusClaimed
+	moderationCase.ClaimedByID = &moderator.ID
+	moderationCase.ClaimedAt = &now
+
+	services.Audit(services.AuditCaseClaimed, &moderator.ID, "moderation_case", moderationCase.ID, nil)
+
+	c.JSON(http.StatusOK, gin.H{"case": serializeModerationCase(moderationCase)})
+}
+
+// ResolveModerationCase closes a case without acting on the target
+func ResolveModerationCase(c *gin.Context) {
+	moderator, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	moderationCase, input, ok := loadActionableCase(c, moderator.ID)
+	if !ok {
+		return
+	}
+	closeModerationCase(c, &moderationCase, moderator.ID, models.CaseStatusResolved, models.CaseActionNone, input.Notes)
+}
+
+// DismissModerationCase closes a case whose reports turned out to be unfounded
+func DismissModerationCase(c *gin.Context) {
+	moderator, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	moderationCase, input, ok := loadActionableCase(c, moderator.ID)
+	if !ok {
+		return
+	}
+	closeModerationCase(c, &moderationCase, moderator.ID, models.CaseStatusDismissed, models.CaseActionNone, input.Notes)
+}
+
+// HideModerationCaseContent removes the reported ad or message and resolves the case
+func HideModerationCaseContent(c *gin.Context) {
+	moderator, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	moderationCase, input, ok := loadActionableCase(c, moderator.ID)
+	if !ok {
+		return
+	}
+	if moderationCase.TargetType == models.ReportTargetUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Users can't be hidden, suspend them instead"})
+		return
+	}
+
+	if err := services.HideReportTarget(moderationCase.TargetType, moderationCase.TargetID, moderator.ID); err != nil {
+		log.Printf("Failed to hide %s %d: %v", moderationCase.TargetType, moderationCase.TargetID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hide content"})
+		return
+	}
+	closeModerationCase(c, &moderationCase, moderator.ID, models.CaseStatusResolved, models.CaseActionHidden, input.Notes)
+}
+
+// SuspendModerationCaseUser suspends the user responsible for the reported target and resolves the case
+func SuspendModerationCaseUser(c *gin.Context) {
+	moderator, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	moderationCase, input, ok := loadActionableCase(c, moderator.ID)
+	if !ok {
+		return
+	}
+	if input.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A suspension reason is required"})
+		return
+	}
+
+	ownerID, err := services.ReportTargetOwner(moderationCase.TargetType, moderationCase.TargetID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "The reported content no longer exists"})
+			return
+		}
+		log.Printf("Failed to find owner of %s %d: %v", moderationCase.TargetType, moderationCase.TargetID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to suspend user"})
+		return
+	}
+	if ownerID == moderator.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't suspend yourself"})
+		return
+	}
+
+	if err := services.SuspendUser(ownerID, input.Reason, moderator.ID); err != nil {
+		log.Printf("Failed to suspend user %d: %v", ownerID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to suspend user"})
+		return
+	}
+	closeModerationCase(c, &moderationCase, moderator.ID, models.CaseStatusResolved, models.CaseActionSuspend, input.Notes)
+}
+
+// UnsuspendUser lets a moderator lift the suspension of an account
+func UnsuspendUser(c *gin.Context) {
+	moderator, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+
+	if err := services.UnsuspendUser(uint(userID), moderator.ID); err != nil {
+		if errors.Is(err, services.ErrNotSuspended) {
+			c.JSON(http.StatusConflict, gin.H{"error": "This user isn't suspended"})
+			return
+		}
+		log.Printf("Failed to unsuspend user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unsuspend user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "The suspension was lifted"})
+}
@@ -0,0 +1,645 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxOfferAmount = 100_000_000 // Maximum offer in pence
+
+var (
+	errOfferNotPending = errors.New("offer is no longer pending")
+	errAdUnavailable   = errors.New("ad is no longer available")
+)
+
+type offerInput struct {
+	Amount int64 `json:"amount" binding:"required"` // In pence, for the item alone
+	deliveryInput
+}
+
+// offerExpiry reads OFFER_EXPIRY_HOURS, defaulting to 48 hours
+func offerExpiry() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("OFFER_EXPIRY_HOURS"))
+	if err != nil || hours < 1 {
+		hours = 48
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// reservationPeriod reads RESERVATION_HOURS, defaulting to 72 hours
+func reservationPeriod() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("RESERVATION_HOURS"))
+	if err != nil || hours < 1 {
+		hours = 72
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// formatPence formats an amount in pence for emails
+func formatPence(amount int64) string {
+	return fmt.Sprintf("£%d.%02d", amount/100, amount%100)
+}
+
+func serializeOffer(offer models.Offer) gin.H {
+	return gin.H(services.OfferData(offer))
+}
+
+// bindOffer reads an offer or counter-offer and validates its amount
+func bindOffer(c *gin.Context) (offerInput, bool) {
+	var input offerInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return input, false
+	}
+	if input.Amount < 1 || input.Amount > maxOfferAmount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be between 1 and 100000000 pence"})
+		return input, false
+	}
+	return input, true
+}
+
+// loadOffer finds an offer the user is the buyer or seller of
+func loadOffer(c *gin.Context, userID uint) (models.Offer, bool) {
+	offerID, err := strconv.Atoi(c.Param("offerID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offerID"})
+		return models.Offer{}, false
+	}
+
+	var offer models.Offer
+	if err := initializers.DB.First(&offer, offerID).Error; err != nil || (offer.BuyerID != userID && offer.SellerID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Offer not found"})
+		return models.Offer{}, false
+	}
+	return offer, true
+}
+
+// transitionOffer moves a pending offer to status, failing if it expired or another request answered it first
+func transitionOffer(tx *gorm.DB, offer *models.Offer, status string) error {
+	if !offer.CanTransitionTo(status) {
+		return errOfferNotPending
+	}
+
+	now := time.Now()
+	result := tx.Model(offer).
+		Where("status = ? AND expires_at > ?", models.OfferStatusPending, now).
+		Updates(map[string]interface{}{"status": status, "responded_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errOfferNotPending
+	}
+
+	offer.Status = status
+	offer.RespondedAt = &now
+	return nil
+}
+
+// respondOfferError reports the failure of an offer transition
+func respondOfferError(c *gin.Context, offer models.Offer, err error) {
+	switch {
+	case errors.Is(err, errOfferNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": "This offer is no longer pending"})
+	case errors.Is(err, errAdUnavailable):
+		c.JSON(http.StatusConflict, gin.H{"error": "This item is no longer available"})
+	case errors.Is(err, services.ErrReservationPaid):
+		c.JSON(http.StatusConflict, gin.H{"error": "This item was paid for through checkout, the sale completes with its order"})
+	default:
+		log.Printf("Failed to update offer %d: %v", offer.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update offer"})
+	}
+}
+
+func MakeOffer(c *gin.Context) {
+	buyer, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	adID, err := strconv.Atoi(c.Param("adID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid adID"})
+		return
+	}
+
+	input, ok := bindOffer(c)
+	if !ok {
+		return
+	}
+
+	var ad models.Ad
+	if err := initializers.DB.First(&ad, adID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	}
+	if ad.UserID == buyer.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't make an offer on your own ad"})
+		return
+	}
+	if ad.Status != models.AdStatusActive {
+		c.JSON(http.StatusConflict, gin.H{"error": "This item is no longer available"})
+		return
+	}
+	if !requireNotBlocked(c, buyer.ID, ad.UserID) {
+		return
+	}
+	delivery, ok := quoteDelivery(c, ad, input.deliveryInput)
+	if !ok {
+		return
+	}
+
+	// An expired offer shouldn't keep the buyer from making a new one
+	if _, err := services.ExpirePendingOffers(func(db *gorm.DB) *gorm.DB {
+		return db.Where("ad_id = ? AND buyer_id = ?", ad.ID, buyer.ID)
+	}); err != nil {
+		log.Printf("Failed to expire offers on ad %d: %v", ad.ID, err)
+	}
+
+	offer := models.Offer{
+		AdID:       ad.ID,
+		BuyerID:    buyer.ID,
+		SellerID:   ad.UserID,
+		ProposerID: buyer.ID,
+		Amount:     input.Amount,
+		Status:     models.OfferStatusPending,
+		ExpiresAt:  time.Now().Add(offerExpiry()),
+
+		DeliveryMethod:   delivery.Method,
+		DeliveryPostcode: delivery.Postcode,
+		DeliveryCost:     delivery.Cost,
+	}
+	result := initializers.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&offer)
+	if result.Error != nil {
+		log.Printf("Failed to create offer on ad %d: %v", ad.ID, result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to make offer"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already have a pending offer on this ad"})
+		return
+	}
+
+	services.PublishOfferEvent(services.EventOfferNew, offer)
+
+	c.JSON(http.StatusCreated, gin.H{"offer": serializeOffer(offer)})
+}
+
+func ListOffers(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	query := initializers.DB.Preload("Ad")
+	switch c.Query("role") {
+	case "buyer":
+		query = query.Where("buyer_id = ?", user.ID)
+	case "seller":
+		query = query.Where("seller_id = ?", user.ID)
+	case "":
+		query = query.Where("(buyer_id = ? OR seller_id = ?)", user.ID, user.ID)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be buyer or seller"})
+		return
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if adID := c.Query("ad_id"); adID != "" {
+		id, err := strconv.Atoi(adID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ad_id"})
+			return
+		}
+		query = query.Where("ad_id = ?", id)
+	}
+
+	page, limit, offset := pagination(c)
+
+	var offers []models.Offer
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&offers).Error; err != nil {
+		log.Printf("Failed to list offers for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve offers"})
+		return
+	}
+
+	items := make([]gin.H, 0, len(offers))
+	for _, offer := range offers {
+		item := serializeOffer(offer)
+		item["ad"] = serializeAdSummary(offer.Ad)
+		items = append(items, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"offers": items,
+		"page":   page,
+		"limit":  limit,
+	})
+}
+
+func GetOffer(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	offer, ok := loadOffer(c, user.ID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"offer": serializeOffer(offer)})
+}
+
+/*
+AcceptOffer lets the recipient of the latest offer accept it, the seller for a buyer's offer or the
+buyer for a seller's counter-offer. Unless the seller sets reserve to false the ad is reserved for
+the buyer until reservationPeriod ends, and the other pending offers on it are rejected.
+*/
+func AcceptOffer(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	offer, ok := loadOffer(c, user.ID)
+	if !ok {
+		return
+	}
+	if offer.Recipient() != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the recipient can accept an offer"})
+		return
+	}
+	if !requireNotBlocked(c, offer.BuyerID, offer.SellerID) {
+		return
+	}
+
+	var body struct {
+		Reserve *bool `json:"reserve"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Only the seller decides whether to hold the item, a buyer accepting a counter-offer always reserves it
+	reserve := body.Reserve == nil || *body.Reserve || user.ID == offer.BuyerID
+	reservedUntil := time.Now().Add(reservationPeriod())
+
+	var declined []models.Offer
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := transitionOffer(tx, &offer, models.OfferStatusAccepted); err != nil {
+			return err
+		}
+
+		// The ad must still be for sale, and becomes reserved for the buyer when asked to
+		var ad models.Ad
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id, status").First(&ad, offer.AdID).Error; err != nil {
+			return err
+		}
+		if ad.Status != models.AdStatusActive {
+			return errAdUnavailable
+		}
+		if !reserve {
+			return nil
+		}
+		if err := tx.Model(&models.Ad{}).Where("id = ?", ad.ID).Updates(map[string]interface{}{
+			"status":            models.AdStatusReserved,
+			"reserved_until":    reservedUntil,
+			"reserved_offer_id": offer.ID,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&declined).
+			Clauses(clause.Returning{}).
+			Where("ad_id = ? AND id <> ? AND status = ?", offer.AdID, offer.ID, models.OfferStatusPending).
+			Updates(map[string]interface{}{
+				"status":       models.OfferStatusRejected,
+				"responded_at": time.Now(),
+			}).Error
+	})
+	if err != nil {
+		respondOfferError(c, offer, err)
+		return
+	}
+
+	services.PublishOfferEvent(services.EventOfferUpdate, offer)
+	for _, other := range declined {
+		services.PublishOfferEvent(services.EventOfferUpdate, other)
+	}
+	notifyOfferAccepted(offer, reserve)
+	response := gin.H{
+		"offer":       serializeOffer(offer),
+		"ad_reserved": reserve,
+	}
+	if reserve {
+		notifyAdStatusChange(offer.AdID, offer.BuyerID)
+		response["reserved_until"] = reservedUntil
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// notifyAdStatusChange alerts the users who favorited an ad that it was reserved or sold
+func notifyAdStatusChange(adID, buyerID uint) {
+	var ad models.Ad
+	if err := initializers.DB.First(&ad, adID).Error; err != nil {
+		log.Printf("Failed to load ad %d for favorite alerts: %v", adID, err)
+		return
+	}
+	services.NotifyAdStatusChange(ad, buyerID)
+}
+
+// notifyOfferAccepted emails the proposer that their offer or counter-offer was accepted
+func notifyOfferAccepted(offer models.Offer, reserved bool) {
+	var proposer models.User
+	var ad models.Ad
+	if err := initializers.DB.First(&proposer, offer.ProposerID).Error; err != nil {
+		log.Printf("Failed to load user %d for offer email: %v", offer.ProposerID, err)
+		return
+	}
+	if err := initializers.DB.First(&ad, offer.AdID).Error; err != nil {
+		log.Printf("Failed to load ad %d for offer email: %v", offer.AdID, err)
+		return
+	}
+
+	accepted := fmt.Sprintf("The seller accepted your offer of %s for \"%s\".", formatPence(offer.Amount), ad.Title)
+	note := "Message the seller to arrange the sale."
+	if reserved {
+		note = "The item is now reserved for you. Message the seller to arrange the sale."
+	}
+	if offer.ProposerID == offer.SellerID {
+		accepted = fmt.Sprintf("The buyer accepted your counter-offer of %s for \"%s\".", formatPence(offer.Amount), ad.Title)
+		note = "The item is now reserved for them. Message the buyer to arrange the sale."
+	}
+	services.SendEmailAsync(proposer.Email, "Your offer was accepted", services.EmailBody(
+		fmt.Sprintf("Hi %s,", proposer.FirstName),
+		"",
+		accepted,
+		"",
+		note,
+	))
+}
+
+func RejectOffer(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	offer, ok := loadOffer(c, user.ID)
+	if !ok {
+		return
+	}
+	if offer.Recipient() != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the recipient can reject an offer"})
+		return
+	}
+
+	if err := transitionOffer(initializers.DB, &offer, models.OfferStatusRejected); err != nil {
+		respondOfferError(c, offer, err)
+		return
+	}
+
+	services.PublishOfferEvent(services.EventOfferUpdate, offer)
+
+	c.JSON(http.StatusOK, gin.H{"offer": serializeOffer(offer)})
+}
+
+func WithdrawOffer(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	offer, ok := loadOffer(c, user.ID)
+	if !ok {
+		return
+	}
+	if offer.ProposerID != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the proposer can withdraw an offer"})
+		return
+	}
+
+	if err := transitionOffer(initializers.DB, &offer, models.OfferStatusWithdrawn); err != nil {
+		respondOfferError(c, offer, err)
+		return
+	}
+
+	services.PublishOfferEvent(services.EventOfferUpdate, offer)
+
+	c.JSON(http.StatusOK, gin.H{"offer": serializeOffer(offer)})
+}
+
+// CounterOffer answers a pending offer with a new amount, the countered offer is replaced by the new one
+func CounterOffer(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	offer, ok := loadOffer(c, user.ID)
+	if !ok {
+		return
+	}
+	if offer.Recipient() != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the recipient can counter an offer"})
+		return
+	}
+
+	input, ok := bindOffer(c)
+	if !ok {
+		return
+	}
+	// The delivery carries over unless the counter-offer changes it
+	delivery := services.Delivery{Method: offer.DeliveryMethod, Postcode: offer.DeliveryPostcode, Cost: offer.DeliveryCost}
+	if input.DeliveryMethod != "" {
+		var ad models.Ad
+		if err := initializers.DB.First(&ad, offer.AdID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+			return
+		}
+		if delivery, ok = quoteDelivery(c, ad, input.deliveryInput); !ok {
+			return
+		}
+	}
+	sameDelivery := delivery.Method == offer.DeliveryMethod && delivery.Postcode == offer.DeliveryPostcode
+
+	// Agreeing with the terms is done by accepting the offer
+	if input.Amount == offer.Amount && sameDelivery {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A counter-offer must change the amount or delivery, accept the offer to agree to it"})
+		return
+	}
+	if !requireNotBlocked(c, offer.BuyerID, offer.SellerID) {
+		return
+	}
+
+	counter := models.Offer{
+		AdID:          offer.AdID,
+		BuyerID:       offer.BuyerID,
+		SellerID:      offer.SellerID,
+		ProposerID:    user.ID,
+		ParentOfferID: &offer.ID,
+		Amount:        input.Amount,
+		Status:        models.OfferStatusPending,
+		ExpiresAt:     time.Now().Add(offerExpiry()),
+
+		DeliveryMethod:   delivery.Method,
+		DeliveryPostcode: delivery.Postcode,
+		DeliveryCost:     delivery.Cost,
+	}
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var ad models.Ad
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id, status").First(&ad, offer.AdID).Error; err != nil {
+			return err
+		}
+		if ad.Status != models.AdStatusActive {
+			return errAdUnavailable
+		}
+
+		if err := transitionOffer(tx, &offer, models.OfferStatusCountered); err != nil {
+			return err
+		}
+		return tx.Create(&counter).Error
+	})
+	if err != nil {
+		respondOfferError(c, offer, err)
+		return
+	}
+
+	services.PublishOfferEvent(services.EventOfferUpdate, offer)
+	services.PublishOfferEvent(services.EventOfferNew, counter)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"offer":           serializeOffer(counter),
+		"countered_offer": serializeOffer(offer),
+	})
+}
+
+// CompleteOffer lets the seller confirm the sale of an accepted offer, marking the ad as sold
+func CompleteOffer(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	offer, ok := loadOffer(c, user.ID)
+	if !ok {
+		return
+	}
+	if offer.SellerID != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the seller can complete a sale"})
+		return
+	}
+	if offer.Status != models.OfferStatusAccepted || offer.CompletedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only accepted offers can be completed"})
+		return
+	}
+
+	now := time.Now()
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var ad models.Ad
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id, status").First(&ad, offer.AdID).Error; err != nil {
+			return err
+		}
+		if ad.Status == models.AdStatusSold {
+			return errAdUnavailable
+		}
+		// Sales paid through checkout complete when their order is released
+		paid, err := services.CountPaidOrders(tx, ad.ID)
+		if err != nil {
+			return err
+		}
+		if paid > 0 {
+			return services.ErrReservationPaid
+		}
+		if err := tx.Model(&models.Ad{}).Where("id = ?", ad.ID).Updates(map[string]interface{}{
+			"status":  models.AdStatusSold,
+			"sold_at": now,
+		}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&offer).Where("completed_at IS NULL").Update("completed_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errOfferNotPending
+		}
+		return nil
+	})
+	if err != nil {
+		respondOfferError(c, offer, err)
+		return
+	}
+	offer.CompletedAt = &now
+
+	services.PublishOfferEvent(services.EventOfferUpdate, offer)
+	notifyAdStatusChange(offer.AdID, offer.BuyerID)
+
+	c.JSON(http.StatusOK, gin.H{"offer": serializeOffer(offer)})
+}
+
+// ReleaseAdReservation lets the seller put a reserved ad back on sale, cancelling the accepted offer holding it
+func ReleaseAdReservation(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	adID, err := strconv.Atoi(c.Param("adID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid adID"})
+		return
+	}
+
+	var ad models.Ad
+	if err := initializers.DB.First(&ad, adID).Error; err != nil || ad.UserID != user.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	}
+
+	cancelled, err := services.ReleaseReservation(ad.ID, "The seller released the reservation.")
+	switch {
+	case errors.Is(err, services.ErrAdNotReserved):
+		c.JSON(http.StatusConflict, gin.H{"error": "This ad isn't reserved"})
+		return
+	case errors.Is(err, services.ErrReservationPaid):
+		c.JSON(http.StatusConflict, gin.H{"error": "The buyer already paid, refund the order to release the item"})
+		return
+	case err != nil:
+		log.Printf("Failed to release reservation of ad %d: %v", ad.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release reservation"})
+		return
+	}
+
+	offers := make([]gin.H, 0, len(cancelled))
+	for _, offer := range cancelled {
+		offers = append(offers, serializeOffer(offer))
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "The ad is back on sale", "cancelled_offers": offers})
+}
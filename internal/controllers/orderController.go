@@ -0,0 +1,607 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxTrackingNumberLength = 64   // Maximum characters of a tracking number
+	maxDisputeReasonLength  = 1000 // Maximum characters of a dispute reason
+)
+
+// serializeOrder returns an order as seen by viewer, only the buyer gets the checkout link
+func serializeOrder(order models.Order, viewer uint) gin.H {
+	data := gin.H(services.OrderData(order))
+	if order.Ad.ID != 0 {
+		data["ad"] = serializeAdSummary(order.Ad)
+	}
+	if order.IsBuyer(viewer) && order.Status == models.OrderStatusPending {
+		data["checkout_url"] = order.CheckoutURL
+	}
+	return data
+}
+
+// loadOrder finds an order the user is the buyer or seller of
+func loadOrder(c *gin.Context, userID uint) (models.Order, bool) {
+	orderID, err := strconv.Atoi(c.Param("orderID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid orderID"})
+		return models.Order{}, false
+	}
+
+	var order models.Order
+	if err := initializers.DB.First(&order, orderID).Error; err != nil || !order.HasParticipant(userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return models.Order{}, false
+	}
+	return order, true
+}
+
+// respondOrderError reports the failure of an order transition
+func respondOrderError(c *gin.Context, order models.Order, err error) {
+	if errors.Is(err, services.ErrOrderState) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This order can't be updated in its current status", "status": order.Status})
+		return
+	}
+	log.Printf("Failed to update order %d: %v", order.ID, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order"})
+}
+
+/*
+checkout opens a payment of the item amount and its delivery for the buyer. A pending order of
+the same ad is reused, with a new payment when the terms changed or the previous one was never opened.
+*/
+func checkout(c *gin.Context, ad models.Ad, buyer models.User, itemAmount int64, delivery services.Delivery, offerID *uint) {
+	amount := itemAmount + delivery.Cost
+	buyerID := buyer.ID
+
+	var order models.Order
+	err := initializers.DB.Where("ad_id = ? AND buyer_id = ? AND status = ?", ad.ID, buyerID, models.OrderStatusPending).First(&order).Error
+	switch {
+	case err == nil:
+		sameOffer := (order.OfferID == nil && offerID == nil) || (order.OfferID != nil && offerID != nil && *order.OfferID == *offerID)
+		sameDelivery := order.DeliveryMethod == delivery.Method && order.DeliveryPostcode == delivery.Postcode
+		if order.Amount == amount && sameOffer && sameDelivery && order.CheckoutURL != "" {
+			order.Ad = ad
+			c.JSON(http.StatusOK, gin.H{"order": serializeOrder(order, buyerID)})
+			return
+		}
+		order.Amount, order.OfferID = amount, offerID
+		order.DeliveryMethod, order.DeliveryPostcode, order.DeliveryCost = delivery.Method, delivery.Postcode, delivery.Cost
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		var seller models.User
+		if err := initializers.DB.Select("first_name, last_name").First(&seller, ad.UserID).Error; err != nil {
+			log.Printf("Failed to load seller %d of ad %d: %v", ad.UserID, ad.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start checkout"})
+			return
+		}
+		order = models.Order{
+			AdID:             &ad.ID,
+			BuyerID:          &buyer.ID,
+			SellerID:         &ad.UserID,
+			AdTitle:          ad.Title,
+			BuyerName:        services.PartyName(buyer),
+			SellerName:       services.PartyName(seller),
+			OfferID:          offerID,
+			Amount:           amount,
+			DeliveryMethod:   delivery.Method,
+			DeliveryPostcode: delivery.Postcode,
+			DeliveryCost:     delivery.Cost,
+			Status:           models.OrderStatusPending,
+			PaymentProvider:  services.Payments.Name(),
+		}
+		result := initializers.DB.Omit("Ad", "Buyer", "Seller").Clauses(clause.OnConflict{DoNothing: true}).Create(&order)
+		if result.Error != nil {
+			log.Printf("Failed to create order on ad %d: %v", ad.ID, result.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start checkout"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "A checkout for this item is already in progress"})
+			return
+		}
+	default:
+		log.Printf("Failed to load orders on ad %d: %v", ad.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start checkout"})
+		return
+	}
+
+	intent, err := services.Payments.CreatePayment(fmt.Sprintf("order %d", order.ID), amount)
+	if err != nil {
+		log.Printf("Failed to open payment for order %d: %v", order.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "The payment provider is unavailable, please try again"})
+		return
+	}
+
+	// A payment of the replaced intent no longer matches the order and is refunded by the webhook
+	result := initializers.DB.Model(&order).Where("status = ?", models.OrderStatusPending).Updates(map[string]interface{}{
+		"amount":            amount,
+		"offer_id":          offerID,
+		"delivery_method":   delivery.Method,
+		"delivery_postcode": delivery.Postcode,
+		"delivery_cost":     delivery.Cost,
+		"payment_ref":       intent.Reference,
+		"checkout_url":      intent.CheckoutURL,
+	})
+	if result.Error != nil || result.RowsAffected == 0 {
+		log.Printf("Failed to attach payment %s to order %d: %v", intent.Reference, order.ID, result.Error)
+		c.JSON(http.StatusConflict, gin.H{"error": "This order was updated meanwhile, please try again"})
+		return
+	}
+	order.PaymentRef, order.CheckoutURL = intent.Reference, intent.CheckoutURL
+	order.Ad = ad
+
+	c.JSON(http.StatusCreated, gin.H{"order": serializeOrder(order, buyerID)})
+}
+
+// BuyAd starts the checkout of an ad at its listed price, plus the delivery chosen by the buyer
+func BuyAd(c *gin.Context) {
+	buyer, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	adID, err := strconv.Atoi(c.Param("adID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid adID"})
+		return
+	}
+
+	var ad models.Ad
+	if err := initializers.DB.First(&ad, adID).Error; err != nil || ad.Status == models.AdStatusRemoved {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	}
+	if ad.UserID == buyer.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't buy your own item"})
+		return
+	}
+	if ad.Status != models.AdStatusActive {
+		c.JSON(http.StatusConflict, gin.H{"error": "This item is no longer available"})
+		return
+	}
+	if ad.Price <= 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "This item has no price, make an offer instead"})
+		return
+	}
+	if !requireNotBlocked(c, buyer.ID, ad.UserID) {
+		return
+	}
+
+	var input deliveryInput
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	delivery, ok := quoteDelivery(c, ad, input)
+	if !ok {
+		return
+	}
+
+	checkout(c, ad, buyer, ad.Price, delivery, nil)
+}
+
+// CheckoutOffer starts the checkout of an accepted offer at the agreed amount and delivery
+func CheckoutOffer(c *gin.Context) {
+	buyer, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	offer, ok := loadOffer(c, buyer.ID)
+	if !ok {
+		return
+	}
+	if offer.BuyerID != buyer.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the buyer can pay for an offer"})
+		return
+	}
+	if offer.Status != models.OfferStatusAccepted || offer.CompletedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only accepted offers can be paid"})
+		return
+	}
+	if !requireNotBlocked(c, offer.BuyerID, offer.SellerID) {
+		return
+	}
+
+	var ad models.Ad
+	if err := initializers.DB.First(&ad, offer.AdID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	}
+	reservedForOther := ad.Status == models.AdStatusReserved && (ad.ReservedOfferID == nil || *ad.ReservedOfferID != offer.ID)
+	if (ad.Status != models.AdStatusActive && ad.Status != models.AdStatusReserved) || reservedForOther {
+		c.JSON(http.StatusConflict, gin.H{"error": "This item is no longer available"})
+		return
+	}
+
+	delivery := services.Delivery{Method: offer.DeliveryMethod, Postcode: offer.DeliveryPostcode, Cost: offer.DeliveryCost}
+	checkout(c, ad, buyer, offer.Amount, delivery, &offer.ID)
+}
+
+// ListOrders returns the user's purchases and sales, newest first. role narrows to buyer or seller
+func ListOrders(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	query := initializers.DB.Preload("Ad")
+	switch role := c.Query("role"); role {
+	case "":
+		query = query.Where("buyer_id = ? OR seller_id = ?", user.ID, user.ID)
+	case "buyer":
+		query = query.Where("buyer_id = ?", user.ID)
+	case "seller":
+		query = query.Where("seller_id = ?", user.ID)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be buyer or seller"})
+		return
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	page, limit, offset := pagination(c)
+
+	var orders []models.Order
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&orders).Error; err != nil {
+		log.Printf("Failed to list orders of user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve orders"})
+		return
+	}
+
+	items := make([]gin.H, 0, len(orders))
+	for _, order := range orders {
+		items = append(items, serializeOrder(order, user.ID))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"orders": items,
+		"page":   page,
+		"limit":  limit,
+	})
+}
+
+func GetOrder(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	order, ok := loadOrder(c, user.ID)
+	if !ok {
+		return
+	}
+	if order.AdID != nil {
+		initializers.DB.First(&order.Ad, *order.AdID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"order": serializeOrder(order, user.ID)})
+}
+
+// ShipOrder lets the seller mark a paid order as sent, with an optional tracking number
+func ShipOrder(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	order, ok := loadOrder(c, user.ID)
+	if !ok {
+		return
+	}
+	if !order.IsSeller(user.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the seller can ship an order"})
+		return
+	}
+
+	var input struct {
+		TrackingNumber string `json:"tracking_number"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tracking := strings.TrimSpace(input.TrackingNumber)
+	if len(tracking) > maxTrackingNumberLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tracking number must be at most 64 characters"})
+		return
+	}
+
+	now := time.Now()
+	if err := services.TransitionOrder(initializers.DB, &order, models.OrderStatusShipped, map[string]interface{}{
+		"shipped_at":      now,
+		"tracking_number": tracking,
+	}); err != nil {
+		respondOrderError(c, order, err)
+		return
+	}
+	order.ShippedAt = &now
+	order.TrackingNumber = tracking
+
+	services.PublishOrderEvent(order)
+	trackingNote := ""
+	if tracking != "" {
+		trackingNote = fmt.Sprintf(" Tracking number: %s.", tracking)
+	}
+	services.NotifyOrderParty(order.BuyerID, "Your order is on its way",
+		fmt.Sprintf("Your order #%d has been sent.%s", order.ID, trackingNote),
+		"",
+		fmt.Sprintf("Confirm receipt once it arrives so the seller gets paid. Without a confirmation or a dispute, the payment is released %d days after sending.", int(services.OrderConfirmPeriod().Hours()/24)),
+	)
+
+	c.JSON(http.StatusOK, gin.H{"order": serializeOrder(order, user.ID)})
+}
+
+// ConfirmOrderReceipt lets the buyer confirm the item arrived, which releases the payment to the seller
+func ConfirmOrderReceipt(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	order, ok := loadOrder(c, user.ID)
+	if !ok {
+		return
+	}
+	if !order.IsBuyer(user.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the buyer can confirm receipt"})
+		return
+	}
+
+	now := time.Now()
+	if err := services.TransitionOrder(initializers.DB, &order, models.OrderStatusDelivered, map[string]interface{}{
+		"delivered_at": now,
+	}); err != nil {
+		respondOrderError(c, order, err)
+		return
+	}
+	order.DeliveredAt = &now
+
+	// A failed payout is retried by the payout worker, the buyer's part is done
+	if err := services.ReleaseOrder(&order); err != nil {
+		log.Printf("Failed to release order %d: %v", order.ID, err)
+		services.PublishOrderEvent(order)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"order": serializeOrder(order, user.ID)})
+}
+
+// RefundOrder lets the seller cancel a paid order before the buyer confirms receipt, refunding the buyer
+func RefundOrder(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	order, ok := loadOrder(c, user.ID)
+	if !ok {
+		return
+	}
+	if !order.IsSeller(user.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the seller can refund an order"})
+		return
+	}
+
+	if err := services.RefundOrder(&order, true, &user.ID, "Cancelled by the seller"); err != nil {
+		respondOrderError(c, order, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"order": serializeOrder(order, user.ID)})
+}
+
+/*
+DisputeOrder lets the buyer report a problem with a paid or sent order, such as an item that
+never arrived or isn't as described. The payment is held until a moderator settles the dispute.
+*/
+func DisputeOrder(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	order, ok := loadOrder(c, user.ID)
+	if !ok {
+		return
+	}
+	if !order.IsBuyer(user.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the buyer can dispute an order"})
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	reason := strings.TrimSpace(input.Reason)
+	if reason == "" || utf8.RuneCountInString(reason) > maxDisputeReasonLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Reason must be between 1 and %d characters", maxDisputeReasonLength)})
+		return
+	}
+
+	if err := services.DisputeOrder(&order, reason); err != nil {
+		respondOrderError(c, order, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"order": serializeOrder(order, user.ID)})
+}
+
+// ListDisputedOrders returns the orders waiting for a moderator to settle a dispute, oldest first
+func ListDisputedOrders(c *gin.Context) {
+	page, limit, offset := pagination(c)
+
+	query := initializers.DB.Model(&models.Order{}).Where("status = ?", models.OrderStatusDisputed)
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		log.Printf("Failed to count disputed orders: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve disputes"})
+		return
+	}
+	var orders []models.Order
+	if err := query.Preload("Ad").Order("disputed_at").Limit(limit).Offset(offset).Find(&orders).Error; err != nil {
+		log.Printf("Failed to list disputed orders: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve disputes"})
+		return
+	}
+
+	items := make([]gin.H, 0, len(orders))
+	for _, order := range orders {
+		items = append(items, serializeOrder(order, 0))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"orders": items,
+		"total":  total,
+		"page":   page,
+		"limit":  limit,
+	})
+}
+
+// ResolveOrderDispute lets a moderator settle a dispute by refunding the buyer or releasing the payment to the seller
+func ResolveOrderDispute(c *gin.Context) {
+	moderator, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	orderID, err := strconv.Atoi(c.Param("orderID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid orderID"})
+		return
+	}
+
+	var input struct {
+		Outcome string `json:"outcome" binding:"required"`
+		Notes   string `json:"notes"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Outcome != "refund" && input.Outcome != "release" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "outcome must be refund or release"})
+		return
+	}
+	notes := strings.TrimSpace(input.Notes)
+	if utf8.RuneCountInString(notes) > maxDisputeReasonLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Notes must be at most %d characters", maxDisputeReasonLength)})
+		return
+	}
+
+	var order models.Order
+	if err := initializers.DB.First(&order, orderID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	if err := services.ResolveDispute(&order, input.Outcome == "refund", moderator.ID, notes); err != nil {
+		respondOrderError(c, order, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"order": serializeOrder(order, 0)})
+}
+
+// PaymentWebhook receives payment outcomes from the provider. Unsigned or stale requests are rejected
+func PaymentWebhook(c *gin.Context) {
+	payload, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+
+	event, err := services.Payments.ParseWebhook(payload, c.GetHeader("X-Payment-Signature"))
+	if err != nil {
+		log.Printf("Rejected payment webhook from %s: %v", c.ClientIP(), err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signature"})
+		return
+	}
+
+	// Errors make the provider retry the event
+	if err := services.HandlePaymentEvent(event); err != nil {
+		log.Printf("Failed to handle payment event %s (%s): %v", event.ID, event.Type, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to handle event"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
+
+// SimulatePayment settles a payment of the fake provider as the payer and delivers its webhook, for development
+func SimulatePayment(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	fake, ok := services.Payments.(*services.FakePaymentProvider)
+	if !ok || !services.PaymentSimulation {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	// Payments are made by the buyer of an order or the seller promoting an ad
+	reference := c.Param("reference")
+	var order models.Order
+	var promotion models.Promotion
+	if err := initializers.DB.Where("payment_ref = ? AND buyer_id = ?", reference, user.ID).First(&order).Error; err != nil {
+		if err := initializers.DB.Where("payment_ref = ? AND user_id = ?", reference, user.ID).First(&promotion).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+			return
+		}
+	}
+
+	payload, signature, err := fake.Simulate(c.Param("event"), reference)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	event, err := fake.ParseWebhook(payload, signature)
+	if err == nil {
+		err = services.HandlePaymentEvent(event)
+	}
+	if err != nil {
+		log.Printf("Failed to simulate payment %s: %v", reference, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to simulate payment"})
+		return
+	}
+
+	if promotion.ID != 0 {
+		initializers.DB.First(&promotion, promotion.ID)
+		c.JSON(http.StatusOK, gin.H{"promotion": serializePromotion(promotion)})
+		return
+	}
+	initializers.DB.First(&order, order.ID)
+	c.JSON(http.StatusOK, gin.H{"order": serializeOrder(order, user.ID)})
+}
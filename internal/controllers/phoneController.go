@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	phoneOTPExpiry      = 10 * time.Minute // Lifetime of a phone verification code
+	phoneOTPMaxAttempts = 5                // Wrong codes allowed before the code is discarded
+	phoneOTPResendDelay = time.Minute      // Minimum time between two codes for the same user
+)
+
+// PhoneVerification is stored in Redis while a user verifies a phone number
+type PhoneVerification struct {
+	PhoneNumber string    `json:"phone_number"`
+	CodeHash    string    `json:"code_hash"`
+	SentAt      time.Time `json:"sent_at"`
+}
+
+func getPhoneOTPKey(userID uint) string {
+	// Generate a key for storing phone verification codes in Redis
+	return fmt.Sprintf("phone_otp:%d", userID)
+}
+
+func getPhoneOTPAttemptsKey(userID uint) string {
+	// Generate a key for counting verification attempts against the current code
+	return fmt.Sprintf("phone_otp_attempts:%d", userID)
+}
+
+func generateOTP() (string, error) {
+	// Generate a random 6 digit code
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+func SendPhoneVerificationCode(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var body struct {
+		PhoneNumber string `json:"phone_number" binding:"required"`
+		Country     string `json:"country"` // ISO alpha-2 code used for numbers in national format
+	}
+
+	// Bind request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Normalize to E.164
+	phoneNumber, err := services.NormalizePhoneNumber(body.PhoneNumber, body.Country)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid phone number"})
+		return
+	}
+
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+
+	// Throttle resends
+	key := getPhoneOTPKey(user.ID)
+	if existing, err := initializers.RedisClient.Get(ctx, key).Result(); err == nil {
+		var pending PhoneVerification
+		if json.Unmarshal([]byte(existing), &pending) == nil && time.Since(pending.SentAt) < phoneOTPResendDelay {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Please wait before requesting another code"})
+			return
+		}
+	} else if err != redis.Nil {
+		log.Printf("Redis error in SendPhoneVerificationCode: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification code"})
+		return
+	}
+
+	code, err := generateOTP()
+	if err != nil {
+		log.Printf("Failed to generate OTP: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification code"})
+		return
+	}
+
+	verificationJSON, err := json.Marshal(PhoneVerification{
+		PhoneNumber: phoneNumber,
+		CodeHash:    generateTokenHash(code),
+		SentAt:      time.Now(),
+	})
+	if err != nil {
+		log.Printf("Error marshaling phone verification: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification code"})
+		return
+	}
+
+	// A new code gets a fresh set of attempts
+	pipe := initializers.RedisClient.TxPipeline()
+	pipe.Set(ctx, key, verificationJSON, phoneOTPExpiry)
+	pipe.Del(ctx, getPhoneOTPAttemptsKey(user.ID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to store phone verification: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification code"})
+		return
+	}
+
+	// Send code over SMS
+	message := fmt.Sprintf("Your Grabit verification code is %s. It expires in %d minutes.", code, int(phoneOTPExpiry.Minutes()))
+	if err := services.SMS.Send(phoneNumber, message); err != nil {
+		log.Printf("Failed to send SMS to user %d: %v", user.ID, err)
+		initializers.RedisClient.Del(ctx, key)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send verification code"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Verification code sent",
+		"phone_number": phoneNumber,
+	})
+}
+
+func VerifyPhoneNumber(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var body struct {
+		Code string `json:"code" binding:"required,len=6,numeric"`
+	}
+
+	// Bind request body
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := contextWithTimeout()
+	defer cancel()
+
+	key, attemptsKey := getPhoneOTPKey(user.ID), getPhoneOTPAttemptsKey(user.ID)
+
+	// Every attempt is counted atomically before the code is compared, so parallel guesses can't share a count
+	pipe := initializers.RedisClient.TxPipeline()
+	attempts := pipe.Incr(ctx, attemptsKey)
+	pipe.ExpireNX(ctx, attemptsKey, phoneOTPExpiry)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Redis error in VerifyPhoneNumber: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify phone number"})
+		return
+	}
+	if attempts.Val() > phoneOTPMaxAttempts {
+		initializers.RedisClient.Del(ctx, key)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Too many invalid attempts, request a new code"})
+		return
+	}
+
+	verificationJSON, err := initializers.RedisClient.Get(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No pending verification, request a new code"})
+			return
+		}
+		log.Printf("Redis error in VerifyPhoneNumber: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify phone number"})
+		return
+	}
+
+	var pending PhoneVerification
+	if err := json.Unmarshal([]byte(verificationJSON), &pending); err != nil {
+		log.Printf("Error unmarshaling phone verification: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify phone number"})
+		return
+	}
+
+	// Wrong code: discard the code once attempts run out
+	if subtle.ConstantTimeCompare([]byte(generateTokenHash(body.Code)), []byte(pending.CodeHash)) != 1 {
+		if attempts.Val() >= phoneOTPMaxAttempts {
+			initializers.RedisClient.Del(ctx, key)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Too many invalid attempts, request a new code"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	// Store the verified number, and remove any other number from the user's ads
+	now := time.Now()
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"phone_number":      pending.PhoneNumber,
+			"phone_verified_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Ad{}).
+			Where("user_id = ? AND phone_number <> '' AND phone_number <> ?", user.ID, pending.PhoneNumber).
+			UpdateColumn("phone_number", "").Error
+	})
+	if err != nil {
+		log.Printf("Failed to store verified phone number: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify phone number"})
+		return
+	}
+
+	initializers.RedisClient.Del(ctx, key, attemptsKey)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "Phone number verified",
+		"phone_number":      pending.PhoneNumber,
+		"phone_verified_at": now,
+	})
+}
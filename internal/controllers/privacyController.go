@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+func GetPrivacySettings(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"privacy": serializePrivacySettings(services.PrivacyFor(user.ID)),
+	})
+}
+
+func UpdatePrivacySettings(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(c.Request.Body).Decode(&patch); err != nil || patch == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request body must be a JSON object"})
+		return
+	}
+
+	// Validate only the fields present in the patch
+	updates, fieldErrors := services.ApplyMergePatch(patch, services.PrivacyPatchFields)
+	if len(fieldErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":  "Validation failed",
+			"fields": fieldErrors,
+		})
+		return
+	}
+
+	// Create the row from the defaults on first change
+	settings := services.PrivacyFor(user.ID)
+	if len(updates) > 0 {
+		columns := make([]string, 0, len(updates))
+		for column := range updates {
+			columns = append(columns, column)
+		}
+
+		if err := initializers.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&settings).Error; err != nil {
+			log.Printf("Failed to create privacy settings for user %d: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update privacy settings"})
+			return
+		}
+		if err := initializers.DB.Model(&settings).Select(columns).Updates(updates).Error; err != nil {
+			log.Printf("Failed to update privacy settings for user %d: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update privacy settings"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Privacy settings updated successfully",
+		"privacy": serializePrivacySettings(settings),
+	})
+}
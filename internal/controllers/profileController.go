@@ -1,10 +1,16 @@
 package controllers
 
 import (
+	"encoding/json"
+	"log"
+	"mime"
 	"net/http"
+	"os"
 	"strconv"
+	"time"
 	"github.com/Desk888/api/internal/initializers"
 	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
 	"github.com/gin-gonic/gin"
 )
 
@@ -18,92 +24,127 @@ func ViewProfile(c *gin.Context) {
 
 	var user models.User
 
-	if err := initializers.DB.Select("profile_picture_url, first_name, last_name, username, city, country, bio, created_at").
+	if err := initializers.DB.Select("id, profile_picture_url, profile_picture_key, first_name, last_name, username, email, phone_number, city, country, bio, phone_verified_at, deactivated_at, suspended_at, created_at").
     Where("id = ?", userID).
-    First(&user).Error; err != nil {
+    First(&user).Error; err != nil || user.IsDeactivated() || user.IsSuspended() {
     c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
     return
 }
 
-	c.JSON(http.StatusOK, gin.H{
-		"profile_image": user.ProfilePictureURL,
+	profileImage, profileImages := avatarURLs(user)
+
+	profile := gin.H{
+		"profile_image": profileImage,
+		"profile_images": profileImages,
 		"first_name":    user.FirstName,
 		"last_name":     user.LastName,
 		"username":      user.Username,
-		"city":          user.City,
-		"country":       user.Country,
 		"bio":           user.Bio,
 		"created_at":    user.CreatedAt,
-	})
-}
+		"badges": gin.H{
+			"phone_verified": user.PhoneVerifiedAt != nil,
+		},
+	}
 
+	// Location and contact fields follow the user's privacy settings
+	addProfileContactFields(profile, user, services.PrivacyFor(user.ID), viewerID(c))
 
-func EditProfile(c *gin.Context) {
-	userIDParam := c.Param("userID")
-	userID, err := strconv.Atoi(userIDParam)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
-		return
-	}
+	c.JSON(http.StatusOK, profile)
+}
 
-	var user models.User
 
-	if err := initializers.DB.Where("id = ?", userID).First(&user).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+func PatchProfile(c *gin.Context) {
+	user, ok := requireProfileOwner(c)
+	if !ok {
 		return
 	}
 
-	var input struct {
-		ProfilePictureURL string `json:"profile_picture_url"`
-		FirstName         string `json:"first_name"`
-		LastName          string `json:"last_name"`
-		City              string `json:"city"`
-		Country           string `json:"country"`
-		Bio               string `json:"bio"`
+	// Accept JSON Merge Patch documents (RFC 7396)
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be application/merge-patch+json"})
+		return
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(c.Request.Body).Decode(&patch); err != nil || patch == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request body must be a JSON object"})
 		return
 	}
 
-	updateData := map[string]interface{}{
-		"profile_picture_url": input.ProfilePictureURL,
-		"first_name":          input.FirstName,
-		"last_name":           input.LastName,
-		"city":                input.City,
-		"country":             input.Country,
-		"bio":                 input.Bio,
+	// Validate only the fields present in the patch
+	updates, fieldErrors := services.ApplyMergePatch(patch, services.ProfilePatchFields)
+	if len(fieldErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":  "Validation failed",
+			"fields": fieldErrors,
+		})
+		return
 	}
 
-	if err := initializers.DB.Model(&user).Updates(updateData).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
-		return
+	if len(updates) > 0 {
+		if err := initializers.DB.Model(&user).Updates(updates).Error; err != nil {
+			log.Printf("Failed to patch profile for user %d: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+			return
+		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Profile updated successfully"})
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Profile updated successfully",
+		"profile": gin.H{
+			"first_name": user.FirstName,
+			"last_name":  user.LastName,
+			"username":   user.Username,
+			"city":       user.City,
+			"country":    user.Country,
+			"bio":        user.Bio,
+		},
+	})
 }
 
-
 func DeleteProfile(c *gin.Context) {
-	userIDParam := c.Param("userID")
-	userID, err := strconv.Atoi(userIDParam)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+	user, ok := requireProfileOwner(c)
+	if !ok {
 		return
 	}
 
-	var user models.User
-
-	if err := initializers.DB.Where("id = ?", userID).First(&user).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	// Deactivate now, purge once the grace period ends
+	now := time.Now()
+	scheduledAt := now.Add(accountDeletionGracePeriod())
+	if err := initializers.DB.Model(&user).Updates(map[string]interface{}{
+		"deactivated_at":        now,
+		"deletion_scheduled_at": scheduledAt,
+	}).Error; err != nil {
+		log.Printf("Failed to deactivate user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete profile"})
 		return
 	}
 
-	if err := initializers.DB.Unscoped().Delete(&user).Error; err != nil {
-	    c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to permanently delete user"})
-	    return
+	// Sign out everywhere
+	if err := services.RevokeUserSessions(user.ID); err != nil {
+		log.Printf("Failed to revoke sessions for user %d: %v", user.ID, err)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Profile deleted successfully"})
+	services.Audit(services.AuditAccountDeletionRequested, &user.ID, "user", user.ID, map[string]interface{}{
+		"scheduled_at": scheduledAt,
+	})
+
+	// Clear token cookie
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie("Authorization", "", -1, "/", "", true, true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":               "Profile scheduled for deletion. Sign in through /auth/restore-account before the deadline to cancel.",
+		"deletion_scheduled_at": scheduledAt,
+	})
+}
+
+// accountDeletionGracePeriod reads ACCOUNT_DELETION_GRACE_DAYS, defaulting to 30 days
+func accountDeletionGracePeriod() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("ACCOUNT_DELETION_GRACE_DAYS"))
+	if err != nil || days < 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
 }
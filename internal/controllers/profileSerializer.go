@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// addProfileContactFields adds the location and contact fields the viewer is allowed to see
+func addProfileContactFields(profile gin.H, user models.User, settings models.PrivacySettings, viewer uint) {
+	if services.CanSee(settings.CityVisibility, user.ID, viewer) {
+		profile["city"] = user.City
+	}
+	if services.CanSee(settings.CountryVisibility, user.ID, viewer) {
+		profile["country"] = user.Country
+	}
+	if services.CanSee(settings.EmailVisibility, user.ID, viewer) {
+		profile["email"] = user.Email
+	}
+	// Only verified numbers are ever shown to others
+	if services.CanSee(settings.PhoneVisibility, user.ID, viewer) && (user.PhoneVerifiedAt != nil || user.ID == viewer) {
+		profile["phone_number"] = user.PhoneNumber
+	}
+	profile["allow_messages"] = settings.AllowMessages
+}
+
+func serializePrivacySettings(settings models.PrivacySettings) gin.H {
+	return gin.H{
+		"city_visibility":    settings.CityVisibility,
+		"country_visibility": settings.CountryVisibility,
+		"phone_visibility":   settings.PhoneVisibility,
+		"email_visibility":   settings.EmailVisibility,
+		"allow_messages":     settings.AllowMessages,
+	}
+}
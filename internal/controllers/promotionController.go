@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxPromotionDays    = 30                  // Longest promotion that can be booked at once
+	maxPromotionAdvance = 90 * 24 * time.Hour // How far ahead a promotion can be scheduled
+)
+
+// promotedPositions are the indexes of a search results page where top of category ads are placed
+var promotedPositions = []int{0, 5, 10}
+
+type promotionInput struct {
+	Type           string     `json:"type" binding:"required"`
+	Days           int        `json:"days" binding:"required"`
+	StartsAt       *time.Time `json:"starts_at"`       // Defaults to now
+	MaxImpressions *int64     `json:"max_impressions"` // Impression budget, unlimited when omitted
+}
+
+func serializePromotion(promotion models.Promotion) gin.H {
+	return gin.H{
+		"id":              promotion.ID,
+		"ad_id":           promotion.AdID,
+		"type":            promotion.Type,
+		"status":          promotion.Status,
+		"starts_at":       promotion.StartsAt,
+		"ends_at":         promotion.EndsAt,
+		"max_impressions": promotion.MaxImpressions,
+		"impressions":     promotion.Impressions,
+		"cost":            promotion.Cost,
+		"checkout_url":    promotion.CheckoutURL,
+		"paid_at":         promotion.PaidAt,
+		"cancelled_at":    promotion.CancelledAt,
+		"created_at":      promotion.CreatedAt,
+	}
+}
+
+/*
+PromoteAd books a promotion of one of the user's listed ads, starting now or at starts_at.
+The promotion holds its slot while the user pays its cost at checkout_url.
+*/
+func PromoteAd(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	adID, err := strconv.Atoi(c.Param("adID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid adID"})
+		return
+	}
+
+	var ad models.Ad
+	if err := initializers.DB.First(&ad, adID).Error; err != nil || ad.UserID != user.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+		return
+	}
+	if ad.Status != models.AdStatusActive {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only active ads can be promoted"})
+		return
+	}
+
+	var input promotionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.IsPromotionType(input.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid type", "allowed": models.PromotionTypes})
+		return
+	}
+	if input.Days < 1 || input.Days > maxPromotionDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 30"})
+		return
+	}
+	if input.MaxImpressions != nil && *input.MaxImpressions < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_impressions must be positive"})
+		return
+	}
+
+	now := time.Now()
+	startsAt := now
+	if input.StartsAt != nil && input.StartsAt.After(now) {
+		startsAt = *input.StartsAt
+	}
+	if startsAt.Sub(now) > maxPromotionAdvance {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Promotions can be scheduled at most 90 days ahead"})
+		return
+	}
+
+	promotion := models.Promotion{
+		AdID:           ad.ID,
+		UserID:         user.ID,
+		Type:           input.Type,
+		CategoryID:     ad.CategoryID,
+		Status:         models.PromotionStatusPendingPayment,
+		StartsAt:       startsAt,
+		EndsAt:         startsAt.AddDate(0, 0, input.Days),
+		MaxImpressions: input.MaxImpressions,
+		Cost:           services.PromotionDailyRates[input.Type] * int64(input.Days),
+	}
+
+	if err := services.BookPromotion(&promotion); err != nil {
+		switch {
+		case errors.Is(err, services.ErrPromotionSlotsFull), errors.Is(err, services.ErrPromotionOverlap):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			log.Printf("Failed to book promotion of ad %d: %v", ad.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to book promotion"})
+		}
+		return
+	}
+
+	intent, err := services.Payments.CreatePayment(fmt.Sprintf("promotion %d", promotion.ID), promotion.Cost)
+	if err == nil {
+		promotion.PaymentRef, promotion.CheckoutURL = intent.Reference, intent.CheckoutURL
+		err = initializers.DB.Model(&promotion).Updates(map[string]interface{}{
+			"payment_ref":  intent.Reference,
+			"checkout_url": intent.CheckoutURL,
+		}).Error
+	}
+	if err != nil {
+		// Free the slot, a payment opened meanwhile matches no promotion and is refunded by the webhook
+		log.Printf("Failed to open payment for promotion %d: %v", promotion.ID, err)
+		initializers.DB.Model(&promotion).Update("status", models.PromotionStatusCancelled)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "The payment provider is unavailable, please try again"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"promotion": serializePromotion(promotion)})
+}
+
+// ListPromotions returns the user's promotions, newest first. Impressions lag by up to a minute
+func ListPromotions(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	query := initializers.DB.Where("user_id = ?", user.ID)
+	if adID := c.Query("ad_id"); adID != "" {
+		query = query.Where("ad_id = ?", adID)
+	}
+
+	page, limit, offset := pagination(c)
+
+	var promotions []models.Promotion
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&promotions).Error; err != nil {
+		log.Printf("Failed to list promotions of user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve promotions"})
+		return
+	}
+
+	items := make([]gin.H, 0, len(promotions))
+	for _, promotion := range promotions {
+		items = append(items, serializePromotion(promotion))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"promotions": items,
+		"page":       page,
+		"limit":      limit,
+	})
+}
+
+// CancelPromotion stops a promotion, refunding it when it hasn't started yet
+func CancelPromotion(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	promotionID, err := strconv.Atoi(c.Param("promotionID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid promotionID"})
+		return
+	}
+
+	var promotion models.Promotion
+	if err := initializers.DB.First(&promotion, promotionID).Error; err != nil || promotion.UserID != user.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+		return
+	}
+
+	if err := services.CancelPromotion(&promotion); err != nil {
+		if errors.Is(err, services.ErrPromotionEnded) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Promotion already ended"})
+			return
+		}
+		log.Printf("Failed to cancel promotion %d: %v", promotion.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel promotion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"promotion": serializePromotion(promotion)})
+}
+
+// FeaturedAds returns the ads with an active homepage promotion, in random order
+func FeaturedAds(c *gin.Context) {
+	var ads []models.Ad
+	if err := initializers.DB.Scopes(services.HideAdsOfInactiveOwners, services.HideAdsOfBlockers(viewerID(c)), services.PromotedAds(models.PromotionHomepage)).
+		Where("ads.status = ?", models.AdStatusActive).
+		Order("RANDOM()").
+		Limit(int(services.PromotionSlots[models.PromotionHomepage])).
+		Find(&ads).Error; err != nil {
+		log.Printf("Failed to load featured ads: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve featured ads"})
+		return
+	}
+
+	items, err := labelPromotedAds(ads, models.PromotionHomepage)
+	if err != nil {
+		log.Printf("Failed to load featured ad promotions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve featured ads"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ads": items})
+}
+
+// labelPromotedAds serializes ads shown for a promotion type and counts an impression of each promotion
+func labelPromotedAds(ads []models.Ad, promotionType string) ([]gin.H, error) {
+	adIDs := make([]uint, 0, len(ads))
+	for _, ad := range ads {
+		adIDs = append(adIDs, ad.ID)
+	}
+	promotions, err := services.ActivePromotions(promotionType, adIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]gin.H, 0, len(ads))
+	shown := make([]uint, 0, len(promotions))
+	for _, ad := range ads {
+		item := serializeAdSummary(ad)
+		if promotionID, ok := promotions[ad.ID]; ok {
+			item["promoted"] = true
+			item["promotion"] = promotionType
+			shown = append(shown, promotionID)
+		}
+		items = append(items, item)
+	}
+	services.RecordPromotionImpressions(shown)
+	return items, nil
+}
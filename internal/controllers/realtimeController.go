@@ -0,0 +1,349 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	realtimeHeartbeat    = 25 * time.Second // Interval between pings or SSE heartbeats
+	realtimePongWait     = 60 * time.Second // Connection is closed if no pong arrives in time
+	realtimeWriteWait    = 10 * time.Second // Timeout for a single write
+	typingThrottle       = 2 * time.Second  // Minimum time between typing events per conversation
+	sessionRecheck       = time.Minute      // Interval between checks that the session wasn't revoked
+	maxClientMessageSize = 4096             // Maximum size of a message sent by a client
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     checkRealtimeOrigin,
+}
+
+// checkRealtimeOrigin allows the origins listed in ALLOWED_ORIGINS, or same-host requests by default
+func checkRealtimeOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true // Native mobile clients
+	}
+	if allowed := os.Getenv("ALLOWED_ORIGINS"); allowed != "" {
+		for _, candidate := range strings.Split(allowed, ",") {
+			if strings.TrimSpace(candidate) == origin {
+				return true
+			}
+		}
+		return false
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(origin, "https://"), "http://") == r.Host
+}
+
+// clientEvent is a message sent by a client over the WebSocket
+type clientEvent struct {
+	Type           string `json:"type"`
+	ConversationID uint   `json:"conversation_id"`
+	UpToMessageID  uint   `json:"up_to_message_id"`
+}
+
+// lastEventID reads the resume position from the Last-Event-ID header or last_event_id query parameter
+func lastEventID(c *gin.Context) string {
+	if id := c.GetHeader("Last-Event-ID"); id != "" {
+		return id
+	}
+	return c.Query("last_event_id")
+}
+
+// publishTyping notifies the other participant that the user is typing
+func publishTyping(userID, conversationID uint) error {
+	var conversation models.Conversation
+	if err := initializers.DB.First(&conversation, conversationID).Error; err != nil || !conversation.HasParticipant(userID) {
+		return fmt.Errorf("conversation %d not found", conversationID)
+	}
+	if services.IsBlocked(userID, conversation.OtherParty(userID)) {
+		return nil
+	}
+
+	services.PublishEvent(conversation.OtherParty(userID), services.EventTyping, gin.H{
+		"conversation_id": conversation.ID,
+		"user_id":         userID,
+	}, false)
+	return nil
+}
+
+/*
+sessionRevoked reports whether the session a stream was opened with has been signed out or
+revoked. Redis errors keep the stream open, the next check will retry.
+*/
+func sessionRevoked(session string) bool {
+	exists, err := services.SessionHashExists(session)
+	if err != nil {
+		log.Printf("Failed to check real-time session: %v", err)
+		return false
+	}
+	return !exists
+}
+
+// CreateRealtimeTicket issues a single-use ticket for opening a WebSocket or EventSource connection
+func CreateRealtimeTicket(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ticket, err := services.IssueRealtimeTicket(user.ID, c.GetString("session"))
+	if err != nil {
+		log.Printf("Failed to issue real-time ticket for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create ticket"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"ticket": ticket})
+}
+
+func RealtimeWebSocket(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	resumeFrom := lastEventID(c)
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return // The upgrader already wrote the error response
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Subscribe before replaying so nothing published in between is lost
+	pubsub, err := services.SubscribeUserEvents(ctx, user.ID)
+	if err != nil {
+		log.Printf("Failed to subscribe to events for user %d: %v", user.ID, err)
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "subscription failed"))
+		return
+	}
+	defer pubsub.Close()
+
+	// All writes happen on this goroutine
+	var writerDone sync.WaitGroup
+	writerDone.Add(1)
+	go func() {
+		defer writerDone.Done()
+		defer cancel()
+		writeWebSocketEvents(ctx, conn, pubsub.Channel(), user.ID, c.GetString("session"), resumeFrom)
+	}()
+
+	// Read client events until the connection closes
+	conn.SetReadLimit(maxClientMessageSize)
+	conn.SetReadDeadline(time.Now().Add(realtimePongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(realtimePongWait))
+	})
+
+	lastTyping := map[uint]time.Time{}
+	for {
+		var event clientEvent
+		if err := conn.ReadJSON(&event); err != nil {
+			break
+		}
+
+		switch event.Type {
+		case services.EventTyping:
+			if time.Since(lastTyping[event.ConversationID]) < typingThrottle {
+				continue
+			}
+			lastTyping[event.ConversationID] = time.Now()
+			if err := publishTyping(user.ID, event.ConversationID); err != nil {
+				log.Printf("Ignored typing event from user %d: %v", user.ID, err)
+			}
+		case "read":
+			var conversation models.Conversation
+			if err := initializers.DB.First(&conversation, event.ConversationID).Error; err != nil || !conversation.HasParticipant(user.ID) {
+				continue
+			}
+			if _, err := markConversationRead(conversation, user.ID, event.UpToMessageID); err != nil {
+				log.Printf("Failed to mark conversation %d as read: %v", conversation.ID, err)
+			}
+		}
+	}
+
+	cancel()
+	writerDone.Wait()
+}
+
+func writeWebSocketEvents(ctx context.Context, conn *websocket.Conn, live <-chan *redis.Message, userID uint, session, resumeFrom string) {
+	write := func(event services.Event) error {
+		conn.SetWriteDeadline(time.Now().Add(realtimeWriteWait))
+		return conn.WriteJSON(event)
+	}
+
+	// Replay missed events
+	lastSent := resumeFrom
+	if resumeFrom != "" {
+		missed, err := services.ReplayEvents(ctx, userID, resumeFrom)
+		if err != nil {
+			log.Printf("Failed to replay events for user %d: %v", userID, err)
+		}
+		for _, event := range missed {
+			if err := write(event); err != nil {
+				return
+			}
+			lastSent = event.ID
+		}
+	}
+
+	heartbeat := time.NewTicker(realtimeHeartbeat)
+	defer heartbeat.Stop()
+	recheck := time.NewTicker(sessionRecheck)
+	defer recheck.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(realtimeWriteWait))
+			return
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(realtimeWriteWait)); err != nil {
+				return
+			}
+		case <-recheck.C:
+			if sessionRevoked(session) {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session expired"), time.Now().Add(realtimeWriteWait))
+				conn.Close() // Unblocks the reader
+				return
+			}
+		case message, ok := <-live:
+			if !ok {
+				return
+			}
+			event, err := services.ParseEvent(message.Payload)
+			if err != nil || (event.ID != "" && !services.EventAfter(event.ID, lastSent)) {
+				continue // Malformed, or already sent during replay
+			}
+			if err := write(event); err != nil {
+				return
+			}
+			if event.ID != "" {
+				lastSent = event.ID
+			}
+		}
+	}
+}
+
+// RealtimeEvents streams the same events as RealtimeWebSocket using Server-Sent Events
+func RealtimeEvents(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	pubsub, err := services.SubscribeUserEvents(ctx, user.ID)
+	if err != nil {
+		log.Printf("Failed to subscribe to events for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to subscribe to events"})
+		return
+	}
+	defer pubsub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable proxy buffering
+	c.Status(http.StatusOK)
+
+	write := func(event services.Event) {
+		if event.ID != "" {
+			fmt.Fprintf(c.Writer, "id: %s\n", event.ID)
+		}
+		data, _ := json.Marshal(event.Data)
+		fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event.Type, data)
+		c.Writer.Flush()
+	}
+
+	// Ask clients to reconnect quickly, then replay missed events
+	fmt.Fprintf(c.Writer, "retry: 3000\n\n")
+	lastSent := lastEventID(c)
+	if lastSent != "" {
+		missed, err := services.ReplayEvents(ctx, user.ID, lastSent)
+		if err != nil {
+			log.Printf("Failed to replay events for user %d: %v", user.ID, err)
+		}
+		for _, event := range missed {
+			write(event)
+			lastSent = event.ID
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(realtimeHeartbeat)
+	defer heartbeat.Stop()
+	recheck := time.NewTicker(sessionRecheck)
+	defer recheck.Stop()
+	live := pubsub.Channel()
+	session := c.GetString("session")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprintf(c.Writer, ": heartbeat\n\n")
+			c.Writer.Flush()
+		case <-recheck.C:
+			if sessionRevoked(session) {
+				// Clients reconnect after a closed stream and are then rejected
+				return
+			}
+		case message, ok := <-live:
+			if !ok {
+				return
+			}
+			event, err := services.ParseEvent(message.Payload)
+			if err != nil || (event.ID != "" && !services.EventAfter(event.ID, lastSent)) {
+				continue
+			}
+			write(event)
+			if event.ID != "" {
+				lastSent = event.ID
+			}
+		}
+	}
+}
+
+// SendTyping publishes a typing indicator, for clients using the Server-Sent Events fallback
+func SendTyping(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	conversation, ok := loadConversation(c, user.ID)
+	if !ok {
+		return
+	}
+
+	if err := publishTyping(user.ID, conversation.ID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
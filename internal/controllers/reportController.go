@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+const maxReportDetailsLength = 1000 // Maximum characters of a report's details
+
+type reportInput struct {
+	TargetType string `json:"target_type" binding:"required"`
+	TargetID   uint   `json:"target_id" binding:"required"`
+	ReasonCode string `json:"reason_code" binding:"required"`
+	Details    string `json:"details"`
+}
+
+// reportableTarget checks that the target exists and that the reporter may report it
+func reportableTarget(c *gin.Context, reporterID uint, targetType string, targetID uint) bool {
+	switch targetType {
+	case models.ReportTargetAd:
+		var ad models.Ad
+		if err := initializers.DB.First(&ad, targetID).Error; err != nil || ad.Status == models.AdStatusRemoved {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Ad not found"})
+			return false
+		}
+		if ad.UserID == reporterID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You can't report your own ad"})
+			return false
+		}
+	case models.ReportTargetUser:
+		var user models.User
+		if err := initializers.DB.First(&user, targetID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return false
+		}
+		if user.ID == reporterID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You can't report yourself"})
+			return false
+		}
+	case models.ReportTargetMessage:
+		// Only participants of the conversation can report a message they received
+		var message models.Message
+		if err := initializers.DB.Preload("Conversation").First(&message, targetID).Error; err != nil ||
+			!message.Conversation.HasParticipant(reporterID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+			return false
+		}
+		if message.SenderID == reporterID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You can't report your own message"})
+			return false
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "target_type must be ad, user or message"})
+		return false
+	}
+	return true
+}
+
+func CreateReport(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var input reportInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, known := services.ReportReasons[input.ReasonCode]; !known {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown reason_code"})
+		return
+	}
+	details := strings.TrimSpace(input.Details)
+	if utf8.RuneCountInString(details) > maxReportDetailsLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Details must be at most %d characters", maxReportDetailsLength)})
+		return
+	}
+
+	if !reportableTarget(c, user.ID, input.TargetType, input.TargetID) {
+		return
+	}
+
+	report := models.Report{
+		TargetType: input.TargetType,
+		TargetID:   input.TargetID,
+		ReporterID: user.ID,
+		ReasonCode: input.ReasonCode,
+		Details:    details,
+	}
+	if _, err := services.FileReport(&report); err != nil {
+		log.Printf("Failed to file report on %s %d: %v", input.TargetType, input.TargetID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit report"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Thanks, our moderators will review your report"})
+}
@@ -0,0 +1,380 @@
+package controllers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxReviewLength       = 1000 // Maximum characters of a review comment or reply
+	maxReportReasonLength = 255  // Maximum characters of a report reason
+)
+
+type reviewInput struct {
+	Rating  int    `json:"rating" binding:"required,min=1,max=5"`
+	Comment string `json:"comment"`
+}
+
+// reviewWindow reads REVIEW_WINDOW_DAYS, the time after a sale during which both parties can review, defaulting to 30 days
+func reviewWindow() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("REVIEW_WINDOW_DAYS"))
+	if err != nil || days < 1 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// reviewHideThreshold reads REVIEW_REPORT_HIDE_THRESHOLD, the reports after which a review is hidden pending moderation
+func reviewHideThreshold() int {
+	threshold, err := strconv.Atoi(os.Getenv("REVIEW_REPORT_HIDE_THRESHOLD"))
+	if err != nil || threshold < 1 {
+		threshold = 3
+	}
+	return threshold
+}
+
+// serializeRating returns a rating summary with the average rounded to one decimal
+func serializeRating(summary services.RatingSummary) gin.H {
+	var average interface{}
+	if summary.Average != nil {
+		average = math.Round(*summary.Average*10) / 10
+	}
+	return gin.H{"average_rating": average, "review_count": summary.Count}
+}
+
+func serializeReview(review models.Review) gin.H {
+	reviewerImage, _ := avatarURLs(review.Reviewer)
+	return gin.H{
+		"id":            review.ID,
+		"ad_id":         review.AdID,
+		"reviewer":      gin.H{"id": review.Reviewer.ID, "username": review.Reviewer.Username, "profile_image": reviewerImage},
+		"reviewee_id":   review.RevieweeID,
+		"reviewer_role": review.ReviewerRole,
+		"rating":        review.Rating,
+		"comment":       review.Comment,
+		"reply":         review.Reply,
+		"replied_at":    review.RepliedAt,
+		"created_at":    review.CreatedAt,
+	}
+}
+
+// validateReviewText trims a comment or reply and checks its length
+func validateReviewText(c *gin.Context, text string) (string, bool) {
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) > maxReviewLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Text must be at most 1000 characters"})
+		return "", false
+	}
+	return text, true
+}
+
+// loadReview finds a review by the :reviewID route parameter
+func loadReview(c *gin.Context) (models.Review, bool) {
+	reviewID, err := strconv.Atoi(c.Param("reviewID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reviewID"})
+		return models.Review{}, false
+	}
+
+	var review models.Review
+	if err := initializers.DB.First(&review, reviewID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return models.Review{}, false
+	}
+	return review, true
+}
+
+/*
+reviewableSale is a sale whose buyer and seller can review each other once it completed.
+OrderID is set for sales paid through an order, OfferID for sales agreed through an offer.
+*/
+type reviewableSale struct {
+	AdID        uint
+	BuyerID     uint
+	SellerID    uint
+	OfferID     *uint
+	OrderID     *uint
+	CompletedAt *time.Time
+}
+
+// CreateReview lets the buyer or seller of a completed offer review the other party once
+func CreateReview(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	offer, ok := loadOffer(c, user.ID)
+	if !ok {
+		return
+	}
+
+	createReview(c, user, reviewableSale{
+		AdID:        offer.AdID,
+		BuyerID:     offer.BuyerID,
+		SellerID:    offer.SellerID,
+		OfferID:     &offer.ID,
+		CompletedAt: offer.CompletedAt,
+	})
+}
+
+/*
+CreateOrderReview lets the buyer or seller of a released order review the other party once.
+An order paid for an offer shares the offer's review, so the sale can't be reviewed twice.
+*/
+func CreateOrderReview(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	order, ok := loadOrder(c, user.ID)
+	if !ok {
+		return
+	}
+	if order.AdID == nil || order.BuyerID == nil || order.SellerID == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "This sale can no longer be reviewed"})
+		return
+	}
+
+	createReview(c, user, reviewableSale{
+		AdID:        *order.AdID,
+		BuyerID:     *order.BuyerID,
+		SellerID:    *order.SellerID,
+		OfferID:     order.OfferID,
+		OrderID:     &order.ID,
+		CompletedAt: order.ReleasedAt,
+	})
+}
+
+func createReview(c *gin.Context, user models.User, sale reviewableSale) {
+	// Only users who completed a deal together can review each other
+	if sale.CompletedAt == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only review a completed sale"})
+		return
+	}
+	if time.Since(*sale.CompletedAt) > reviewWindow() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The review period for this sale has ended"})
+		return
+	}
+
+	if !requireNotBlocked(c, sale.BuyerID, sale.SellerID) {
+		return
+	}
+
+	var input reviewInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	comment, ok := validateReviewText(c, input.Comment)
+	if !ok {
+		return
+	}
+
+	role, revieweeID := models.ReviewerRoleSeller, sale.BuyerID
+	if sale.BuyerID == user.ID {
+		role, revieweeID = models.ReviewerRoleBuyer, sale.SellerID
+	}
+
+	review := models.Review{
+		OfferID:      sale.OfferID,
+		OrderID:      sale.OrderID,
+		AdID:         sale.AdID,
+		ReviewerID:   user.ID,
+		RevieweeID:   revieweeID,
+		ReviewerRole: role,
+		Rating:       input.Rating,
+		Comment:      comment,
+	}
+	result := initializers.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&review)
+	if result.Error != nil {
+		log.Printf("Failed to create review of ad %d by user %d: %v", sale.AdID, user.ID, result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save review"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already reviewed this sale"})
+		return
+	}
+	services.InvalidateUserRating(revieweeID)
+
+	review.Reviewer = user
+	c.JSON(http.StatusCreated, gin.H{"review": serializeReview(review)})
+}
+
+// ListUserReviews returns the visible reviews a user received, newest first
+func ListUserReviews(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+
+	query := initializers.DB.
+		Preload("Reviewer", func(db *gorm.DB) *gorm.DB { return db.Select("id, username, profile_picture_url, profile_picture_key") }).
+		Where("reviewee_id = ? AND hidden_at IS NULL", userID)
+	switch role := c.Query("role"); role {
+	case "":
+	case models.ReviewerRoleBuyer, models.ReviewerRoleSeller:
+		query = query.Where("reviewer_role = ?", role)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be buyer or seller"})
+		return
+	}
+
+	page, limit, offset := pagination(c)
+
+	var reviews []models.Review
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&reviews).Error; err != nil {
+		log.Printf("Failed to list reviews of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve reviews"})
+		return
+	}
+
+	summary, err := services.UserRating(uint(userID))
+	if err != nil {
+		log.Printf("Failed to load rating of user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve reviews"})
+		return
+	}
+
+	items := make([]gin.H, 0, len(reviews))
+	for _, review := range reviews {
+		items = append(items, serializeReview(review))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rating":  serializeRating(summary),
+		"reviews": items,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// ReplyToReview lets the reviewed user answer a review once
+func ReplyToReview(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	review, ok := loadReview(c)
+	if !ok {
+		return
+	}
+	if review.RevieweeID != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the reviewed user can reply"})
+		return
+	}
+	if !requireNotBlocked(c, review.RevieweeID, review.ReviewerID) {
+		return
+	}
+
+	var input struct {
+		Reply string `json:"reply" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	reply, ok := validateReviewText(c, input.Reply)
+	if !ok {
+		return
+	}
+	if reply == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reply can't be empty"})
+		return
+	}
+
+	now := time.Now()
+	result := initializers.DB.Model(&review).Where("replied_at IS NULL").Updates(map[string]interface{}{
+		"reply":      reply,
+		"replied_at": now,
+	})
+	if result.Error != nil {
+		log.Printf("Failed to reply to review %d: %v", review.ID, result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save reply"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already replied to this review"})
+		return
+	}
+	review.Reply = reply
+	review.RepliedAt = &now
+
+	initializers.DB.Select("id, username, profile_picture_url, profile_picture_key").First(&review.Reviewer, review.ReviewerID)
+	c.JSON(http.StatusOK, gin.H{"review": serializeReview(review)})
+}
+
+// ReportReview flags a review for moderation, hiding it once enough users reported it
+func ReportReview(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	review, ok := loadReview(c)
+	if !ok {
+		return
+	}
+	if review.ReviewerID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't report your own review"})
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	reason := strings.TrimSpace(input.Reason)
+	if reason == "" || utf8.RuneCountInString(reason) > maxReportReasonLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reason must be between 1 and 255 characters"})
+		return
+	}
+
+	report := models.ReviewReport{ReviewID: review.ID, ReporterID: user.ID, Reason: reason}
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&report)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error // Reporting twice is a no-op
+		}
+		// Read the count back, concurrent reports may have raised it since the review was loaded
+		return tx.Raw("UPDATE reviews SET report_count = report_count + 1 WHERE id = ? RETURNING report_count", review.ID).
+			Scan(&review.ReportCount).Error
+	})
+	if err != nil {
+		log.Printf("Failed to report review %d: %v", review.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to report review"})
+		return
+	}
+
+	if review.HiddenAt == nil && review.ReportCount >= reviewHideThreshold() {
+		if err := services.SetReviewHidden(&review, true, "Reported by users, pending moderation", nil); err != nil {
+			log.Printf("Failed to hide review %d: %v", review.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Thanks, the review has been reported"})
+}
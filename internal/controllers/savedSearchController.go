@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxSavedSearches = 50 // Saved searches per user
+
+type savedSearchInput struct {
+	Name        string `json:"name"`
+	Keywords    string `json:"keywords"`
+	CategoryID  *uint  `json:"category_id"`
+	Condition   string `json:"condition"`
+	City        string `json:"city"`
+	MinPrice    *int64 `json:"min_price"` // In pence
+	MaxPrice    *int64 `json:"max_price"` // In pence
+	EmailAlerts *bool  `json:"email_alerts"`
+}
+
+func serializeSavedSearch(search models.SavedSearch) gin.H {
+	return gin.H{
+		"id":              search.ID,
+		"name":            search.Name,
+		"keywords":        search.Keywords,
+		"category_id":     search.CategoryID,
+		"condition":       search.Condition,
+		"city":            search.City,
+		"min_price":       search.MinPrice,
+		"max_price":       search.MaxPrice,
+		"email_alerts":    search.EmailAlerts,
+		"paused":          search.PausedAt != nil,
+		"last_alerted_at": search.LastAlertedAt,
+		"created_at":      search.CreatedAt,
+	}
+}
+
+// loadSavedSearch finds a saved search of the user by the :searchID route parameter
+func loadSavedSearch(c *gin.Context, userID uint) (models.SavedSearch, bool) {
+	searchID, err := strconv.Atoi(c.Param("searchID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid searchID"})
+		return models.SavedSearch{}, false
+	}
+
+	var search models.SavedSearch
+	if err := initializers.DB.Where("id = ? AND user_id = ?", searchID, userID).First(&search).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Saved search not found"})
+		return models.SavedSearch{}, false
+	}
+	return search, true
+}
+
+func CreateSavedSearch(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var input savedSearchInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	input.Keywords = strings.TrimSpace(input.Keywords)
+	input.City = strings.TrimSpace(input.City)
+
+	if utf8.RuneCountInString(input.Keywords) > 200 || utf8.RuneCountInString(input.City) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Keywords must be at most 200 characters and city at most 100"})
+		return
+	}
+	if input.Condition != "" && !models.IsAdCondition(input.Condition) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid condition", "allowed": models.AdConditions})
+		return
+	}
+	if (input.MinPrice != nil && *input.MinPrice < 0) || (input.MaxPrice != nil && *input.MaxPrice < 0) ||
+		(input.MinPrice != nil && input.MaxPrice != nil && *input.MinPrice > *input.MaxPrice) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid price range"})
+		return
+	}
+	if input.CategoryID != nil {
+		if err := initializers.DB.Select("id").First(&models.Category{}, *input.CategoryID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Category not found"})
+			return
+		}
+	}
+
+	// Default the name to the keywords
+	if input.Name == "" {
+		input.Name = input.Keywords
+	}
+	if input.Name == "" {
+		input.Name = "Saved search"
+	}
+	if utf8.RuneCountInString(input.Name) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name must be at most 100 characters"})
+		return
+	}
+
+	var count int64
+	if err := initializers.DB.Model(&models.SavedSearch{}).Where("user_id = ?", user.ID).Count(&count).Error; err != nil {
+		log.Printf("Failed to count saved searches of user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save search"})
+		return
+	}
+	if count >= maxSavedSearches {
+		c.JSON(http.StatusConflict, gin.H{"error": "You can save at most 50 searches"})
+		return
+	}
+
+	search := models.SavedSearch{
+		UserID:      user.ID,
+		Name:        input.Name,
+		Keywords:    input.Keywords,
+		CategoryID:  input.CategoryID,
+		Condition:   input.Condition,
+		City:        input.City,
+		MinPrice:    input.MinPrice,
+		MaxPrice:    input.MaxPrice,
+		EmailAlerts: input.EmailAlerts == nil || *input.EmailAlerts,
+	}
+	// Select every column so a false EmailAlerts isn't replaced by the column default
+	if err := initializers.DB.Select("*").Omit("ID", "User").Create(&search).Error; err != nil {
+		log.Printf("Failed to save search for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save search"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"saved_search": serializeSavedSearch(search)})
+}
+
+func ListSavedSearches(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var searches []models.SavedSearch
+	if err := initializers.DB.Where("user_id = ?", user.ID).Order("created_at DESC").Find(&searches).Error; err != nil {
+		log.Printf("Failed to list saved searches of user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve saved searches"})
+		return
+	}
+
+	items := make([]gin.H, 0, len(searches))
+	for _, search := range searches {
+		items = append(items, serializeSavedSearch(search))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"saved_searches": items})
+}
+
+// setSavedSearchPaused pauses or resumes the alerts of a saved search
+func setSavedSearchPaused(c *gin.Context, paused bool) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	search, ok := loadSavedSearch(c, user.ID)
+	if !ok {
+		return
+	}
+
+	var pausedAt *time.Time
+	if paused {
+		now := time.Now()
+		pausedAt = &now
+	}
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&search).Update("paused_at", pausedAt).Error; err != nil {
+			return err
+		}
+		if paused {
+			return nil
+		}
+		// Matches still pending from before the pause are stale, alerts resume with new ads only
+		return tx.Where("saved_search_id = ? AND notified_at IS NULL", search.ID).Delete(&models.SavedSearchMatch{}).Error
+	})
+	if err != nil {
+		log.Printf("Failed to update saved search %d: %v", search.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update saved search"})
+		return
+	}
+	search.PausedAt = pausedAt
+
+	c.JSON(http.StatusOK, gin.H{"saved_search": serializeSavedSearch(search)})
+}
+
+func PauseSavedSearch(c *gin.Context) {
+	setSavedSearchPaused(c, true)
+}
+
+func ResumeSavedSearch(c *gin.Context) {
+	setSavedSearchPaused(c, false)
+}
+
+func DeleteSavedSearch(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	search, ok := loadSavedSearch(c, user.ID)
+	if !ok {
+		return
+	}
+
+	if err := initializers.DB.Unscoped().Delete(&search).Error; err != nil {
+		log.Printf("Failed to delete saved search %d: %v", search.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete saved search"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Saved search deleted"})
+}
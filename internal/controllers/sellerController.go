@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ViewSellerProfile returns a seller's public profile with their active ads
+func ViewSellerProfile(c *gin.Context) {
+	sellerID, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+
+	// Accounts pending deletion or suspended by a moderator have no public profile
+	var seller models.User
+	if err := initializers.DB.First(&seller, sellerID).Error; err != nil || seller.IsDeactivated() || seller.IsSuspended() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Seller not found"})
+		return
+	}
+	// Sellers who blocked the viewer are hidden from them like their ads
+	if viewer := viewerID(c); viewer != 0 && services.HasBlocked(seller.ID, viewer) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Seller not found"})
+		return
+	}
+
+	// Count ads per status
+	var counts []struct {
+		Status string
+		Count  int64
+	}
+	if err := initializers.DB.Model(&models.Ad{}).
+		Select("status, COUNT(*) AS count").
+		Where("user_id = ?", seller.ID).
+		Group("status").
+		Scan(&counts).Error; err != nil {
+		log.Printf("Failed to count ads for seller %d: %v", seller.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve seller profile"})
+		return
+	}
+	adCounts := map[string]int64{}
+	for _, count := range counts {
+		adCounts[count.Status] = count.Count
+	}
+
+	// Paginated active ads, newest first
+	page, limit, offset := pagination(c)
+	var ads []models.Ad
+	if err := initializers.DB.Scopes(services.HideAdsOfBlockers(viewerID(c))).
+		Where("user_id = ? AND status = ?", seller.ID, models.AdStatusActive).
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&ads).Error; err != nil {
+		log.Printf("Failed to get ads for seller %d: %v", seller.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve seller profile"})
+		return
+	}
+
+	activeAds := make([]gin.H, 0, len(ads))
+	for _, ad := range ads {
+		activeAds = append(activeAds, serializeAdSummary(ad))
+	}
+
+	rating, err := services.UserRating(seller.ID)
+	if err != nil {
+		log.Printf("Failed to load rating of seller %d: %v", seller.ID, err)
+	}
+	ratingFields := serializeRating(rating)
+
+	// Median time to first reply, in seconds
+	var responseTime interface{}
+	if typical, err := services.TypicalResponseTime(seller.ID); err != nil {
+		log.Printf("Failed to compute response time for seller %d: %v", seller.ID, err)
+	} else if typical != nil {
+		responseTime = int64(typical.Seconds())
+	}
+
+	profileImage, profileImages := avatarURLs(seller)
+	profile := gin.H{
+		"id":             seller.ID,
+		"username":       seller.Username,
+		"first_name":     seller.FirstName,
+		"profile_image":  profileImage,
+		"profile_images": profileImages,
+		"bio":            seller.Bio,
+		"member_since":   seller.CreatedAt,
+		"badges": gin.H{
+			"phone_verified": seller.PhoneVerifiedAt != nil,
+		},
+		"reputation": gin.H{
+			"active_ads":            adCounts[models.AdStatusActive],
+			"sold_ads":              adCounts[models.AdStatusSold],
+			"average_rating":        ratingFields["average_rating"],
+			"review_count":          ratingFields["review_count"],
+			"typical_response_time": responseTime,
+		},
+	}
+
+	// Location and contact fields follow the seller's privacy settings
+	addProfileContactFields(profile, seller, services.PrivacyFor(seller.ID), viewerID(c))
+
+	c.JSON(http.StatusOK, gin.H{
+		"seller": profile,
+		"ads": gin.H{
+			"items": activeAds,
+			"page":  page,
+			"limit": limit,
+			"total": adCounts[models.AdStatusActive],
+		},
+	})
+}
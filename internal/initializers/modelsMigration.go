@@ -1,12 +1,162 @@
 package initializers
 
-import "github.com/Desk888/api/internal/models"
+import (
+	"log"
+
+	"github.com/Desk888/api/internal/models"
+	"gorm.io/gorm"
+)
 
 func MigrateTables() {
 	// Migrate all models
 	DB.AutoMigrate(&models.User{})
 	DB.AutoMigrate(&models.Category{})
 	DB.AutoMigrate(&models.Ad{})
+	dedupeFavorites()
 	DB.AutoMigrate(&models.Favorite{})
-	
+	DB.AutoMigrate(&models.LoginHistory{})
+	DB.AutoMigrate(&models.AuditLog{})
+	DB.AutoMigrate(&models.DataExport{})
+	DB.AutoMigrate(&models.PrivacySettings{})
+	migrateLegacyContactVisibility()
+	DB.AutoMigrate(&models.ContactReveal{})
+	DB.AutoMigrate(&models.UserBlock{})
+	DB.AutoMigrate(&models.Conversation{})
+	DB.AutoMigrate(&models.Message{})
+	DB.AutoMigrate(&models.Offer{})
+	keepOrdersOnDelete()
+	DB.AutoMigrate(&models.Order{})
+	backfillOrderSnapshots()
+	DB.AutoMigrate(&models.Review{})
+	DB.AutoMigrate(&models.ReviewReport{})
+	DB.AutoMigrate(&models.ModerationCase{})
+	DB.AutoMigrate(&models.Report{})
+	DB.AutoMigrate(&models.SavedSearch{})
+	DB.AutoMigrate(&models.SavedSearchMatch{})
+	DB.AutoMigrate(&models.FavoriteAlert{})
+	DB.AutoMigrate(&models.AdDailyStat{})
+	DB.AutoMigrate(&models.Promotion{})
+
+	// Distance search on ads, the extensions need a superuser unless created beforehand (see README)
+	for _, statement := range []string{
+		"CREATE EXTENSION IF NOT EXISTS cube",
+		"CREATE EXTENSION IF NOT EXISTS earthdistance",
+		"CREATE INDEX IF NOT EXISTS idx_ads_location ON ads USING gist (ll_to_earth(latitude, longitude)) WHERE latitude IS NOT NULL AND longitude IS NOT NULL",
+	} {
+		if err := DB.Exec(statement).Error; err != nil {
+			log.Fatalf("Failed to set up distance search (%s): %v", statement, err)
+		}
+	}
+}
+
+/*
+dedupeFavorites removes duplicate favorites of the same ad by the same user so the unique
+index can be created, keeping the oldest favorite that wasn't removed.
+*/
+func dedupeFavorites() {
+	if !DB.Migrator().HasTable(&models.Favorite{}) || DB.Migrator().HasIndex(&models.Favorite{}, "idx_favorites_user_ad") {
+		return
+	}
+
+	result := DB.Exec(`
+		DELETE FROM favorites WHERE id IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (PARTITION BY user_id, ad_id ORDER BY deleted_at IS NOT NULL, id) AS position
+				FROM favorites
+			) ranked
+			WHERE position > 1
+		)`)
+	if result.Error != nil {
+		log.Fatalf("Failed to remove duplicate favorites: %v", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Removed %d duplicate favorites", result.RowsAffected)
+	}
+}
+
+/*
+migrateLegacyContactVisibility moves the show_email and show_phone opt-ins of the public
+seller profile into privacy settings, then drops the columns. Users who already saved
+privacy settings keep them.
+*/
+func migrateLegacyContactVisibility() {
+	if !DB.Migrator().HasColumn(&models.User{}, "show_email") {
+		return
+	}
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			INSERT INTO privacy_settings (user_id, city_visibility, country_visibility, phone_visibility, email_visibility, allow_messages, created_at, updated_at)
+			SELECT id, ?, ?,
+				CASE WHEN show_phone THEN ? ELSE ? END,
+				CASE WHEN show_email THEN ? ELSE ? END,
+				TRUE, NOW(), NOW()
+			FROM users
+			WHERE show_email OR show_phone
+			ON CONFLICT (user_id) DO NOTHING`,
+			models.VisibilityEveryone, models.VisibilityEveryone,
+			models.VisibilityEveryone, models.VisibilityNobody,
+			models.VisibilityEveryone, models.VisibilityNobody,
+		).Error; err != nil {
+			return err
+		}
+		return tx.Exec("ALTER TABLE users DROP COLUMN IF EXISTS show_email, DROP COLUMN IF EXISTS show_phone").Error
+	})
+	if err != nil {
+		log.Fatalf("Failed to migrate contact visibility to privacy settings: %v", err)
+	}
+	log.Println("Migrated show_email and show_phone to privacy settings")
+}
+
+/*
+keepOrdersOnDelete drops the cascading foreign keys of orders to their ad, buyer and seller,
+and the not null on those columns, so AutoMigrate recreates the keys with SET NULL and sales
+survive the deletion of an ad or an account.
+*/
+func keepOrdersOnDelete() {
+	if !DB.Migrator().HasTable(&models.Order{}) {
+		return
+	}
+
+	var constraints []string
+	err := DB.Raw(`
+		SELECT rc.constraint_name
+		FROM information_schema.referential_constraints rc
+		JOIN information_schema.table_constraints tc
+			ON tc.constraint_schema = rc.constraint_schema AND tc.constraint_name = rc.constraint_name
+		WHERE tc.table_schema = CURRENT_SCHEMA() AND tc.table_name = 'orders' AND rc.delete_rule = 'CASCADE'`,
+	).Scan(&constraints).Error
+	if err != nil {
+		log.Fatalf("Failed to look up the foreign keys of orders: %v", err)
+	}
+	if len(constraints) == 0 {
+		return
+	}
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		for _, name := range constraints {
+			if err := tx.Migrator().DropConstraint(&models.Order{}, name); err != nil {
+				return err
+			}
+		}
+		return tx.Exec("ALTER TABLE orders ALTER COLUMN ad_id DROP NOT NULL, ALTER COLUMN buyer_id DROP NOT NULL, ALTER COLUMN seller_id DROP NOT NULL").Error
+	})
+	if err != nil {
+		log.Fatalf("Failed to stop deleting orders with their ad or parties: %v", err)
+	}
+	log.Printf("Dropped %d cascading foreign keys of orders", len(constraints))
+}
+
+// backfillOrderSnapshots fills the ad title and party names of orders placed before they were recorded
+func backfillOrderSnapshots() {
+	statements := []string{
+		"UPDATE orders SET ad_title = ads.title FROM ads WHERE orders.ad_id = ads.id AND orders.ad_title = ''",
+		"UPDATE orders SET buyer_name = TRIM(users.first_name || ' ' || users.last_name) FROM users WHERE orders.buyer_id = users.id AND orders.buyer_name = ''",
+		"UPDATE orders SET seller_name = TRIM(users.first_name || ' ' || users.last_name) FROM users WHERE orders.seller_id = users.id AND orders.seller_name = ''",
+	}
+	for _, statement := range statements {
+		if err := DB.Exec(statement).Error; err != nil {
+			log.Fatalf("Failed to backfill order snapshots: %v", err)
+		}
+	}
 }
@@ -1,6 +1,7 @@
 package initializers
 
 import (
+	"context"
 	"log"
 	"os"
 
@@ -9,6 +10,7 @@ import (
 )
 
 var S3Client *minio.Client
+var S3Bucket string // Bucket used for all uploaded media
 
 func InitS3() {
 	endpoint := os.Getenv("S3_ENDPOINT")
@@ -27,5 +29,16 @@ func InitS3() {
 
 	// Assign to the global variable
 	S3Client = client
+	S3Bucket = os.Getenv("S3_BUCKET_NAME")
+
+	// Create the bucket if it doesn't exist yet (MinIO in development)
+	ctx := context.Background()
+	if exists, err := client.BucketExists(ctx, S3Bucket); err != nil {
+		log.Println("Error checking S3 bucket:", err)
+	} else if !exists {
+		if err := client.MakeBucket(ctx, S3Bucket, minio.MakeBucketOptions{}); err != nil {
+			log.Println("Error creating S3 bucket:", err)
+		}
+	}
 	log.Println("S3 client initialized successfully")
 }
@@ -2,12 +2,15 @@ package middleware
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/Desk888/api/internal/initializers"
 	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 )
@@ -20,8 +23,37 @@ func RequireAuth(c *gin.Context) {
 		return
 	}
 
+	user, status, errBody := authenticate(tokenString)
+	if errBody != nil {
+		c.AbortWithStatusJSON(status, errBody)
+		return
+	}
+
+	// Set the user and the hash of their session in the context
+	c.Set("user", user)
+	c.Set("session", services.TokenHash(strings.TrimPrefix(tokenString, "Bearer ")))
+	c.Next()
+}
+
+/*
+	OptionalAuth sets the user in the context when a valid token is sent,
+	and otherwise lets the request through anonymously. Used by public endpoints
+	whose response depends on who is viewing.
+*/
+func OptionalAuth(c *gin.Context) {
+	tokenString := c.GetHeader("Authorization")
+	if tokenString != "" {
+		if user, _, errBody := authenticate(tokenString); errBody == nil {
+			c.Set("user", user)
+		}
+	}
+	c.Next()
+}
+
+// authenticate validates a bearer token and its session, returning an error status and body on failure
+func authenticate(tokenString string) (models.User, int, gin.H) {
 	// Remove 'Bearer ' prefix
-	tokenString = tokenString[len("Bearer "):]
+	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
 
 	// Parse and validate the token
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
@@ -31,32 +63,52 @@ func RequireAuth(c *gin.Context) {
 		}
 		return []byte(os.Getenv("SECRET")), nil
 	})
-	
+
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token", "details": err.Error()})
-		return
+		return models.User{}, http.StatusUnauthorized, gin.H{"error": "Invalid token", "details": err.Error()}
 	}
 
 	// Extract claims and validate expiration
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		if float64(time.Now().Unix()) > claims["exp"].(float64) {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
-			return
-		}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return models.User{}, http.StatusUnauthorized, gin.H{"error": "Invalid token claims"}
+	}
+	if float64(time.Now().Unix()) > claims["exp"].(float64) {
+		return models.User{}, http.StatusUnauthorized, gin.H{"error": "Token expired"}
+	}
 
-		// Retrieve user from the database using the 'sub' claim (which is user ID)
-		var user models.User
-		userID := uint(claims["sub"].(float64))  // Convert to uint (assuming user ID is uint)
-		if err := initializers.DB.First(&user, userID).Error; err != nil || user.ID == 0 {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
-			return
-		}
+	// Retrieve user from the database using the 'sub' claim (which is user ID)
+	userID := uint(claims["sub"].(float64)) // Convert to uint (assuming user ID is uint)
+	return authenticateSession(userID, services.TokenHash(tokenString))
+}
 
-		// Set the user in the context
-		c.Set("user", user)
-		c.Next()
-	} else {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
-		return
+/*
+authenticateSession loads the user of a session, checking the account is active and the
+Redis session under tokenHash still exists. Signing out, deactivating and suspending revoke
+the session, so a valid token alone isn't enough.
+*/
+func authenticateSession(userID uint, tokenHash string) (models.User, int, gin.H) {
+	var user models.User
+	if err := initializers.DB.First(&user, userID).Error; err != nil || user.ID == 0 {
+		return models.User{}, http.StatusUnauthorized, gin.H{"error": "User not found"}
+	}
+
+	// Reject accounts pending deletion
+	if user.IsDeactivated() {
+		return models.User{}, http.StatusForbidden, gin.H{"error": "Account is scheduled for deletion"}
 	}
+	if user.IsSuspended() {
+		return models.User{}, http.StatusForbidden, gin.H{"error": "Account is suspended"}
+	}
+
+	exists, err := services.SessionHashExists(tokenHash)
+	if err != nil {
+		log.Printf("Redis error while authenticating user %d: %v", user.ID, err)
+		return models.User{}, http.StatusInternalServerError, gin.H{"error": "Failed to validate session"}
+	}
+	if !exists {
+		return models.User{}, http.StatusUnauthorized, gin.H{"error": "Session expired"}
+	}
+
+	return user, http.StatusOK, nil
 }
@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/Desk888/api/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireModerator only lets moderators through. Must run after RequireAuth
+func RequireModerator(c *gin.Context) {
+	value, _ := c.Get("user")
+	user, ok := value.(models.User)
+	if !ok || !user.IsModerator() {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Moderator access required"})
+		return
+	}
+	c.Next()
+}
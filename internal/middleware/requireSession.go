@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+/*
+	RequireSession authenticates the real-time endpoints like RequireAuth.
+	Browsers can't set headers on WebSocket and EventSource requests, so they authenticate
+	with the Authorization cookie or a single-use ticket from POST /realtime/ticket.
+	The hash of the session is set in the context so streams can check it is still active.
+*/
+func RequireSession(c *gin.Context) {
+	var (
+		user    models.User
+		session string
+		status  int
+		errBody gin.H
+	)
+
+	tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if tokenString == "" {
+		tokenString, _ = c.Cookie("Authorization")
+	}
+	switch ticket := c.Query("ticket"); {
+	case tokenString != "":
+		session = services.TokenHash(tokenString)
+		user, status, errBody = authenticate(tokenString)
+	case ticket != "":
+		redeemed, found, err := services.RedeemRealtimeTicket(ticket)
+		if err != nil {
+			log.Printf("Redis error while redeeming a real-time ticket: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate ticket"})
+			return
+		}
+		if !found {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired ticket"})
+			return
+		}
+		session = redeemed.Session
+		user, status, errBody = authenticateSession(redeemed.UserID, session)
+	default:
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization required"})
+		return
+	}
+	if errBody != nil {
+		c.AbortWithStatusJSON(status, errBody)
+		return
+	}
+
+	// Set the user and the hash of their session in the context
+	c.Set("user", user)
+	c.Set("session", session)
+	c.Next()
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// Daily counters of an ad, flushed from Redis
+type AdDailyStat struct {
+	ID             uint      `gorm:"primarykey"`
+	AdID           uint      `gorm:"not null;uniqueIndex:idx_ad_daily_stats_day"`
+	Date           time.Time `gorm:"type:date;not null;uniqueIndex:idx_ad_daily_stats_day"`
+	Views          int64     `gorm:"not null;default:0"` // Unique visitors
+	Favorites      int64     `gorm:"not null;default:0"`
+	ContactReveals int64     `gorm:"not null;default:0"`
+	Messages       int64     `gorm:"not null;default:0"` // Messages received from buyers
+	Ad             Ad        `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UpdatedAt      time.Time
+}
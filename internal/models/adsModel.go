@@ -1,19 +1,100 @@
 package models
 
 import (
+	"errors"
 	"time"
 	"gorm.io/gorm"
 )
 
+// Enums for Ad status
+const (
+	AdStatusActive   = "active"
+	AdStatusReserved = "reserved"
+	AdStatusSold     = "sold"
+	AdStatusRemoved  = "removed" // Hidden by a moderator
+	AdStatusExpired  = "expired"
+)
+
+// IsAdCondition reports whether condition is one of AdConditions
+func IsAdCondition(condition string) bool {
+	for _, valid := range AdConditions {
+		if condition == valid {
+			return true
+		}
+	}
+	return false
+}
+
+var ErrUnverifiedAdPhone = errors.New("ads can only display the owner's verified phone number")
+
 // ENums for Conditions
 const (
 	ConditionUsedFair         = "Used - Fair"
 	ConditionUsedGood         = "Used - Good"
 	ConditionUsedExcellent    = "Used - Excellent"
 	ConditionBrandNewUnboxed  = "Brand New - Unboxed"
-	ConditionBrandNewSealed   = "Brand New - Used"
+	ConditionBrandNewSealed   = "Brand New - Sealed"
+)
+
+// AdConditions lists the valid values of Ad.Condition
+var AdConditions = []string{
+	ConditionUsedFair,
+	ConditionUsedGood,
+	ConditionUsedExcellent,
+	ConditionBrandNewUnboxed,
+	ConditionBrandNewSealed,
+}
+
+// Enums for the ways an item can reach the buyer
+const (
+	DeliveryPickup   = "pickup"         // Collected from the seller
+	DeliveryLocal    = "local_delivery" // Delivered by the seller within Ad.LocalDeliveryKm
+	DeliveryShipping = "shipping"       // Sent as a parcel of Ad.ParcelSize
+)
+
+// DeliveryMethods lists the valid delivery methods
+var DeliveryMethods = []string{
+	DeliveryPickup,
+	DeliveryLocal,
+	DeliveryShipping,
+}
+
+// IsDeliveryMethod reports whether method is one of DeliveryMethods
+func IsDeliveryMethod(method string) bool {
+	for _, valid := range DeliveryMethods {
+		if method == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// Enums for Ad.ParcelSize
+const (
+	ParcelSmall      = "small"
+	ParcelMedium     = "medium"
+	ParcelLarge      = "large"
+	ParcelExtraLarge = "extra_large"
 )
 
+// ParcelSizes lists the valid values of Ad.ParcelSize
+var ParcelSizes = []string{
+	ParcelSmall,
+	ParcelMedium,
+	ParcelLarge,
+	ParcelExtraLarge,
+}
+
+// IsParcelSize reports whether size is one of ParcelSizes
+func IsParcelSize(size string) bool {
+	for _, valid := range ParcelSizes {
+		if size == valid {
+			return true
+		}
+	}
+	return false
+}
+
 // Ads model
 type Ad struct {
 	gorm.Model
@@ -24,11 +105,55 @@ type Ad struct {
 	Condition    string    `gorm:"not null;check:condition IN ('Used - Fair','Used - Good','Used - Excellent','Brand New - Unboxed','Brand New - Sealed')"`
 	City         string
 	Postcode     string
+	Latitude     *float64 // Centroid of the postcode district, indexed with earthdistance
+	Longitude    *float64
 	PhoneNumber  string
 	EmailAddress string
+	Price        int64     `gorm:"not null;default:0;check:price >= 0;index"` // In pence
+	PickupAvailable    bool   `gorm:"not null;default:true"`
+	LocalDeliveryKm    int    `gorm:"not null;default:0;check:local_delivery_km >= 0"`    // Radius the seller delivers within, 0 when not offered
+	LocalDeliveryPrice int64  `gorm:"not null;default:0;check:local_delivery_price >= 0"` // In pence
+	ParcelSize         string `gorm:"size:20;check:parcel_size IN ('','small','medium','large','extra_large')"` // Set when the item can be shipped
+	Status       string    `gorm:"size:20;not null;default:active;index"`
+	SoldAt       *time.Time
+	ReservedUntil *time.Time // Reservations from an accepted offer lapse after this time unless paid for
+	ReservedOfferID *uint // Accepted offer holding the reservation, nil for direct purchases
+	ExpiresAt    *time.Time `gorm:"index"` // Active ads expire after this time
 	CreatedAt    time.Time
 	Category     Category `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"` 
 	User         User     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 	
 	// @Danny See how to best implement S3 storage for the ads images
-}
\ No newline at end of file
+}
+
+// OffersDelivery reports whether the seller offers the delivery method on this ad
+func (a *Ad) OffersDelivery(method string) bool {
+	switch method {
+	case DeliveryPickup:
+		return a.PickupAvailable
+	case DeliveryLocal:
+		return a.LocalDeliveryKm > 0
+	case DeliveryShipping:
+		return a.ParcelSize != ""
+	}
+	return false
+}
+
+// BeforeSave only allows an ad to display its owner's verified phone number
+func (a *Ad) BeforeSave(tx *gorm.DB) error {
+	if a.PhoneNumber == "" {
+		return nil
+	}
+
+	var owner User
+	if err := tx.Session(&gorm.Session{NewDB: true}).
+		Select("phone_number, phone_verified_at").
+		First(&owner, a.UserID).Error; err != nil {
+		return err
+	}
+
+	if owner.PhoneVerifiedAt == nil || owner.PhoneNumber != a.PhoneNumber {
+		return ErrUnverifiedAdPhone
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// Audit log model, kept independently of the records it describes so entries outlive them
+type AuditLog struct {
+	ID         uint   `gorm:"primarykey"`
+	Action     string `gorm:"size:100;not null;index"`
+	ActorID    *uint  `gorm:"index"` // Nil for actions performed by the system
+	TargetType string `gorm:"size:50;not null;index:idx_audit_target"`
+	TargetID   uint   `gorm:"not null;index:idx_audit_target"`
+	Details    string `gorm:"type:jsonb"`
+	CreatedAt  time.Time
+}
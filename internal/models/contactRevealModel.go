@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+	"gorm.io/gorm"
+)
+
+// Contact reveal model, one row per viewer and ad. Each row counts as a lead for the seller
+type ContactReveal struct {
+	gorm.Model
+	AdID           uint   `gorm:"not null;uniqueIndex:idx_contact_reveals_ad_viewer"`
+	ViewerID       uint   `gorm:"not null;uniqueIndex:idx_contact_reveals_ad_viewer"`
+	SellerID       uint   `gorm:"not null;index"`
+	IP             string `gorm:"size:45"`
+	RevealCount    int    `gorm:"not null;default:1"`
+	LastRevealedAt time.Time
+	Ad             Ad   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Viewer         User `gorm:"foreignKey:ViewerID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
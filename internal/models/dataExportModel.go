@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+	"gorm.io/gorm"
+)
+
+// Enums for DataExport status
+const (
+	ExportStatusPending   = "pending"
+	ExportStatusRunning   = "running"
+	ExportStatusCompleted = "completed"
+	ExportStatusFailed    = "failed"
+	ExportStatusExpired   = "expired"
+)
+
+// GDPR data export model, at most one pending or running export per user
+type DataExport struct {
+	gorm.Model
+	UserID      uint   `gorm:"not null;uniqueIndex:idx_data_exports_active,where:status IN ('pending','running')"`
+	Status      string `gorm:"size:20;not null;default:pending;index"`
+	ObjectKey   string `gorm:"size:255"` // Archive location in S3
+	Error       string `gorm:"size:255"`
+	CompletedAt *time.Time
+	ExpiresAt   *time.Time // Archive is deleted after this time
+	User        User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
@@ -5,12 +5,33 @@ import (
 	"gorm.io/gorm"
 )
 
-// Ad Favorite model
+// Enums for favorite alert kinds
+const (
+	FavoriteAlertPriceDrop = "price_drop"
+	FavoriteAlertReserved  = "reserved"
+	FavoriteAlertSold      = "sold"
+	FavoriteAlertExpiring  = "expiring"
+)
+
+// Ad Favorite model, one per user and ad
 type Favorite struct {
 	gorm.Model
-	UserID uint `gorm:"not null"` 
-	AdID   uint `gorm:"not null"`
+	UserID uint `gorm:"not null;uniqueIndex:idx_favorites_user_ad"` 
+	AdID   uint `gorm:"not null;uniqueIndex:idx_favorites_user_ad;index"`
+	AlertsEnabled bool `gorm:"not null;default:true"` // Price drop and status change alerts
 	Ad     Ad   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 	User   User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 	CreatedAt time.Time
-}
\ No newline at end of file
+}
+
+// Alert sent to a user about a favorited ad. DedupKey identifies the change so it is only notified once
+type FavoriteAlert struct {
+	ID        uint   `gorm:"primarykey"`
+	UserID    uint   `gorm:"not null;uniqueIndex:idx_favorite_alerts_dedup"`
+	AdID      uint   `gorm:"not null;uniqueIndex:idx_favorite_alerts_dedup;index"`
+	Kind      string `gorm:"size:20;not null;uniqueIndex:idx_favorite_alerts_dedup"`
+	DedupKey  string `gorm:"size:100;not null;uniqueIndex:idx_favorite_alerts_dedup"`
+	User      User   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Ad        Ad     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CreatedAt time.Time
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+	"gorm.io/gorm"
+)
+
+// Login attempt history model
+type LoginHistory struct {
+	gorm.Model
+	UserID        uint   `gorm:"not null;index"`
+	Success       bool   `gorm:"not null"`
+	FailureReason string `gorm:"size:100"`
+	IP            string `gorm:"size:45"`
+	UserAgent     string `gorm:"size:512"`
+	Device        string `gorm:"size:50"`
+	Browser       string `gorm:"size:50"`
+	OS            string `gorm:"size:50"`
+	Country       string `gorm:"size:100"`
+	City          string `gorm:"size:100"`
+	User          User   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CreatedAt     time.Time
+}
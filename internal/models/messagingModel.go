@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+	"gorm.io/gorm"
+)
+
+// Conversation between a buyer and the seller of an ad, one per ad and buyer
+type Conversation struct {
+	gorm.Model
+	AdID          uint `gorm:"not null;uniqueIndex:idx_conversations_ad_buyer"`
+	BuyerID       uint `gorm:"not null;uniqueIndex:idx_conversations_ad_buyer;index"`
+	SellerID      uint `gorm:"not null;index"`
+	LastMessageAt time.Time `gorm:"index"`
+	Ad            Ad   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Buyer         User `gorm:"foreignKey:BuyerID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Seller        User `gorm:"foreignKey:SellerID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Messages      []Message `gorm:"foreignKey:ConversationID"`
+}
+
+// Message sent within a conversation
+type Message struct {
+	gorm.Model
+	ConversationID uint   `gorm:"not null;index:idx_messages_conversation_created"`
+	SenderID       uint   `gorm:"not null;index"`
+	Body           string `gorm:"type:text;not null"`
+	ReadAt         *time.Time
+	HiddenAt       *time.Time // Set when a moderator removes the message
+	CreatedAt      time.Time `gorm:"index:idx_messages_conversation_created"`
+	Conversation   Conversation `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Sender         User         `gorm:"foreignKey:SenderID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// OtherParty returns the participant of the conversation who isn't userID
+func (c *Conversation) OtherParty(userID uint) uint {
+	if c.BuyerID == userID {
+		return c.SellerID
+	}
+	return c.BuyerID
+}
+
+// HasParticipant reports whether userID is the buyer or seller of the conversation
+func (c *Conversation) HasParticipant(userID uint) bool {
+	return c.BuyerID == userID || c.SellerID == userID
+}
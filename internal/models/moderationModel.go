@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+	"gorm.io/gorm"
+)
+
+// Enums for report targets
+const (
+	ReportTargetAd      = "ad"
+	ReportTargetUser    = "user"
+	ReportTargetMessage = "message"
+)
+
+// Enums for ModerationCase status
+const (
+	CaseStatusOpen      = "open"
+	CaseStatusClaimed   = "claimed"
+	CaseStatusResolved  = "resolved"
+	CaseStatusDismissed = "dismissed"
+)
+
+// CaseStatuses lists the valid values of ModerationCase.Status
+var CaseStatuses = []string{
+	CaseStatusOpen,
+	CaseStatusClaimed,
+	CaseStatusResolved,
+	CaseStatusDismissed,
+}
+
+// IsCaseStatus reports whether status is one of CaseStatuses
+func IsCaseStatus(status string) bool {
+	for _, valid := range CaseStatuses {
+		if status == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// Enums for the action taken when resolving a case
+const (
+	CaseActionNone    = "none"
+	CaseActionHidden  = "hidden"
+	CaseActionSuspend = "suspended"
+)
+
+// Report of an ad, user or message, one per reporter and target
+type Report struct {
+	ID         uint   `gorm:"primarykey"`
+	TargetType string `gorm:"size:20;not null;uniqueIndex:idx_reports_target_reporter"`
+	TargetID   uint   `gorm:"not null;uniqueIndex:idx_reports_target_reporter"`
+	ReporterID uint   `gorm:"not null;uniqueIndex:idx_reports_target_reporter;index"`
+	ReasonCode string `gorm:"size:50;not null"`
+	Details    string `gorm:"type:text"`
+	CaseID     *uint  `gorm:"index"`
+	Reporter   User   `gorm:"foreignKey:ReporterID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Case       *ModerationCase `gorm:"foreignKey:CaseID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	CreatedAt  time.Time
+}
+
+// Moderation case grouping the reports of a target, at most one open or claimed case per target
+type ModerationCase struct {
+	gorm.Model
+	TargetType   string `gorm:"size:20;not null;uniqueIndex:idx_moderation_cases_active,where:status IN ('open','claimed')"`
+	TargetID     uint   `gorm:"not null;uniqueIndex:idx_moderation_cases_active,where:status IN ('open','claimed')"`
+	Status       string `gorm:"size:20;not null;default:open;index"`
+	Priority     int    `gorm:"not null;default:0;index"` // Sum of the weights of the reports' reason codes
+	ReportCount  int    `gorm:"not null;default:0"`
+	ClaimedByID  *uint  `gorm:"index"`
+	ClaimedAt    *time.Time
+	ResolvedByID *uint
+	ResolvedAt   *time.Time
+	Action       string `gorm:"size:20"` // Action taken on resolution
+	Notes        string `gorm:"type:text"`
+	Reports      []Report `gorm:"foreignKey:CaseID"`
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+	"gorm.io/gorm"
+)
+
+// Enums for Offer status
+const (
+	OfferStatusPending   = "pending"
+	OfferStatusAccepted  = "accepted"
+	OfferStatusRejected  = "rejected"
+	OfferStatusCountered = "countered"
+	OfferStatusWithdrawn = "withdrawn"
+	OfferStatusExpired   = "expired"
+	OfferStatusCancelled = "cancelled" // Accepted, then released by the seller or lapsed before the sale
+)
+
+// offerTransitions lists the statuses an offer can move to, final statuses have none
+var offerTransitions = map[string][]string{
+	OfferStatusPending: {
+		OfferStatusAccepted,
+		OfferStatusRejected,
+		OfferStatusCountered,
+		OfferStatusWithdrawn,
+		OfferStatusExpired,
+	},
+	OfferStatusAccepted: {OfferStatusCancelled},
+}
+
+/*
+Offer made on an ad. Buyers make offers and both parties can answer with a counter-offer,
+which replaces the pending offer with a new one linked through ParentOfferID.
+At most one offer is pending per ad and buyer.
+*/
+type Offer struct {
+	gorm.Model
+	AdID          uint   `gorm:"not null;index;uniqueIndex:idx_offers_pending,where:status = 'pending'"`
+	BuyerID       uint   `gorm:"not null;index;uniqueIndex:idx_offers_pending,where:status = 'pending'"`
+	SellerID      uint   `gorm:"not null;index"`
+	ProposerID    uint   `gorm:"not null"` // Buyer, or seller for counter-offers
+	ParentOfferID *uint  `gorm:"index"`    // Offer this one counters
+	Amount        int64  `gorm:"not null;check:amount > 0"` // In pence, for the item alone
+	DeliveryMethod   string `gorm:"size:20;not null;default:pickup"`
+	DeliveryPostcode string // Buyer's postcode, empty for pickup
+	DeliveryCost     int64  `gorm:"not null;default:0"` // In pence, quoted when the offer was made
+	Status        string `gorm:"size:20;not null;default:pending;index"`
+	ExpiresAt     time.Time `gorm:"not null;index"`
+	RespondedAt   *time.Time
+	CompletedAt   *time.Time // Set when the seller confirms the sale of an accepted offer
+	Ad            Ad   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Buyer         User `gorm:"foreignKey:BuyerID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Seller        User `gorm:"foreignKey:SellerID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// CanTransitionTo reports whether the offer can move from its current status to status
+func (o *Offer) CanTransitionTo(status string) bool {
+	for _, allowed := range offerTransitions[o.Status] {
+		if allowed == status {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExpired reports whether a pending offer is past its expiry
+func (o *Offer) IsExpired() bool {
+	return o.Status == OfferStatusPending && !o.ExpiresAt.After(time.Now())
+}
+
+// Recipient returns the participant who has to answer the offer
+func (o *Offer) Recipient() uint {
+	if o.ProposerID == o.BuyerID {
+		return o.SellerID
+	}
+	return o.BuyerID
+}
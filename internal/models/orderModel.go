@@ -0,0 +1,92 @@
+package models
+
+import (
+	"time"
+	"gorm.io/gorm"
+)
+
+// Enums for Order status
+const (
+	OrderStatusPending   = "pending" // Waiting for the buyer's payment
+	OrderStatusPaid      = "paid"    // Payment held in escrow
+	OrderStatusShipped   = "shipped"
+	OrderStatusDisputed  = "disputed"  // The buyer reported a problem, a moderator settles the payment
+	OrderStatusDelivered = "delivered" // The buyer confirmed receipt
+	OrderStatusReleased  = "released"  // Paid out to the seller
+	OrderStatusRefunded  = "refunded"
+)
+
+// orderTransitions lists the statuses an order can move to, final statuses have none
+var orderTransitions = map[string][]string{
+	OrderStatusPending:   {OrderStatusPaid},
+	OrderStatusPaid:      {OrderStatusShipped, OrderStatusDelivered, OrderStatusDisputed, OrderStatusRefunded},
+	OrderStatusShipped:   {OrderStatusDelivered, OrderStatusDisputed, OrderStatusRefunded},
+	OrderStatusDisputed:  {OrderStatusDelivered, OrderStatusRefunded},
+	OrderStatusDelivered: {OrderStatusReleased},
+}
+
+// OrderHeldStatuses are the statuses of orders whose payment is held in escrow
+var OrderHeldStatuses = []string{OrderStatusPaid, OrderStatusShipped, OrderStatusDisputed, OrderStatusDelivered}
+
+/*
+Order is a purchase paid through escrow, at the ad's price or the amount of an accepted offer.
+The payment is held by the provider until the buyer confirms receipt, then paid out to the seller.
+At most one order is pending per ad and buyer. Orders are kept as records of the sale after the
+ad or either account is deleted, with the snapshots taken when the order was created.
+*/
+type Order struct {
+	gorm.Model
+	AdID             *uint  `gorm:"index;uniqueIndex:idx_orders_pending,where:status = 'pending'"` // Nil once the ad is deleted
+	BuyerID          *uint  `gorm:"index;uniqueIndex:idx_orders_pending,where:status = 'pending'"` // Nil once the account is deleted
+	SellerID         *uint  `gorm:"index"`                                                         // Nil once the account is deleted
+	AdTitle          string `gorm:"size:255;not null;default:''"`
+	BuyerName        string `gorm:"size:255;not null;default:''"`
+	SellerName       string `gorm:"size:255;not null;default:''"`
+	OfferID          *uint  `gorm:"index"`                     // Accepted offer the order was created from
+	Amount           int64  `gorm:"not null;check:amount > 0"` // In pence, the item and its delivery
+	DeliveryMethod   string `gorm:"size:20;not null;default:pickup"`
+	DeliveryPostcode string // Buyer's postcode, empty for pickup
+	DeliveryCost     int64  `gorm:"not null;default:0"` // In pence, included in Amount
+	Status           string `gorm:"size:20;not null;default:pending;index"`
+	PaymentProvider  string `gorm:"size:20;not null"`
+	PaymentRef       string `gorm:"index"` // Provider reference of the buyer's payment
+	CheckoutURL      string // Where the buyer completes the payment
+	PayoutRef        string
+	RefundRef        string
+	TrackingNumber   string
+	PaidAt           *time.Time
+	ShippedAt        *time.Time
+	DeliveredAt      *time.Time
+	ReleasedAt       *time.Time
+	RefundedAt       *time.Time
+	DisputedAt       *time.Time
+	DisputeReason    string `gorm:"type:text"`
+	Ad               Ad     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	Buyer            User   `gorm:"foreignKey:BuyerID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	Seller           User   `gorm:"foreignKey:SellerID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+}
+
+// CanTransitionTo reports whether the order can move from its current status to status
+func (o *Order) CanTransitionTo(status string) bool {
+	for _, allowed := range orderTransitions[o.Status] {
+		if allowed == status {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBuyer reports whether the user is the buyer of the order
+func (o *Order) IsBuyer(userID uint) bool {
+	return o.BuyerID != nil && *o.BuyerID == userID
+}
+
+// IsSeller reports whether the user is the seller of the order
+func (o *Order) IsSeller(userID uint) bool {
+	return o.SellerID != nil && *o.SellerID == userID
+}
+
+// HasParticipant reports whether the user is the buyer or seller of the order
+func (o *Order) HasParticipant(userID uint) bool {
+	return o.IsBuyer(userID) || o.IsSeller(userID)
+}
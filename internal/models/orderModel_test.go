@@ -0,0 +1,39 @@
+package models
+
+import "testing"
+
+func TestOrderCanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want bool
+	}{
+		{OrderStatusPending, OrderStatusPaid, true},
+		{OrderStatusPending, OrderStatusShipped, false},
+		{OrderStatusPending, OrderStatusRefunded, false},
+		{OrderStatusPaid, OrderStatusShipped, true},
+		{OrderStatusPaid, OrderStatusDelivered, true},
+		{OrderStatusPaid, OrderStatusDisputed, true},
+		{OrderStatusPaid, OrderStatusRefunded, true},
+		{OrderStatusPaid, OrderStatusReleased, false},
+		{OrderStatusShipped, OrderStatusDelivered, true},
+		{OrderStatusShipped, OrderStatusDisputed, true},
+		{OrderStatusShipped, OrderStatusRefunded, true},
+		{OrderStatusShipped, OrderStatusPaid, false},
+		{OrderStatusDisputed, OrderStatusDelivered, true},
+		{OrderStatusDisputed, OrderStatusRefunded, true},
+		{OrderStatusDisputed, OrderStatusReleased, false},
+		{OrderStatusDelivered, OrderStatusReleased, true},
+		{OrderStatusDelivered, OrderStatusRefunded, false},
+		{OrderStatusReleased, OrderStatusRefunded, false},
+		{OrderStatusRefunded, OrderStatusPaid, false},
+		{OrderStatusPaid, "unknown", false},
+		{"unknown", OrderStatusPaid, false},
+	}
+	for _, tt := range tests {
+		order := Order{Status: tt.from}
+		if got := order.CanTransitionTo(tt.to); got != tt.want {
+			t.Errorf("CanTransitionTo(%q -> %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
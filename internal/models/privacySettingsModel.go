@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+// Enums for contact field visibility
+const (
+	VisibilityEveryone = "everyone" // Anyone, including anonymous visitors
+	VisibilityMembers  = "members"  // Signed-in users only
+	VisibilityNobody   = "nobody"   // Only the owner
+)
+
+// Per-user privacy settings, one row per user
+type PrivacySettings struct {
+	UserID            uint   `gorm:"primarykey"`
+	CityVisibility    string `gorm:"size:20;not null;default:everyone;check:city_visibility IN ('everyone','members','nobody')"`
+	CountryVisibility string `gorm:"size:20;not null;default:everyone;check:country_visibility IN ('everyone','members','nobody')"`
+	PhoneVisibility   string `gorm:"size:20;not null;default:nobody;check:phone_visibility IN ('everyone','members','nobody')"`
+	EmailVisibility   string `gorm:"size:20;not null;default:nobody;check:email_visibility IN ('everyone','members','nobody')"`
+	AllowMessages     bool   `gorm:"not null;default:true"`
+	User              User   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+// DefaultPrivacySettings returns the settings used until a user changes them
+func DefaultPrivacySettings(userID uint) PrivacySettings {
+	return PrivacySettings{
+		UserID:            userID,
+		CityVisibility:    VisibilityEveryone,
+		CountryVisibility: VisibilityEveryone,
+		PhoneVisibility:   VisibilityNobody,
+		EmailVisibility:   VisibilityNobody,
+		AllowMessages:     true,
+	}
+}
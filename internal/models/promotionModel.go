@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+	"gorm.io/gorm"
+)
+
+// Enums for Promotion type
+const (
+	PromotionTopOfCategory = "top_of_category" // Blended at fixed positions of search results
+	PromotionHomepage      = "homepage"        // Shown in the featured ads
+	PromotionHighlight     = "highlight"       // Labelled in search results without moving
+)
+
+// PromotionTypes lists the valid values of Promotion.Type
+var PromotionTypes = []string{
+	PromotionTopOfCategory,
+	PromotionHomepage,
+	PromotionHighlight,
+}
+
+// IsPromotionType reports whether promotionType is one of PromotionTypes
+func IsPromotionType(promotionType string) bool {
+	for _, valid := range PromotionTypes {
+		if promotionType == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// Enums for Promotion status
+const (
+	PromotionStatusPendingPayment = "pending_payment" // Holds its slot until paid or the payment window ends
+	PromotionStatusScheduled      = "scheduled"
+	PromotionStatusActive         = "active"
+	PromotionStatusExpired        = "expired"
+	PromotionStatusCancelled      = "cancelled"
+)
+
+/*
+Promotion boosts an ad between StartsAt and EndsAt once paid. The scheduler activates it once it starts
+and expires it at the end, when its impression budget is spent or when the ad is no longer listed.
+*/
+type Promotion struct {
+	gorm.Model
+	AdID           uint      `gorm:"not null;index"`
+	UserID         uint      `gorm:"not null;index"`
+	Type           string    `gorm:"size:20;not null;check:type IN ('top_of_category','homepage','highlight')"`
+	CategoryID     uint      `gorm:"not null"` // Category of the ad when booked, top of category slots are per category
+	Status         string    `gorm:"size:20;not null;default:scheduled;index"`
+	StartsAt       time.Time `gorm:"not null;index"`
+	EndsAt         time.Time `gorm:"not null;index"`
+	MaxImpressions *int64    // Impression budget, unlimited when nil
+	Impressions    int64     `gorm:"not null;default:0"`
+	Cost           int64     `gorm:"not null;default:0"` // In pence
+	PaymentRef     string    `gorm:"size:100;index"`     // Provider reference of the payment
+	CheckoutURL    string    `gorm:"size:500"`
+	RefundRef      string    `gorm:"size:100"`
+	PaidAt         *time.Time
+	CancelledAt    *time.Time
+	Ad             Ad   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	User           User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
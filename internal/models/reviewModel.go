@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+	"gorm.io/gorm"
+)
+
+// Enums for the role of a reviewer in the deal
+const (
+	ReviewerRoleBuyer  = "buyer"
+	ReviewerRoleSeller = "seller"
+)
+
+/*
+Review left by the buyer or seller of a completed sale about the other party, one each per sale.
+Sales agreed through an offer are keyed by the offer, direct purchases by their order.
+*/
+type Review struct {
+	gorm.Model
+	OfferID      *uint  `gorm:"uniqueIndex:idx_reviews_offer_reviewer"`
+	OrderID      *uint  `gorm:"uniqueIndex:idx_reviews_order_reviewer"`
+	AdID         uint   `gorm:"not null;index"`
+	ReviewerID   uint   `gorm:"not null;uniqueIndex:idx_reviews_offer_reviewer;uniqueIndex:idx_reviews_order_reviewer;index"`
+	RevieweeID   uint   `gorm:"not null;index"`
+	ReviewerRole string `gorm:"size:10;not null"`
+	Rating       int    `gorm:"not null;check:rating BETWEEN 1 AND 5"`
+	Comment      string `gorm:"type:text"`
+	Reply        string `gorm:"type:text"` // Answer of the reviewee
+	RepliedAt    *time.Time
+	ReportCount  int        `gorm:"not null;default:0"`
+	HiddenAt     *time.Time `gorm:"index"` // Hidden reviews are excluded from listings and averages
+	HiddenReason string     `gorm:"size:255"`
+	Offer        Offer `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Order        Order `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Reviewer     User  `gorm:"foreignKey:ReviewerID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Reviewee     User  `gorm:"foreignKey:RevieweeID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// Review report model, one per review and reporter
+type ReviewReport struct {
+	ID         uint   `gorm:"primarykey"`
+	ReviewID   uint   `gorm:"not null;uniqueIndex:idx_review_reports_pair"`
+	ReporterID uint   `gorm:"not null;uniqueIndex:idx_review_reports_pair;index"`
+	Reason     string `gorm:"size:255;not null"`
+	Review     Review `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Reporter   User   `gorm:"foreignKey:ReporterID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CreatedAt  time.Time
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+	"gorm.io/gorm"
+)
+
+// Saved search model, empty criteria match every ad
+type SavedSearch struct {
+	gorm.Model
+	UserID        uint   `gorm:"not null;index"`
+	Name          string `gorm:"size:100;not null"`
+	Keywords      string `gorm:"size:200"`
+	CategoryID    *uint  `gorm:"index"`
+	Condition     string `gorm:"size:50"`
+	City          string `gorm:"size:100"`
+	MinPrice      *int64 // In pence
+	MaxPrice      *int64 // In pence
+	EmailAlerts   bool   `gorm:"not null;default:true"`
+	PausedAt      *time.Time // Paused searches don't collect matches
+	LastAlertedAt *time.Time // Alerts are batched to one per search per interval
+	User          User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// Ad matching a saved search, pending until the next alert for the search
+type SavedSearchMatch struct {
+	ID            uint `gorm:"primarykey"`
+	SavedSearchID uint `gorm:"not null;uniqueIndex:idx_saved_search_matches_pair"`
+	AdID          uint `gorm:"not null;uniqueIndex:idx_saved_search_matches_pair"`
+	NotifiedAt    *time.Time `gorm:"index"`
+	SavedSearch   SavedSearch `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Ad            Ad          `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CreatedAt     time.Time
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// User block model, BlockerID no longer wants to interact with BlockedID
+type UserBlock struct {
+	ID        uint `gorm:"primarykey"`
+	BlockerID uint `gorm:"not null;uniqueIndex:idx_user_blocks_pair"`
+	BlockedID uint `gorm:"not null;uniqueIndex:idx_user_blocks_pair;index"`
+	Blocker   User `gorm:"foreignKey:BlockerID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Blocked   User `gorm:"foreignKey:BlockedID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CreatedAt time.Time
+}
@@ -5,10 +5,17 @@ import (
 	"gorm.io/gorm"
 )
 
+// Enums for User roles
+const (
+	UserRoleMember    = "member"
+	UserRoleModerator = "moderator"
+)
+
 // User model
 type User struct {
 	gorm.Model
 	ProfilePictureURL string `gorm:"size:255"` // URL to the profile picture in S3
+	ProfilePictureKey string `gorm:"size:255"` // Base S3 key of the uploaded avatar, one object per size
 	FirstName         string `gorm:"not null"`
 	LastName          string `gorm:"not null"`
 	Username          string `gorm:"uniqueIndex;not null"`
@@ -17,10 +24,31 @@ type User struct {
 	PasswordResetToken  string    `gorm:"-"`
     PasswordResetExpiry time.Time `gorm:"-"`
 	PhoneNumber       string
+	PhoneVerifiedAt   *time.Time // Set once PhoneNumber has been verified by OTP
 	City              string `gorm:"size:100"`  
 	Country           string `gorm:"size:100"`  
 	Bio               string `gorm:"size:500"`  
+	DeactivatedAt     *time.Time // Set while the account is pending deletion
+	DeletionScheduledAt *time.Time `gorm:"index"` // Account is purged after this time unless restored
+	Role              string `gorm:"size:20;not null;default:member"`
+	SuspendedAt       *time.Time // Set when a moderator suspends the account
+	SuspensionReason  string `gorm:"size:255"`
 	Ads              []Ad       `gorm:"foreignKey:UserID"`
 	FavouriteAds     []Favorite `gorm:"foreignKey:UserID"`
 	CreatedAt        time.Time
 }
+
+// IsDeactivated reports whether the account is pending deletion
+func (u *User) IsDeactivated() bool {
+	return u.DeactivatedAt != nil
+}
+
+// IsSuspended reports whether a moderator suspended the account
+func (u *User) IsSuspended() bool {
+	return u.SuspendedAt != nil
+}
+
+// IsModerator reports whether the user can act on the moderation queue
+func (u *User) IsModerator() bool {
+	return u.Role == UserRoleModerator
+}
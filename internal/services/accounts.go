@@ -0,0 +1,8 @@
+package services
+
+import "gorm.io/gorm"
+
+// HideAdsOfInactiveOwners is a query scope leaving out the ads of accounts pending deletion or suspended
+func HideAdsOfInactiveOwners(db *gorm.DB) *gorm.DB {
+	return db.Where("ads.user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL OR suspended_at IS NOT NULL)")
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Ad stat counters kept in Redis
+const (
+	AdStatFavorites      = "favorites"
+	AdStatContactReveals = "contact_reveals"
+	AdStatMessages       = "messages"
+)
+
+const foreignKeyViolation = "23503" // Postgres error code
+
+const (
+	adStatsDateLayout = "2006-01-02"
+	adStatsKeyTTL     = 3 * 24 * time.Hour // Daily buckets outlive several flushes
+	adStatsDirtyKey   = "ad_stats_dirty"   // Set of "adID:date" buckets waiting to be flushed
+)
+
+func adViewsKey(adID uint, date string) string {
+	return fmt.Sprintf("ad_views:%d:%s", adID, date)
+}
+
+func adCountersKey(adID uint, date string) string {
+	return fmt.Sprintf("ad_stats:%d:%s", adID, date)
+}
+
+// RecordAdView counts a unique visitor of an ad for today. visitor identifies a user or anonymous client
+func RecordAdView(adID uint, visitor string) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	date := time.Now().UTC().Format(adStatsDateLayout)
+	key := adViewsKey(adID, date)
+	pipe := initializers.RedisClient.Pipeline()
+	pipe.PFAdd(ctx, key, visitor)
+	pipe.Expire(ctx, key, adStatsKeyTTL)
+	pipe.SAdd(ctx, adStatsDirtyKey, fmt.Sprintf("%d:%s", adID, date))
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to record view of ad %d: %v", adID, err)
+	}
+}
+
+// IncrementAdStat adds one to today's counter of an ad
+func IncrementAdStat(adID uint, counter string) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	date := time.Now().UTC().Format(adStatsDateLayout)
+	key := adCountersKey(adID, date)
+	pipe := initializers.RedisClient.Pipeline()
+	pipe.HIncrBy(ctx, key, counter, 1)
+	pipe.Expire(ctx, key, adStatsKeyTTL)
+	pipe.SAdd(ctx, adStatsDirtyKey, fmt.Sprintf("%d:%s", adID, date))
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to increment %s of ad %d: %v", counter, adID, err)
+	}
+}
+
+/*
+FlushAdStats copies the daily Redis buckets to the ad_daily_stats table. Buckets hold the
+totals of their day so flushing is idempotent, and a counter never goes down in case its
+key expired before the flush. Past days are removed from the dirty set once written,
+today's bucket stays until the day is over.
+*/
+func FlushAdStats() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	members, err := initializers.RedisClient.SMembers(ctx, adStatsDirtyKey).Result()
+	if err != nil {
+		return err
+	}
+
+	today := time.Now().UTC().Format(adStatsDateLayout)
+	for _, member := range members {
+		idPart, date, found := strings.Cut(member, ":")
+		adID, err := strconv.ParseUint(idPart, 10, 64)
+		day, dateErr := time.Parse(adStatsDateLayout, date)
+		if !found || err != nil || dateErr != nil {
+			initializers.RedisClient.SRem(ctx, adStatsDirtyKey, member)
+			continue
+		}
+
+		viewsKey, countersKey := adViewsKey(uint(adID), date), adCountersKey(uint(adID), date)
+		existing, err := initializers.RedisClient.Exists(ctx, viewsKey, countersKey).Result()
+		if err != nil {
+			return err
+		}
+		if existing == 0 {
+			// Both keys expired, whatever they held was flushed before
+			initializers.RedisClient.SRem(ctx, adStatsDirtyKey, member)
+			continue
+		}
+		views, err := initializers.RedisClient.PFCount(ctx, viewsKey).Result()
+		if err != nil {
+			return err
+		}
+		counters, err := initializers.RedisClient.HGetAll(ctx, countersKey).Result()
+		if err != nil {
+			return err
+		}
+		count := func(field string) int64 {
+			value, _ := strconv.ParseInt(counters[field], 10, 64)
+			return value
+		}
+
+		stat := models.AdDailyStat{
+			AdID:           uint(adID),
+			Date:           day,
+			Views:          views,
+			Favorites:      count(AdStatFavorites),
+			ContactReveals: count(AdStatContactReveals),
+			Messages:       count(AdStatMessages),
+		}
+		if err := initializers.DB.Omit("Ad").Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "ad_id"}, {Name: "date"}},
+			DoUpdates: clause.Set{
+				{Column: clause.Column{Name: "views"}, Value: gorm.Expr("GREATEST(ad_daily_stats.views, EXCLUDED.views)")},
+				{Column: clause.Column{Name: "favorites"}, Value: gorm.Expr("GREATEST(ad_daily_stats.favorites, EXCLUDED.favorites)")},
+				{Column: clause.Column{Name: "contact_reveals"}, Value: gorm.Expr("GREATEST(ad_daily_stats.contact_reveals, EXCLUDED.contact_reveals)")},
+				{Column: clause.Column{Name: "messages"}, Value: gorm.Expr("GREATEST(ad_daily_stats.messages, EXCLUDED.messages)")},
+				{Column: clause.Column{Name: "updated_at"}, Value: gorm.Expr("EXCLUDED.updated_at")},
+			},
+		}).Create(&stat).Error; err != nil {
+			log.Printf("Failed to flush stats of ad %d for %s: %v", adID, date, err)
+			// Ads deleted since the event fail the foreign key, drop their buckets. Other failures are retried
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+				initializers.RedisClient.SRem(ctx, adStatsDirtyKey, member)
+			}
+			continue
+		}
+
+		if date != today {
+			initializers.RedisClient.SRem(ctx, adStatsDirtyKey, member)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package services
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// AdLifetime reads AD_LIFETIME_DAYS, the time an ad stays listed, defaulting to 60 days
+func AdLifetime() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("AD_LIFETIME_DAYS"))
+	if err != nil || days < 1 {
+		days = 60
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
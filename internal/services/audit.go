@@ -0,0 +1,49 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+)
+
+// Audit actions
+const (
+	AuditAccountDeletionRequested = "account.deletion_requested"
+	AuditAccountRestored          = "account.restored"
+	AuditAccountPurged            = "account.purged"
+	AuditReviewHidden             = "review.hidden"
+	AuditReviewUnhidden           = "review.unhidden"
+	AuditCaseClaimed              = "moderation_case.claimed"
+	AuditCaseResolved             = "moderation_case.resolved"
+	AuditCaseDismissed            = "moderation_case.dismissed"
+	AuditContentHidden            = "content.hidden"
+	AuditUserSuspended            = "user.suspended"
+	AuditUserUnsuspended          = "user.unsuspended"
+	AuditOrderReleased            = "order.released"
+	AuditOrderRefunded            = "order.refunded"
+	AuditOrderDisputed            = "order.disputed"
+	AuditDisputeResolved          = "order.dispute_resolved"
+)
+
+// Audit records an action in the audit log. actorID is nil for system actions
+func Audit(action string, actorID *uint, targetType string, targetID uint, details map[string]interface{}) {
+	detailsJSON := []byte("{}")
+	if details != nil {
+		if encoded, err := json.Marshal(details); err == nil {
+			detailsJSON = encoded
+		}
+	}
+
+	entry := models.AuditLog{
+		Action:     action,
+		ActorID:    actorID,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    string(detailsJSON),
+	}
+	if err := initializers.DB.Create(&entry).Error; err != nil {
+		log.Printf("Failed to write audit log %s for %s %d: %v", action, targetType, targetID, err)
+	}
+}
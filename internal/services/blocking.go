@@ -0,0 +1,44 @@
+package services
+
+import (
+	"log"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"gorm.io/gorm"
+)
+
+// IsBlocked reports whether either user has blocked the other
+func IsBlocked(userA, userB uint) bool {
+	var count int64
+	if err := initializers.DB.Model(&models.UserBlock{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", userA, userB, userB, userA).
+		Count(&count).Error; err != nil {
+		// Fail closed, an interaction can be retried but harassment can't be undone
+		log.Printf("Failed to check block between users %d and %d: %v", userA, userB, err)
+		return true
+	}
+	return count > 0
+}
+
+// HasBlocked reports whether blocker has blocked blocked, failing closed like IsBlocked
+func HasBlocked(blocker, blocked uint) bool {
+	var count int64
+	if err := initializers.DB.Model(&models.UserBlock{}).
+		Where("blocker_id = ? AND blocked_id = ?", blocker, blocked).
+		Count(&count).Error; err != nil {
+		log.Printf("Failed to check block of user %d by user %d: %v", blocked, blocker, err)
+		return true
+	}
+	return count > 0
+}
+
+// HideAdsOfBlockers is a query scope leaving out the ads of users who blocked the viewer
+func HideAdsOfBlockers(viewerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewerID == 0 {
+			return db
+		}
+		return db.Where("ads.user_id NOT IN (SELECT blocker_id FROM user_blocks WHERE blocked_id = ?)", viewerID)
+	}
+}
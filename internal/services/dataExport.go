@@ -0,0 +1,420 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"gorm.io/gorm"
+)
+
+const DataExportLinkExpiry = 24 * time.Hour // Lifetime of the download links of an archive
+
+/*
+ExportSection produces one JSON file of a user's data export.
+New features holding personal data register a section in exportSections.
+*/
+type ExportSection struct {
+	File    string
+	Collect func(userID uint) (interface{}, error)
+}
+
+var exportSections = []ExportSection{
+	{File: "account.json", Collect: exportAccount},
+	{File: "ads.json", Collect: exportAds},
+	{File: "favorites.json", Collect: exportFavorites},
+	{File: "login_history.json", Collect: exportLoginHistory},
+	{File: "privacy_settings.json", Collect: exportPrivacySettings},
+	{File: "messages.json", Collect: exportMessages},
+	{File: "offers.json", Collect: exportOffers},
+	{File: "reviews.json", Collect: exportReviews},
+	{File: "reports.json", Collect: exportReports},
+	{File: "saved_searches.json", Collect: exportSavedSearches},
+	{File: "blocked_users.json", Collect: exportBlockedUsers},
+	{File: "promotions.json", Collect: exportPromotions},
+	{File: "orders.json", Collect: exportOrders},
+	{File: "contact_reveals.json", Collect: exportContactReveals},
+}
+
+// BuildDataExport collects every export section and the user's uploaded media into a ZIP archive
+func BuildDataExport(userID uint) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	for _, section := range exportSections {
+		data, err := section.Collect(userID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", section.File, err)
+		}
+
+		file, err := archive.Create(section.File)
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", section.File, err)
+		}
+	}
+
+	// Uploaded media, stored under media/ with their original key layout
+	for _, prefix := range userMediaPrefixes(userID) {
+		keys, err := ListObjectKeys(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("media: %w", err)
+		}
+		for _, key := range keys {
+			data, err := GetObject(key)
+			if err != nil {
+				return nil, fmt.Errorf("media %s: %w", key, err)
+			}
+			file, err := archive.Create(path.Join("media", key))
+			if err != nil {
+				return nil, err
+			}
+			if _, err := file.Write(data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// userMediaPrefixes lists the S3 prefixes holding a user's uploaded media
+func userMediaPrefixes(userID uint) []string {
+	return []string{
+		fmt.Sprintf("avatars/%d/", userID),
+	}
+}
+
+// UserStoragePrefixes lists every S3 prefix holding files of a user, including data exports
+func UserStoragePrefixes(userID uint) []string {
+	return append(userMediaPrefixes(userID), fmt.Sprintf("exports/%d/", userID))
+}
+
+func exportAccount(userID uint) (interface{}, error) {
+	var user models.User
+	if err := initializers.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	// Everything except credentials
+	return map[string]interface{}{
+		"id":                user.ID,
+		"username":          user.Username,
+		"email":             user.Email,
+		"first_name":        user.FirstName,
+		"last_name":         user.LastName,
+		"phone_number":      user.PhoneNumber,
+		"phone_verified_at": user.PhoneVerifiedAt,
+		"city":              user.City,
+		"country":           user.Country,
+		"bio":               user.Bio,
+		"profile_picture":   user.ProfilePictureKey,
+		"created_at":        user.CreatedAt,
+		"updated_at":        user.UpdatedAt,
+		"exported_at":       time.Now(),
+	}, nil
+}
+
+func exportAds(userID uint) (interface{}, error) {
+	var ads []models.Ad
+	if err := initializers.DB.Where("user_id = ?", userID).Order("created_at").Find(&ads).Error; err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]interface{}, 0, len(ads))
+	for _, ad := range ads {
+		rows = append(rows, map[string]interface{}{
+			"id":                   ad.ID,
+			"title":                ad.Title,
+			"description":          ad.Description,
+			"category_id":          ad.CategoryID,
+			"condition":            ad.Condition,
+			"price":                ad.Price,
+			"city":                 ad.City,
+			"postcode":             ad.Postcode,
+			"pickup_available":     ad.PickupAvailable,
+			"local_delivery_km":    ad.LocalDeliveryKm,
+			"local_delivery_price": ad.LocalDeliveryPrice,
+			"parcel_size":          ad.ParcelSize,
+			"phone_number":         ad.PhoneNumber,
+			"email_address":        ad.EmailAddress,
+			"status":               ad.Status,
+			"sold_at":              ad.SoldAt,
+			"expires_at":           ad.ExpiresAt,
+			"created_at":           ad.CreatedAt,
+			"updated_at":           ad.UpdatedAt,
+		})
+	}
+	return rows, nil
+}
+
+func exportFavorites(userID uint) (interface{}, error) {
+	var favorites []models.Favorite
+	if err := initializers.DB.Where("user_id = ?", userID).Order("created_at").Find(&favorites).Error; err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]interface{}, 0, len(favorites))
+	for _, favorite := range favorites {
+		rows = append(rows, map[string]interface{}{
+			"ad_id":          favorite.AdID,
+			"alerts_enabled": favorite.AlertsEnabled,
+			"created_at":     favorite.CreatedAt,
+		})
+	}
+	return rows, nil
+}
+
+func exportLoginHistory(userID uint) (interface{}, error) {
+	var entries []models.LoginHistory
+	if err := initializers.DB.Where("user_id = ?", userID).Order("created_at").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		rows = append(rows, map[string]interface{}{
+			"success":        entry.Success,
+			"failure_reason": entry.FailureReason,
+			"ip":             entry.IP,
+			"user_agent":     entry.UserAgent,
+			"device":         entry.Device,
+			"browser":        entry.Browser,
+			"os":             entry.OS,
+			"country":        entry.Country,
+			"city":           entry.City,
+			"created_at":     entry.CreatedAt,
+		})
+	}
+	return rows, nil
+}
+
+func exportPrivacySettings(userID uint) (interface{}, error) {
+	settings := PrivacyFor(userID)
+	return map[string]interface{}{
+		"city_visibility":    settings.CityVisibility,
+		"country_visibility": settings.CountryVisibility,
+		"phone_visibility":   settings.PhoneVisibility,
+		"email_visibility":   settings.EmailVisibility,
+		"allow_messages":     settings.AllowMessages,
+	}, nil
+}
+
+func exportMessages(userID uint) (interface{}, error) {
+	var conversations []models.Conversation
+	if err := initializers.DB.Preload("Messages", func(db *gorm.DB) *gorm.DB { return db.Order("created_at") }).
+		Where("buyer_id = ? OR seller_id = ?", userID, userID).
+		Order("created_at").
+		Find(&conversations).Error; err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]interface{}, 0, len(conversations))
+	for _, conversation := range conversations {
+		messages := make([]map[string]interface{}, 0, len(conversation.Messages))
+		for _, message := range conversation.Messages {
+			messages = append(messages, map[string]interface{}{
+				"sent_by_me": message.SenderID == userID,
+				"body":       message.Body,
+				"read_at":    message.ReadAt,
+				"created_at": message.CreatedAt,
+			})
+		}
+		role := "seller"
+		if conversation.BuyerID == userID {
+			role = "buyer"
+		}
+		rows = append(rows, map[string]interface{}{
+			"ad_id":      conversation.AdID,
+			"role":       role,
+			"created_at": conversation.CreatedAt,
+			"messages":   messages,
+		})
+	}
+	return rows, nil
+}
+
+func exportOffers(userID uint) (interface{}, error) {
+	var offers []models.Offer
+	if err := initializers.DB.Where("buyer_id = ? OR seller_id = ?", userID, userID).Order("created_at").Find(&offers).Error; err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]interface{}, 0, len(offers))
+	for _, offer := range offers {
+		role := "seller"
+		if offer.BuyerID == userID {
+			role = "buyer"
+		}
+		rows = append(rows, map[string]interface{}{
+			"ad_id":             offer.AdID,
+			"role":              role,
+			"made_by_me":        offer.ProposerID == userID,
+			"amount":            offer.Amount,
+			"delivery_method":   offer.DeliveryMethod,
+			"delivery_postcode": offer.DeliveryPostcode,
+			"delivery_cost":     offer.DeliveryCost,
+			"status":            offer.Status,
+			"expires_at":        offer.ExpiresAt,
+			"responded_at":      offer.RespondedAt,
+			"completed_at":      offer.CompletedAt,
+			"created_at":        offer.CreatedAt,
+		})
+	}
+	return rows, nil
+}
+
+func exportReviews(userID uint) (interface{}, error) {
+	var reviews []models.Review
+	if err := initializers.DB.Where("reviewer_id = ? OR reviewee_id = ?", userID, userID).Order("created_at").Find(&reviews).Error; err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]interface{}, 0, len(reviews))
+	for _, review := range reviews {
+		rows = append(rows, map[string]interface{}{
+			"ad_id":         review.AdID,
+			"written_by_me": review.ReviewerID == userID,
+			"rating":        review.Rating,
+			"comment":       review.Comment,
+			"reply":         review.Reply,
+			"replied_at":    review.RepliedAt,
+			"hidden":        review.HiddenAt != nil,
+			"created_at":    review.CreatedAt,
+		})
+	}
+	return rows, nil
+}
+
+func exportReports(userID uint) (interface{}, error) {
+	var reports []models.Report
+	if err := initializers.DB.Where("reporter_id = ?", userID).Order("created_at").Find(&reports).Error; err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]interface{}, 0, len(reports))
+	for _, report := range reports {
+		rows = append(rows, map[string]interface{}{
+			"target_type": report.TargetType,
+			"target_id":   report.TargetID,
+			"reason_code": report.ReasonCode,
+			"details":     report.Details,
+			"created_at":  report.CreatedAt,
+		})
+	}
+	return rows, nil
+}
+
+func exportSavedSearches(userID uint) (interface{}, error) {
+	var searches []models.SavedSearch
+	if err := initializers.DB.Where("user_id = ?", userID).Order("created_at").Find(&searches).Error; err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]interface{}, 0, len(searches))
+	for _, search := range searches {
+		rows = append(rows, map[string]interface{}{
+			"name":         search.Name,
+			"keywords":     search.Keywords,
+			"category_id":  search.CategoryID,
+			"condition":    search.Condition,
+			"city":         search.City,
+			"min_price":    search.MinPrice,
+			"max_price":    search.MaxPrice,
+			"email_alerts": search.EmailAlerts,
+			"paused_at":    search.PausedAt,
+			"created_at":   search.CreatedAt,
+		})
+	}
+	return rows, nil
+}
+
+func exportBlockedUsers(userID uint) (interface{}, error) {
+	var blocks []models.UserBlock
+	if err := initializers.DB.Where("blocker_id = ?", userID).Order("created_at").Find(&blocks).Error; err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]interface{}, 0, len(blocks))
+	for _, block := range blocks {
+		rows = append(rows, map[string]interface{}{
+			"user_id":    block.BlockedID,
+			"blocked_at": block.CreatedAt,
+		})
+	}
+	return rows, nil
+}
+
+func exportPromotions(userID uint) (interface{}, error) {
+	var promotions []models.Promotion
+	if err := initializers.DB.Where("user_id = ?", userID).Order("created_at").Find(&promotions).Error; err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]interface{}, 0, len(promotions))
+	for _, promotion := range promotions {
+		rows = append(rows, map[string]interface{}{
+			"ad_id":           promotion.AdID,
+			"type":            promotion.Type,
+			"status":          promotion.Status,
+			"starts_at":       promotion.StartsAt,
+			"ends_at":         promotion.EndsAt,
+			"max_impressions": promotion.MaxImpressions,
+			"impressions":     promotion.Impressions,
+			"cost":            promotion.Cost,
+			"created_at":      promotion.CreatedAt,
+		})
+	}
+	return rows, nil
+}
+
+func exportOrders(userID uint) (interface{}, error) {
+	var orders []models.Order
+	if err := initializers.DB.Where("buyer_id = ? OR seller_id = ?", userID, userID).Order("created_at").Find(&orders).Error; err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]interface{}, 0, len(orders))
+	for _, order := range orders {
+		role := "buyer"
+		if order.IsSeller(userID) {
+			role = "seller"
+		}
+		row := OrderData(order)
+		row["role"] = role
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// exportContactReveals lists the sellers' contact details the user revealed, not the reveals of their own ads
+func exportContactReveals(userID uint) (interface{}, error) {
+	var reveals []models.ContactReveal
+	if err := initializers.DB.Where("viewer_id = ?", userID).Order("created_at").Find(&reveals).Error; err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]interface{}, 0, len(reveals))
+	for _, reveal := range reveals {
+		rows = append(rows, map[string]interface{}{
+			"ad_id":             reveal.AdID,
+			"ip":                reveal.IP,
+			"reveal_count":      reveal.RevealCount,
+			"first_revealed_at": reveal.CreatedAt,
+			"last_revealed_at":  reveal.LastRevealedAt,
+		})
+	}
+	return rows, nil
+}
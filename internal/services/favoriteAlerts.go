@@ -0,0 +1,78 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+)
+
+/*
+NotifyFavoriters alerts every user who favorited the ad with alerts enabled.
+dedupKey identifies the change, such as the new price, so each user hears about it once.
+The ad owner, the users in exclude and users blocked either way by the owner are never alerted.
+*/
+func NotifyFavoriters(ad models.Ad, kind, dedupKey, message string, exclude ...uint) {
+	var recipients []struct {
+		UserID    uint
+		Email     string
+		FirstName string
+	}
+	if err := initializers.DB.Raw(`
+		WITH inserted AS (
+			INSERT INTO favorite_alerts (user_id, ad_id, kind, dedup_key, created_at)
+			SELECT f.user_id, f.ad_id, ?, ?, NOW() FROM favorites f
+			WHERE f.ad_id = ? AND f.alerts_enabled AND f.deleted_at IS NULL AND f.user_id NOT IN ?
+			AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE (b.blocker_id = ? AND b.blocked_id = f.user_id) OR (b.blocker_id = f.user_id AND b.blocked_id = ?))
+			ON CONFLICT DO NOTHING
+			RETURNING user_id
+		)
+		SELECT u.id AS user_id, u.email, u.first_name FROM inserted JOIN users u ON u.id = inserted.user_id
+		WHERE u.deactivated_at IS NULL AND u.suspended_at IS NULL`,
+		kind, dedupKey, ad.ID, append(exclude, ad.UserID), ad.UserID, ad.UserID).
+		Scan(&recipients).Error; err != nil {
+		log.Printf("Failed to create %s alerts for ad %d: %v", kind, ad.ID, err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/ads/%d", os.Getenv("APP_BASE_URL"), ad.ID)
+	for _, recipient := range recipients {
+		PublishEvent(recipient.UserID, EventFavoriteAd, map[string]interface{}{
+			"ad_id":   ad.ID,
+			"kind":    kind,
+			"message": message,
+			"price":   ad.Price,
+			"status":  ad.Status,
+		}, true)
+		SendEmailAsync(recipient.Email, fmt.Sprintf("Update on \"%s\"", ad.Title), EmailBody(
+			fmt.Sprintf("Hi %s,", recipient.FirstName),
+			"",
+			message,
+			"",
+			link,
+			"",
+			"You can turn off alerts for this item in your favorites.",
+		))
+	}
+}
+
+// NotifyAdStatusChange alerts favoriters other than the buyer when an ad becomes reserved or sold
+func NotifyAdStatusChange(ad models.Ad, buyerID uint) {
+	switch ad.Status {
+	case models.AdStatusReserved:
+		NotifyFavoriters(ad, models.FavoriteAlertReserved, models.AdStatusReserved,
+			fmt.Sprintf("\"%s\" from your favorites has been reserved for another buyer.", ad.Title), buyerID)
+	case models.AdStatusSold:
+		NotifyFavoriters(ad, models.FavoriteAlertSold, models.AdStatusSold,
+			fmt.Sprintf("\"%s\" from your favorites has been sold.", ad.Title), buyerID)
+	}
+}
+
+// ClearFavoriteAlerts forgets the alerts of a kind sent about an ad, so the same change is notified again
+func ClearFavoriteAlerts(adID uint, kind string) {
+	if err := initializers.DB.Where("ad_id = ? AND kind = ?", adID, kind).Delete(&models.FavoriteAlert{}).Error; err != nil {
+		log.Printf("Failed to clear %s alerts of ad %d: %v", kind, adID, err)
+	}
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"os"
+	"sort"
+)
+
+// Location is an approximate location resolved from an IP address
+type Location struct {
+	Country string `json:"country"`
+	City    string `json:"city"`
+}
+
+type geoRange struct {
+	start    netip.Addr
+	end      netip.Addr
+	location Location
+}
+
+var geoRanges []geoRange // Sorted by start address
+
+/*
+InitGeoIP loads the offline GeoIP database configured by GEOIP_DB_FILE.
+The file is a CSV of "start_ip,end_ip,country,city" rows with non-overlapping ranges,
+for example an export of the free DB-IP "IP to City Lite" dataset.
+Lookups return an empty Location when no database is configured.
+*/
+func InitGeoIP() {
+	path := os.Getenv("GEOIP_DB_FILE")
+	if path == "" {
+		log.Println("GEOIP_DB_FILE not set, login locations will not be resolved")
+		return
+	}
+
+	ranges, err := loadGeoRanges(path)
+	if err != nil {
+		log.Printf("Failed to load GeoIP database: %v", err)
+		return
+	}
+
+	geoRanges = ranges
+	log.Printf("GeoIP database loaded successfully (%d ranges)", len(geoRanges))
+}
+
+func loadGeoRanges(path string) ([]geoRange, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	var ranges []geoRange
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("line %d: expected at least 3 columns", line)
+		}
+
+		start, errStart := netip.ParseAddr(record[0])
+		end, errEnd := netip.ParseAddr(record[1])
+		if errStart != nil || errEnd != nil {
+			continue // Skip headers and malformed rows
+		}
+
+		r := geoRange{start: start.Unmap(), end: end.Unmap(), location: Location{Country: record[2]}}
+		if len(record) > 3 {
+			r.location.City = record[3]
+		}
+		ranges = append(ranges, r)
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].start.Less(ranges[j].start)
+	})
+	return ranges, nil
+}
+
+// LookupIP returns the approximate location of an IP address
+func LookupIP(ip string) Location {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || len(geoRanges) == 0 {
+		return Location{}
+	}
+	addr = addr.Unmap()
+
+	// Find the last range starting at or before addr
+	i := sort.Search(len(geoRanges), func(i int) bool {
+		return addr.Less(geoRanges[i].start)
+	}) - 1
+	if i < 0 {
+		return Location{}
+	}
+
+	r := geoRanges[i]
+	if r.start.BitLen() != addr.BitLen() || r.end.Less(addr) {
+		return Location{}
+	}
+	return r.location
+}
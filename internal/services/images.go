@@ -0,0 +1,190 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net/http"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrUnsupportedImage = errors.New("unsupported image type, use JPEG, PNG, GIF or WebP")
+	ErrImageTooSmall    = errors.New("image is too small")
+)
+
+// Image types accepted for upload, detected from content rather than the file name
+var allowedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+const (
+	minImageSide  = 64
+	maxImagePixel = 40_000_000 // Reject decompression bombs before decoding
+	jpegQuality   = 85
+)
+
+/*
+ProcessSquareImage validates an uploaded image, applies its EXIF orientation, crops it
+to a centred square and encodes one JPEG per requested size. Re-encoding drops all
+metadata, including EXIF location data.
+*/
+func ProcessSquareImage(data []byte, sizes []int) (map[int][]byte, error) {
+	if !allowedImageTypes[http.DetectContentType(data)] {
+		return nil, ErrUnsupportedImage
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width*config.Height > maxImagePixel {
+		return nil, fmt.Errorf("image dimensions %dx%d are too large", config.Width, config.Height)
+	}
+	if config.Width < minImageSide || config.Height < minImageSide {
+		return nil, ErrImageTooSmall
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	orientation := jpegOrientation(data)
+
+	// Centre crop to a square. The crop is the same in any orientation, so outputs are oriented after scaling
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	x0 := bounds.Min.X + (bounds.Dx()-side)/2
+	y0 := bounds.Min.Y + (bounds.Dy()-side)/2
+	crop := image.Rect(x0, y0, x0+side, y0+side)
+
+	outputs := make(map[int][]byte, len(sizes))
+	for _, size := range sizes {
+		target := min(size, side) // Never upscale
+		dst := image.NewRGBA(image.Rect(0, 0, target, target))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, draw.Src, nil)
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, applyOrientation(dst, orientation), &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+		outputs[size] = buf.Bytes()
+	}
+	return outputs, nil
+}
+
+// jpegOrientation reads the EXIF orientation tag (1-8) of a JPEG, defaulting to 1
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			return 1 // Start of scan, or a corrupt segment
+		}
+
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for e := 0; e < entries; e++ {
+		entry := offset + 2 + e*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			value := int(order.Uint16(tiff[entry+8:]))
+			if value >= 1 && value <= 8 {
+				return value
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+/*
+applyOrientation rotates and flips an image so that orientation 1 is upright.
+Pixels are copied between the Pix slices directly, avoiding the per-pixel At/Set interface calls.
+*/
+func applyOrientation(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w // Orientations 5-8 swap width and height
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+w*4]
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirror horizontal
+				dx, dy = w-1-x, y
+			case 3: // Rotate 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // Mirror vertical
+				dx, dy = x, h-1-y
+			case 5: // Mirror horizontal and rotate 270 CW
+				dx, dy = y, x
+			case 6: // Rotate 90 CW
+				dx, dy = h-1-y, x
+			case 7: // Mirror horizontal and rotate 90 CW
+				dx, dy = h-1-y, w-1-x
+			case 8: // Rotate 270 CW
+				dx, dy = y, w-1-x
+			}
+			offset := dy*dst.Stride + dx*4
+			copy(dst.Pix[offset:offset+4], row[x*4:x*4+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestApplyOrientation(t *testing.T) {
+	// 3x2 image whose pixels are numbered by position:
+	//   0 1 2
+	//   3 4 5
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i := 0; i < 6; i++ {
+		src.Set(i%3, i/3, color.RGBA{R: uint8(i), A: 255})
+	}
+
+	tests := []struct {
+		orientation int
+		width       int
+		want        []uint8 // Pixel numbers of the result, row by row
+	}{
+		{1, 3, []uint8{0, 1, 2, 3, 4, 5}},
+		{2, 3, []uint8{2, 1, 0, 5, 4, 3}},
+		{3, 3, []uint8{5, 4, 3, 2, 1, 0}},
+		{4, 3, []uint8{3, 4, 5, 0, 1, 2}},
+		{5, 2, []uint8{0, 3, 1, 4, 2, 5}},
+		{6, 2, []uint8{3, 0, 4, 1, 5, 2}},
+		{7, 2, []uint8{5, 2, 4, 1, 3, 0}},
+		{8, 2, []uint8{2, 5, 1, 4, 0, 3}},
+	}
+	for _, tt := range tests {
+		got := applyOrientation(src, tt.orientation)
+		if got.Bounds().Dx() != tt.width || got.Bounds().Dy() != 6/tt.width {
+			t.Errorf("orientation %d: size %v", tt.orientation, got.Bounds())
+			continue
+		}
+		for i, want := range tt.want {
+			x, y := i%tt.width, i/tt.width
+			if r := got.RGBAAt(x, y).R; r != want {
+				t.Errorf("orientation %d: pixel (%d,%d) = %d, want %d", tt.orientation, x, y, r, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+)
+
+// Failure reasons stored with unsuccessful login attempts
+const (
+	LoginFailureBadPassword = "invalid_password"
+)
+
+/*
+RecordLogin persists a login attempt with its parsed device and approximate location.
+Successful logins from a device or location not previously seen for the user
+trigger a notification email. The user's very first login never notifies.
+It runs in the background so signins never wait on it, failures are only logged.
+*/
+func RecordLogin(user models.User, success bool, failureReason, ip, userAgent string) {
+	go recordLogin(user, success, failureReason, ip, userAgent)
+}
+
+func recordLogin(user models.User, success bool, failureReason, ip, userAgent string) {
+	device := ParseUserAgent(userAgent)
+	location := LookupIP(ip)
+
+	entry := models.LoginHistory{
+		UserID:        user.ID,
+		Success:       success,
+		FailureReason: failureReason,
+		IP:            ip,
+		UserAgent:     truncate(userAgent, 512),
+		Device:        truncate(device.Device, 50),
+		Browser:       truncate(device.Browser, 50),
+		OS:            truncate(device.OS, 50),
+		Country:       truncate(location.Country, 100),
+		City:          truncate(location.City, 100),
+	}
+
+	unfamiliar := success && isUnfamiliarLogin(user.ID, device, location)
+
+	if err := initializers.DB.Create(&entry).Error; err != nil {
+		log.Printf("Failed to record login for user %d: %v", user.ID, err)
+		return
+	}
+
+	if unfamiliar {
+		SendEmailAsync(user.Email, "New sign-in to your Grabit account", newDeviceEmail(user, entry))
+	}
+}
+
+// isUnfamiliarLogin compares a login with the user's previous successful ones in a single query
+func isUnfamiliarLogin(userID uint, device DeviceInfo, location Location) bool {
+	var counts struct {
+		Previous     int64
+		SameDevice   int64
+		SameLocation int64
+	}
+	if err := initializers.DB.Model(&models.LoginHistory{}).
+		Select("COUNT(*) AS previous, "+
+			"COUNT(*) FILTER (WHERE device = ? AND browser = ? AND os = ?) AS same_device, "+
+			"COUNT(*) FILTER (WHERE country = ? AND city = ?) AS same_location",
+			device.Device, device.Browser, device.OS, location.Country, location.City).
+		Where("user_id = ? AND success = ?", userID, true).
+		Scan(&counts).Error; err != nil {
+		log.Printf("Failed to compare login of user %d: %v", userID, err)
+		return false
+	}
+	if counts.Previous == 0 {
+		return false
+	}
+	if counts.SameDevice == 0 {
+		return true
+	}
+
+	// Unknown locations can't be compared
+	return location.Country != "" && counts.SameLocation == 0
+}
+
+func newDeviceEmail(user models.User, entry models.LoginHistory) string {
+	where := "an unknown location"
+	if entry.Country != "" {
+		where = entry.Country
+		if entry.City != "" {
+			where = entry.City + ", " + entry.Country
+		}
+	}
+
+	return EmailBody(
+		fmt.Sprintf("Hi %s,", user.FirstName),
+		"",
+		"We noticed a sign-in to your account from a new device or location:",
+		fmt.Sprintf("  Device: %s, %s on %s", entry.Device, entry.Browser, entry.OS),
+		fmt.Sprintf("  Location: %s (IP %s)", where, entry.IP),
+		fmt.Sprintf("  Time: %s", entry.CreatedAt.UTC().Format(time.RFC1123)),
+		"",
+		"If this was you, no action is needed. Otherwise, reset your password and sign out of your other sessions.",
+	)
+}
+
+// truncate shortens value to max characters, dropping invalid UTF-8 that Postgres would reject
+func truncate(value string, max int) string {
+	value = strings.ToValidUTF8(value, "")
+	count := 0
+	for i := range value {
+		if count == max {
+			return value[:i]
+		}
+		count++
+	}
+	return value
+}
@@ -0,0 +1,25 @@
+package services
+
+import "testing"
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		value string
+		max   int
+		want  string
+	}{
+		{"Mozilla", 10, "Mozilla"},
+		{"Mozilla", 7, "Mozilla"},
+		{"Mozilla", 3, "Moz"},
+		{"São Paulo", 2, "Sã"}, // Cut after the multi-byte rune, not inside it
+		{"São Paulo", 3, "São"},
+		{"日本語", 2, "日本"},
+		{"ab\xffcd", 3, "abc"}, // Invalid UTF-8 is dropped
+		{"", 5, ""},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.value, tt.max); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.value, tt.max, got, tt.want)
+		}
+	}
+}
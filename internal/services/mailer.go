@@ -0,0 +1,88 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// Mailer sends plain-text emails
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// LogMailer writes emails to the log instead of sending them, for development and tests
+type LogMailer struct{}
+
+func (LogMailer) Send(to, subject, body string) error {
+	log.Printf("Email to %s | %s\n%s", to, subject, body)
+	return nil
+}
+
+// SMTPMailer sends emails through an SMTP relay
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	msg := strings.Join([]string{
+		"From: " + m.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{to}, []byte(msg))
+}
+
+var Mail Mailer = LogMailer{} // Active mailer
+
+func InitMailer() {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		log.Println("SMTP_HOST not set, emails will be logged instead of sent")
+		return
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	Mail = &SMTPMailer{
+		Host:     host,
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+	log.Println("SMTP mailer initialized successfully")
+}
+
+// SendEmailAsync sends an email in the background and logs failures
+func SendEmailAsync(to, subject, body string) {
+	go func() {
+		if err := Mail.Send(to, subject, body); err != nil {
+			log.Printf("Failed to send email %q to %s: %v", subject, to, err)
+		}
+	}()
+}
+
+// EmailBody formats the lines of an email and signs it from the team
+func EmailBody(lines ...string) string {
+	return fmt.Sprintf("%s\n\n— The Grabit team", strings.Join(lines, "\n"))
+}
@@ -0,0 +1,26 @@
+package services
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const maskRune = "•"
+
+// MaskPhoneNumber keeps the international prefix and the last two digits: +44•••••••23
+func MaskPhoneNumber(phone string) string {
+	if len(phone) <= 5 {
+		return strings.Repeat(maskRune, len(phone))
+	}
+	return phone[:3] + strings.Repeat(maskRune, len(phone)-5) + phone[len(phone)-2:]
+}
+
+// MaskEmail keeps the first character of the local part and the domain: j•••@example.com
+func MaskEmail(email string) string {
+	local, domain, found := strings.Cut(email, "@")
+	if !found || local == "" {
+		return strings.Repeat(maskRune, 3)
+	}
+	first, _ := utf8.DecodeRuneInString(local)
+	return string(first) + strings.Repeat(maskRune, 3) + "@" + domain
+}
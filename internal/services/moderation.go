@@ -0,0 +1,134 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+/*
+ReportReasons maps every report reason code to its weight in a case's priority,
+so a single scam report is looked at before several spam reports.
+*/
+var ReportReasons = map[string]int{
+	"scam":            10,
+	"prohibited_item": 8,
+	"counterfeit":     7,
+	"harassment":      6,
+	"offensive":       5,
+	"spam":            3,
+	"wrong_category":  1,
+	"other":           2,
+}
+
+// FileReport stores a report and adds it to the target's active moderation case, opening one if needed
+func FileReport(report *models.Report) (bool, error) {
+	created := false
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(report)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error // Reporting the same target twice is a no-op
+		}
+		created = true
+
+		weight := ReportReasons[report.ReasonCode]
+		moderationCase := models.ModerationCase{
+			TargetType:  report.TargetType,
+			TargetID:    report.TargetID,
+			Status:      models.CaseStatusOpen,
+			Priority:    weight,
+			ReportCount: 1,
+		}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:     []clause.Column{{Name: "target_type"}, {Name: "target_id"}},
+			TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "status IN ('open','claimed')"}}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"priority":     gorm.Expr("moderation_cases.priority + ?", weight),
+				"report_count": gorm.Expr("moderation_cases.report_count + 1"),
+				"updated_at":   time.Now(),
+			}),
+		}, clause.Returning{}).Create(&moderationCase).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(report).Update("case_id", moderationCase.ID).Error
+	})
+	return created, err
+}
+
+// ReportTargetOwner returns the user responsible for a reported target
+func ReportTargetOwner(targetType string, targetID uint) (uint, error) {
+	switch targetType {
+	case models.ReportTargetAd:
+		var ad models.Ad
+		err := initializers.DB.Unscoped().Select("user_id").First(&ad, targetID).Error
+		return ad.UserID, err
+	case models.ReportTargetMessage:
+		var message models.Message
+		err := initializers.DB.Unscoped().Select("sender_id").First(&message, targetID).Error
+		return message.SenderID, err
+	case models.ReportTargetUser:
+		return targetID, nil
+	}
+	return 0, errors.New("unknown report target")
+}
+
+// HideReportTarget removes a reported ad or message from public view. Users are suspended instead
+func HideReportTarget(targetType string, targetID uint, actorID uint) error {
+	var err error
+	switch targetType {
+	case models.ReportTargetAd:
+		err = initializers.DB.Model(&models.Ad{}).Where("id = ?", targetID).Update("status", models.AdStatusRemoved).Error
+	case models.ReportTargetMessage:
+		err = initializers.DB.Model(&models.Message{}).Where("id = ?", targetID).Update("hidden_at", time.Now()).Error
+	default:
+		return errors.New("only ads and messages can be hidden")
+	}
+	if err != nil {
+		return err
+	}
+
+	Audit(AuditContentHidden, &actorID, targetType, targetID, nil)
+	return nil
+}
+
+// SuspendUser blocks an account from signing in and revokes its sessions
+func SuspendUser(userID uint, reason string, actorID uint) error {
+	if err := initializers.DB.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"suspended_at":      time.Now(),
+		"suspension_reason": reason,
+	}).Error; err != nil {
+		return err
+	}
+	if err := RevokeUserSessions(userID); err != nil {
+		return err
+	}
+
+	Audit(AuditUserSuspended, &actorID, "user", userID, map[string]interface{}{"reason": reason})
+	return nil
+}
+
+var ErrNotSuspended = errors.New("user isn't suspended")
+
+// UnsuspendUser lets a suspended account sign in again
+func UnsuspendUser(userID uint, actorID uint) error {
+	result := initializers.DB.Model(&models.User{}).
+		Where("id = ? AND suspended_at IS NOT NULL", userID).
+		Updates(map[string]interface{}{
+			"suspended_at":      nil,
+			"suspension_reason": "",
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotSuspended
+	}
+
+	Audit(AuditUserUnsuspended, &actorID, "user", userID, nil)
+	return nil
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OfferData returns the fields of an offer shared with both parties
+func OfferData(offer models.Offer) map[string]interface{} {
+	return map[string]interface{}{
+		"id":              offer.ID,
+		"ad_id":           offer.AdID,
+		"buyer_id":        offer.BuyerID,
+		"seller_id":       offer.SellerID,
+		"proposer_id":     offer.ProposerID,
+		"parent_offer_id": offer.ParentOfferID,
+		"amount":          offer.Amount,
+		"delivery": map[string]interface{}{
+			"method":   offer.DeliveryMethod,
+			"postcode": offer.DeliveryPostcode,
+			"cost":     offer.DeliveryCost,
+		},
+		"status":       offer.Status,
+		"expires_at":   offer.ExpiresAt,
+		"responded_at": offer.RespondedAt,
+		"completed_at": offer.CompletedAt,
+		"created_at":   offer.CreatedAt,
+	}
+}
+
+// PublishOfferEvent delivers an offer event to the buyer and seller
+func PublishOfferEvent(eventType string, offer models.Offer) {
+	data := OfferData(offer)
+	PublishEvent(offer.BuyerID, eventType, data, true)
+	PublishEvent(offer.SellerID, eventType, data, true)
+}
+
+var (
+	ErrAdNotReserved   = errors.New("ad isn't reserved")
+	ErrReservationPaid = errors.New("the buyer already paid for the reserved ad")
+)
+
+// CountPaidOrders counts the orders of the ad whose payment is held in escrow or was paid out
+func CountPaidOrders(tx *gorm.DB, adID uint) (int64, error) {
+	var paid int64
+	err := tx.Model(&models.Order{}).
+		Where("ad_id = ? AND status IN ?", adID, append(models.OrderHeldStatuses, models.OrderStatusReleased)).
+		Count(&paid).Error
+	return paid, err
+}
+
+/*
+ReleaseReservation puts a reserved ad back on sale and cancels the accepted offers holding it.
+Ads whose buyer already paid stay reserved, their order has to be refunded instead.
+*/
+func ReleaseReservation(adID uint, reason string) ([]models.Offer, error) {
+	var cancelled []models.Offer
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var ad models.Ad
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id, status").First(&ad, adID).Error; err != nil {
+			return err
+		}
+		if ad.Status != models.AdStatusReserved {
+			return ErrAdNotReserved
+		}
+		paid, err := CountPaidOrders(tx, adID)
+		if err != nil {
+			return err
+		}
+		if paid > 0 {
+			return ErrReservationPaid
+		}
+
+		if err := tx.Model(&models.Ad{}).Where("id = ?", adID).Updates(map[string]interface{}{
+			"status":            models.AdStatusActive,
+			"reserved_until":    nil,
+			"reserved_offer_id": nil,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&cancelled).
+			Clauses(clause.Returning{}).
+			Where("ad_id = ? AND status = ? AND completed_at IS NULL", adID, models.OfferStatusAccepted).
+			Update("status", models.OfferStatusCancelled).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	ClearFavoriteAlerts(adID, models.FavoriteAlertReserved) // A new reservation is notified again
+
+	var ad models.Ad
+	if err := initializers.DB.Select("id, title").First(&ad, adID).Error; err != nil {
+		log.Printf("Failed to load ad %d for reservation emails: %v", adID, err)
+	}
+	for _, offer := range cancelled {
+		PublishOfferEvent(EventOfferUpdate, offer)
+		notifyReservationReleased(offer, ad, reason)
+	}
+	return cancelled, nil
+}
+
+// notifyReservationReleased emails the buyer of a cancelled offer that the item is back on sale
+func notifyReservationReleased(offer models.Offer, ad models.Ad, reason string) {
+	var buyer models.User
+	if err := initializers.DB.Select("email, first_name").First(&buyer, offer.BuyerID).Error; err != nil {
+		log.Printf("Failed to load buyer %d for reservation email: %v", offer.BuyerID, err)
+		return
+	}
+	SendEmailAsync(buyer.Email, "Your reservation has ended", EmailBody(
+		fmt.Sprintf("Hi %s,", buyer.FirstName),
+		"",
+		fmt.Sprintf("\"%s\" is no longer reserved for you and is back on sale. %s", ad.Title, reason),
+	))
+}
+
+/*
+ExpirePendingOffers marks pending offers past their expiry as expired and notifies both parties.
+Scopes narrow the offers considered, for example to a single ad and buyer.
+*/
+func ExpirePendingOffers(scopes ...func(*gorm.DB) *gorm.DB) ([]models.Offer, error) {
+	var expired []models.Offer
+	now := time.Now()
+	if err := initializers.DB.Model(&expired).
+		Clauses(clause.Returning{}).
+		Scopes(scopes...).
+		Where("status = ? AND expires_at <= ?", models.OfferStatusPending, now).
+		Updates(map[string]interface{}{
+			"status":       models.OfferStatusExpired,
+			"responded_at": now,
+		}).Error; err != nil {
+		return nil, err
+	}
+
+	for _, offer := range expired {
+		log.Printf("Offer %d on ad %d expired", offer.ID, offer.AdID)
+		PublishOfferEvent(EventOfferUpdate, offer)
+	}
+	return expired, nil
+}
@@ -0,0 +1,519 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrOrderState    = errors.New("order can't move to this status")
+	ErrSellerDeleted = errors.New("the seller's account was deleted")
+)
+
+// PartyName is the name of a buyer or seller kept on their orders
+func PartyName(user models.User) string {
+	return strings.TrimSpace(user.FirstName + " " + user.LastName)
+}
+
+// OrderData returns the fields of an order shared with both parties
+func OrderData(order models.Order) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          order.ID,
+		"ad_id":       order.AdID,
+		"ad_title":    order.AdTitle,
+		"buyer_id":    order.BuyerID,
+		"buyer_name":  order.BuyerName,
+		"seller_id":   order.SellerID,
+		"seller_name": order.SellerName,
+		"offer_id":    order.OfferID,
+		"amount":      order.Amount,
+		"delivery": map[string]interface{}{
+			"method":   order.DeliveryMethod,
+			"postcode": order.DeliveryPostcode,
+			"cost":     order.DeliveryCost,
+		},
+		"status":          order.Status,
+		"tracking_number": order.TrackingNumber,
+		"paid_at":         order.PaidAt,
+		"shipped_at":      order.ShippedAt,
+		"delivered_at":    order.DeliveredAt,
+		"released_at":     order.ReleasedAt,
+		"refunded_at":     order.RefundedAt,
+		"disputed_at":     order.DisputedAt,
+		"dispute_reason":  order.DisputeReason,
+		"created_at":      order.CreatedAt,
+	}
+}
+
+// PublishOrderEvent delivers an order update to the buyer and seller
+func PublishOrderEvent(order models.Order) {
+	data := OrderData(order)
+	for _, userID := range []*uint{order.BuyerID, order.SellerID} {
+		if userID != nil {
+			PublishEvent(*userID, EventOrderUpdate, data, true)
+		}
+	}
+}
+
+// orderBuyer returns the buyer of an order, 0 once their account is deleted
+func orderBuyer(order models.Order) uint {
+	if order.BuyerID == nil {
+		return 0
+	}
+	return *order.BuyerID
+}
+
+// TransitionOrder moves an order to status with the given columns, failing if another request moved it first
+func TransitionOrder(tx *gorm.DB, order *models.Order, status string, columns map[string]interface{}) error {
+	if !order.CanTransitionTo(status) {
+		return ErrOrderState
+	}
+
+	columns["status"] = status
+	result := tx.Model(order).Where("status = ?", order.Status).Updates(columns)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOrderState
+	}
+	order.Status = status
+	return nil
+}
+
+// NotifyOrderParty emails the buyer or seller of an order, unless their account was deleted
+func NotifyOrderParty(userID *uint, subject string, lines ...string) {
+	if userID == nil {
+		return
+	}
+	var user models.User
+	if err := initializers.DB.Select("email, first_name").First(&user, *userID).Error; err != nil {
+		log.Printf("Failed to load user %d for order email: %v", *userID, err)
+		return
+	}
+	SendEmailAsync(user.Email, subject, EmailBody(append([]string{fmt.Sprintf("Hi %s,", user.FirstName), ""}, lines...)...))
+}
+
+/*
+HandlePaymentEvent applies a verified provider webhook to its order or promotion. Providers retry
+webhooks, so events already applied are ignored. A successful payment of an intent that was replaced
+by a newer one no longer belongs to anything and is refunded.
+*/
+func HandlePaymentEvent(event PaymentEvent) error {
+	var order models.Order
+	if err := initializers.DB.Where("payment_ref = ?", event.Reference).First(&order).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		var promotion models.Promotion
+		err := initializers.DB.Where("payment_ref = ?", event.Reference).First(&promotion).Error
+		if err == nil {
+			return HandlePromotionPayment(promotion, event)
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if event.Type == PaymentSucceeded {
+			log.Printf("Refunding payment %s without an order", event.Reference)
+			_, err := Payments.Refund(event.Reference)
+			return err
+		}
+		return nil
+	}
+
+	switch event.Type {
+	case PaymentSucceeded:
+		return markOrderPaid(&order)
+	case PaymentRefunded:
+		if !order.CanTransitionTo(models.OrderStatusRefunded) {
+			return nil
+		}
+		return markOrderRefunded(&order, order.RefundRef, true, nil, "Refunded through the payment provider")
+	case PaymentFailed:
+		log.Printf("Payment %s of order %d failed", event.Reference, order.ID)
+	}
+	return nil
+}
+
+/*
+markOrderPaid holds the payment of a pending order and reserves the ad. The buyer is refunded if the
+item was sold or reserved for someone else meanwhile, or if the offer the order pays for was cancelled.
+*/
+func markOrderPaid(order *models.Order) error {
+	if order.Status != models.OrderStatusPending {
+		return nil // Duplicate webhook
+	}
+
+	now := time.Now()
+	available, reserved := false, false
+	reason := "The item was sold to another buyer before the payment completed"
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := TransitionOrder(tx, order, models.OrderStatusPaid, map[string]interface{}{"paid_at": now}); err != nil {
+			return err
+		}
+		if order.AdID == nil {
+			reason = "The item was removed before the payment completed"
+			return nil
+		}
+
+		var ad models.Ad
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id, status, reserved_offer_id").First(&ad, *order.AdID).Error; err != nil {
+			return err
+		}
+		var others int64
+		if err := tx.Model(&models.Order{}).
+			Where("ad_id = ? AND id <> ? AND status IN ?", ad.ID, order.ID, append(models.OrderHeldStatuses, models.OrderStatusReleased)).
+			Count(&others).Error; err != nil {
+			return err
+		}
+		if order.OfferID != nil {
+			var offer models.Offer
+			if err := tx.Select("id, status, completed_at").First(&offer, *order.OfferID).Error; err != nil {
+				return err
+			}
+			if offer.Status != models.OfferStatusAccepted || offer.CompletedAt != nil {
+				reason = "The offer was cancelled before the payment completed"
+				return nil
+			}
+		}
+
+		// Payments reserve the ad unless the reservation belongs to the offer being paid for
+		switch {
+		case others > 0:
+		case ad.Status == models.AdStatusActive:
+			available, reserved = true, true
+			return tx.Model(&models.Ad{}).Where("id = ?", ad.ID).Updates(map[string]interface{}{
+				"status":            models.AdStatusReserved,
+				"reserved_until":    nil,
+				"reserved_offer_id": order.OfferID,
+			}).Error
+		case ad.Status == models.AdStatusReserved && order.OfferID != nil &&
+			ad.ReservedOfferID != nil && *ad.ReservedOfferID == *order.OfferID:
+			available = true
+		}
+		return nil
+	})
+	if errors.Is(err, ErrOrderState) {
+		return nil // Another delivery of the webhook got there first
+	}
+	if err != nil {
+		return err
+	}
+	order.PaidAt = &now
+
+	if !available {
+		return RefundOrder(order, false, nil, reason)
+	}
+
+	PublishOrderEvent(*order)
+	if reserved {
+		var ad models.Ad
+		if err := initializers.DB.First(&ad, *order.AdID).Error; err == nil {
+			NotifyAdStatusChange(ad, orderBuyer(*order))
+		}
+	}
+	NotifyOrderParty(order.SellerID, "You have a new order", fmt.Sprintf(
+		"Payment for order #%d has been received and is held until the buyer confirms receipt. %s", order.ID, handoverInstructions(*order),
+	))
+	return nil
+}
+
+// handoverInstructions tells the seller how the buyer chose to receive the item
+func handoverInstructions(order models.Order) string {
+	switch order.DeliveryMethod {
+	case models.DeliveryLocal:
+		return fmt.Sprintf("Please deliver the item to the buyer in %s.", order.DeliveryPostcode)
+	case models.DeliveryShipping:
+		return fmt.Sprintf("Please ship the item to the buyer in %s and add the tracking number to the order.", order.DeliveryPostcode)
+	}
+	return "The buyer will collect the item, please arrange the pickup with them."
+}
+
+/*
+RefundOrder returns the payment of a paid, shipped or disputed order to the buyer. reopenAd puts the
+ad back on sale when the order was holding it. actorID is nil for system refunds.
+*/
+func RefundOrder(order *models.Order, reopenAd bool, actorID *uint, reason string) error {
+	if !order.CanTransitionTo(models.OrderStatusRefunded) {
+		return ErrOrderState
+	}
+
+	refundRef, err := Payments.Refund(order.PaymentRef)
+	if err != nil {
+		return err
+	}
+	return markOrderRefunded(order, refundRef, reopenAd, actorID, reason)
+}
+
+// markOrderRefunded records a refund, cancelling the accepted offer the order paid for
+func markOrderRefunded(order *models.Order, refundRef string, reopenAd bool, actorID *uint, reason string) error {
+	now := time.Now()
+	var cancelled []models.Offer
+	reopened := false
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := TransitionOrder(tx, order, models.OrderStatusRefunded, map[string]interface{}{
+			"refunded_at": now,
+			"refund_ref":  refundRef,
+		}); err != nil {
+			return err
+		}
+		if order.OfferID != nil {
+			if err := tx.Model(&cancelled).
+				Clauses(clause.Returning{}).
+				Where("id = ? AND status = ? AND completed_at IS NULL", *order.OfferID, models.OfferStatusAccepted).
+				Update("status", models.OfferStatusCancelled).Error; err != nil {
+				return err
+			}
+		}
+		if !reopenAd || order.AdID == nil {
+			return nil
+		}
+		result := tx.Model(&models.Ad{}).
+			Where("id = ? AND status = ?", *order.AdID, models.AdStatusReserved).
+			Updates(map[string]interface{}{"status": models.AdStatusActive, "reserved_until": nil, "reserved_offer_id": nil})
+		reopened = result.RowsAffected > 0
+		return result.Error
+	})
+	if err != nil {
+		return err
+	}
+	order.RefundedAt = &now
+	order.RefundRef = refundRef
+	if reopened {
+		ClearFavoriteAlerts(*order.AdID, models.FavoriteAlertReserved) // A new reservation is notified again
+	}
+	for _, offer := range cancelled {
+		PublishOfferEvent(EventOfferUpdate, offer)
+	}
+
+	Audit(AuditOrderRefunded, actorID, "order", order.ID, map[string]interface{}{
+		"amount":     order.Amount,
+		"refund_ref": refundRef,
+		"reason":     reason,
+	})
+	PublishOrderEvent(*order)
+	NotifyOrderParty(order.BuyerID, "Your payment was refunded",
+		fmt.Sprintf("Order #%d was cancelled and your payment has been refunded.", order.ID),
+		"",
+		fmt.Sprintf("Reason: %s", reason),
+	)
+	return nil
+}
+
+/*
+ReleaseOrder pays a delivered order out to the seller and marks the ad sold, completing the
+accepted offer it came from. Failed payouts leave the order delivered for the payout worker to retry.
+*/
+func ReleaseOrder(order *models.Order) error {
+	if order.Status != models.OrderStatusDelivered {
+		return ErrOrderState
+	}
+	if order.SellerID == nil {
+		return ErrSellerDeleted
+	}
+
+	payoutRef, err := Payments.Payout(order.PaymentRef, *order.SellerID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var completed []models.Offer
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := TransitionOrder(tx, order, models.OrderStatusReleased, map[string]interface{}{
+			"released_at": now,
+			"payout_ref":  payoutRef,
+		}); err != nil {
+			return err
+		}
+		if order.AdID != nil {
+			if err := tx.Model(&models.Ad{}).Where("id = ?", *order.AdID).Updates(map[string]interface{}{
+				"status":  models.AdStatusSold,
+				"sold_at": now,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		if order.OfferID == nil {
+			return nil
+		}
+		return tx.Model(&completed).
+			Clauses(clause.Returning{}).
+			Where("id = ? AND completed_at IS NULL", *order.OfferID).
+			Update("completed_at", now).Error
+	})
+	if err != nil {
+		return err
+	}
+	order.ReleasedAt = &now
+	order.PayoutRef = payoutRef
+
+	Audit(AuditOrderReleased, nil, "order", order.ID, map[string]interface{}{
+		"amount":     order.Amount,
+		"payout_ref": payoutRef,
+	})
+	PublishOrderEvent(*order)
+	for _, offer := range completed {
+		PublishOfferEvent(EventOfferUpdate, offer)
+	}
+	var ad models.Ad
+	if order.AdID != nil && initializers.DB.First(&ad, *order.AdID).Error == nil {
+		NotifyAdStatusChange(ad, orderBuyer(*order))
+	}
+	NotifyOrderParty(order.SellerID, "Your payment is on its way",
+		fmt.Sprintf("Order #%d was completed and the payment has been released to you.", order.ID),
+	)
+	return nil
+}
+
+// OrderShipPeriod reads ORDER_SHIP_DAYS, the time a seller has to send a paid order by post, defaulting to 7 days
+func OrderShipPeriod() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("ORDER_SHIP_DAYS"))
+	if err != nil || days < 1 {
+		days = 7
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// OrderConfirmPeriod reads ORDER_CONFIRM_DAYS, the time a buyer has to confirm receipt or dispute a sent order, defaulting to 14 days
+func OrderConfirmPeriod() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("ORDER_CONFIRM_DAYS"))
+	if err != nil || days < 1 {
+		days = 14
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// DisputeOrder holds the payment of a paid or sent order until a moderator settles the buyer's dispute
+func DisputeOrder(order *models.Order, reason string) error {
+	now := time.Now()
+	if err := TransitionOrder(initializers.DB, order, models.OrderStatusDisputed, map[string]interface{}{
+		"disputed_at":    now,
+		"dispute_reason": reason,
+	}); err != nil {
+		return err
+	}
+	order.DisputedAt = &now
+	order.DisputeReason = reason
+
+	Audit(AuditOrderDisputed, order.BuyerID, "order", order.ID, map[string]interface{}{"reason": reason})
+	PublishOrderEvent(*order)
+	NotifyOrderParty(order.SellerID, "A buyer opened a dispute",
+		fmt.Sprintf("The buyer of order #%d reported a problem: %s", order.ID, reason),
+		"",
+		"The payment is held until our team reviews the dispute. You can still refund the buyer from the order.",
+	)
+	return nil
+}
+
+/*
+ResolveDispute settles a disputed order, refunding the buyer or releasing the payment to the seller.
+Failed payouts leave the order delivered for the payout worker to retry.
+*/
+func ResolveDispute(order *models.Order, refund bool, moderatorID uint, notes string) error {
+	if order.Status != models.OrderStatusDisputed {
+		return ErrOrderState
+	}
+
+	outcome := "released"
+	if refund {
+		outcome = "refunded"
+		reason := "The dispute was resolved in your favour"
+		if notes != "" {
+			reason += ": " + notes
+		}
+		if err := RefundOrder(order, true, &moderatorID, reason); err != nil {
+			return err
+		}
+	} else {
+		now := time.Now()
+		if err := TransitionOrder(initializers.DB, order, models.OrderStatusDelivered, map[string]interface{}{
+			"delivered_at": now,
+		}); err != nil {
+			return err
+		}
+		order.DeliveredAt = &now
+		if err := ReleaseOrder(order); err != nil {
+			log.Printf("Failed to release order %d: %v", order.ID, err)
+			PublishOrderEvent(*order)
+		}
+		lines := []string{fmt.Sprintf("After review, the payment for order #%d was released to the seller.", order.ID)}
+		if notes != "" {
+			lines = append(lines, "", fmt.Sprintf("Notes: %s", notes))
+		}
+		NotifyOrderParty(order.BuyerID, "Your dispute was resolved", lines...)
+	}
+
+	Audit(AuditDisputeResolved, &moderatorID, "order", order.ID, map[string]interface{}{
+		"outcome": outcome,
+		"notes":   notes,
+	})
+	return nil
+}
+
+// RefundUnsentOrders refunds the orders sent by post that the seller didn't send within OrderShipPeriod
+func RefundUnsentOrders() (int, error) {
+	var orders []models.Order
+	if err := initializers.DB.
+		Where("status = ? AND delivery_method = ? AND paid_at <= ?",
+			models.OrderStatusPaid, models.DeliveryShipping, time.Now().Add(-OrderShipPeriod())).
+		Limit(100).
+		Find(&orders).Error; err != nil {
+		return 0, err
+	}
+
+	refunded := 0
+	for i := range orders {
+		if err := RefundOrder(&orders[i], true, nil, "The seller didn't send the item in time"); err != nil {
+			log.Printf("Failed to refund unsent order %d: %v", orders[i].ID, err)
+			continue
+		}
+		refunded++
+	}
+	return refunded, nil
+}
+
+/*
+ReleaseUnconfirmedOrders completes the sent orders whose buyer neither confirmed receipt nor opened
+a dispute within OrderConfirmPeriod. Failed payouts are retried by the payout worker.
+*/
+func ReleaseUnconfirmedOrders() (int, error) {
+	var orders []models.Order
+	if err := initializers.DB.
+		Where("status = ? AND shipped_at <= ?", models.OrderStatusShipped, time.Now().Add(-OrderConfirmPeriod())).
+		Limit(100).
+		Find(&orders).Error; err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for i := range orders {
+		order := &orders[i]
+		now := time.Now()
+		if err := TransitionOrder(initializers.DB, order, models.OrderStatusDelivered, map[string]interface{}{
+			"delivered_at": now,
+		}); err != nil {
+			if !errors.Is(err, ErrOrderState) {
+				log.Printf("Failed to complete unconfirmed order %d: %v", order.ID, err)
+			}
+			continue
+		}
+		order.DeliveredAt = &now
+		if err := ReleaseOrder(order); err != nil {
+			log.Printf("Failed to release order %d: %v", order.ID, err)
+			PublishOrderEvent(*order)
+		}
+		released++
+	}
+	return released, nil
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithm identifiers used as the first segment of an encoded hash
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+// Bounds of argon2id parameters, enforced on the configuration and on stored hashes
+const (
+	maxArgon2MemoryKiB = 4 * 1024 * 1024 // 4 GiB
+	maxArgon2Time      = 64
+	minArgon2SaltLen   = 8
+	minArgon2KeyLen    = 16
+)
+
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+/*
+PasswordHasher hashes and verifies passwords for a single algorithm.
+Encoded hashes carry their algorithm and parameters so they can be verified
+after the current settings change, and upgraded with NeedsRehash.
+*/
+type PasswordHasher interface {
+	Algorithm() string
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	NeedsRehash(encoded string) bool
+}
+
+// Argon2idHasher produces PHC-formatted hashes: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+type Argon2idHasher struct {
+	Memory  uint32 // KiB
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func (h *Argon2idHasher) Algorithm() string { return AlgorithmArgon2id }
+
+// checkArgon2Params rejects parameters argon2.IDKey panics on or that would exhaust the server
+func checkArgon2Params(memory, time uint32, threads uint8) error {
+	switch {
+	case threads == 0:
+		return errors.New("argon2 parallelism must be at least 1")
+	case time == 0 || time > maxArgon2Time:
+		return fmt.Errorf("argon2 time must be between 1 and %d", maxArgon2Time)
+	case memory < 8*uint32(threads) || memory > maxArgon2MemoryKiB:
+		return fmt.Errorf("argon2 memory must be between %d and %d KiB", 8*uint32(threads), maxArgon2MemoryKiB)
+	}
+	return nil
+}
+
+// Validate checks the hasher's settings before any hash is produced
+func (h *Argon2idHasher) Validate() error {
+	if err := checkArgon2Params(h.Memory, h.Time, h.Threads); err != nil {
+		return err
+	}
+	if h.SaltLen < minArgon2SaltLen || h.KeyLen < minArgon2KeyLen {
+		return fmt.Errorf("argon2 salt and key must be at least %d and %d bytes", minArgon2SaltLen, minArgon2KeyLen)
+	}
+	return nil
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	params, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey([]byte(password), params.salt, params.time, params.memory, params.threads, uint32(len(params.key)))
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.memory != h.Memory || params.time != h.Time || params.threads != h.Threads ||
+		uint32(len(params.salt)) != h.SaltLen || uint32(len(params.key)) != h.KeyLen
+}
+
+func decodeArgon2id(encoded string) (*argon2Params, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2 version: %s", parts[2])
+	}
+
+	params := &argon2Params{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return nil, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+
+	if err := checkArgon2Params(params.memory, params.time, params.threads); err != nil {
+		return nil, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("invalid argon2 salt: %w", err)
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, fmt.Errorf("invalid argon2 key: %w", err)
+	}
+	if len(params.salt) < minArgon2SaltLen || len(params.key) < minArgon2KeyLen {
+		return nil, errors.New("invalid argon2 salt or key length")
+	}
+	return params, nil
+}
+
+// BcryptHasher verifies legacy bcrypt hashes ($2a$, $2b$, $2y$)
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Algorithm() string { return AlgorithmBcrypt }
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hash), err
+}
+
+func (h *BcryptHasher) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
+
+var (
+	CurrentHasher PasswordHasher            // Hasher used for all new hashes
+	hashers       map[string]PasswordHasher // Every algorithm that can still be verified
+	dummyHash     string                    // Verified against when a user does not exist to equalise timing
+)
+
+func InitPasswordHasher() {
+	memory, time, threads := envInt("ARGON2_MEMORY_KIB", 64*1024), envInt("ARGON2_TIME", 3), envInt("ARGON2_THREADS", 2)
+	// Out of range values would wrap around in the conversions below
+	if memory < 1 || memory > maxArgon2MemoryKiB || time < 1 || time > maxArgon2Time || threads < 1 || threads > 255 {
+		log.Fatalf("Invalid argon2 settings: ARGON2_MEMORY_KIB=%d ARGON2_TIME=%d ARGON2_THREADS=%d", memory, time, threads)
+	}
+	argon := &Argon2idHasher{
+		Memory:  uint32(memory),
+		Time:    uint32(time),
+		Threads: uint8(threads),
+		SaltLen: 16,
+		KeyLen:  32,
+	}
+	if err := argon.Validate(); err != nil {
+		log.Fatalf("Invalid argon2 settings: %v", err)
+	}
+
+	CurrentHasher = argon
+	hashers = map[string]PasswordHasher{
+		AlgorithmArgon2id: argon,
+		AlgorithmBcrypt:   &BcryptHasher{Cost: bcrypt.DefaultCost},
+	}
+
+	var err error
+	if dummyHash, err = CurrentHasher.Hash("dummy-password-for-timing"); err != nil {
+		log.Fatalf("Failed to initialize password hasher: %v", err)
+	}
+	log.Println("Password hasher initialized successfully")
+}
+
+// hasherFor detects the algorithm of an encoded hash
+func hasherFor(encoded string) (PasswordHasher, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return hashers[AlgorithmArgon2id], nil
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return hashers[AlgorithmBcrypt], nil
+	}
+	return nil, ErrUnknownHashFormat
+}
+
+// HashPassword hashes a password with the current algorithm and settings
+func HashPassword(password string) (string, error) {
+	return CurrentHasher.Hash(password)
+}
+
+/*
+VerifyPassword checks a password against an encoded hash of any supported algorithm.
+needsRehash is true when the password matched but the hash was not produced
+with the current algorithm and settings, so the caller should store a fresh hash.
+*/
+func VerifyPassword(password, encoded string) (ok bool, needsRehash bool, err error) {
+	hasher, err := hasherFor(encoded)
+	if err != nil {
+		return false, false, err
+	}
+
+	if ok, err = hasher.Verify(password, encoded); err != nil || !ok {
+		return false, false, err
+	}
+
+	needsRehash = hasher.Algorithm() != CurrentHasher.Algorithm() || hasher.NeedsRehash(encoded)
+	return true, needsRehash, nil
+}
+
+// VerifyDummyPassword spends the same time as a real verification for unknown accounts
+func VerifyDummyPassword(password string) {
+	_, _ = CurrentHasher.Verify(password, dummyHash)
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// useTestHashers installs cheap hashers for the duration of a test
+func useTestHashers(t *testing.T) *Argon2idHasher {
+	t.Helper()
+	argon := &Argon2idHasher{Memory: 256, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+	previousCurrent, previousHashers := CurrentHasher, hashers
+	CurrentHasher = argon
+	hashers = map[string]PasswordHasher{
+		AlgorithmArgon2id: argon,
+		AlgorithmBcrypt:   &BcryptHasher{Cost: bcrypt.MinCost},
+	}
+	t.Cleanup(func() { CurrentHasher, hashers = previousCurrent, previousHashers })
+	return argon
+}
+
+func TestArgon2idHashAndVerify(t *testing.T) {
+	argon := useTestHashers(t)
+
+	encoded, err := argon.Hash("correct-horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=256,t=1,p=1$") {
+		t.Fatalf("unexpected encoding %s", encoded)
+	}
+	if again, _ := argon.Hash("correct-horse"); again == encoded {
+		t.Error("hashes of the same password should use different salts")
+	}
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"correct-horse", true},
+		{"correct-horsf", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		ok, err := argon.Verify(tt.password, encoded)
+		if err != nil || ok != tt.want {
+			t.Errorf("Verify(%q) = %v, %v, want %v", tt.password, ok, err, tt.want)
+		}
+	}
+}
+
+func TestDecodeArgon2idRejectsInvalidHashes(t *testing.T) {
+	salt, key := "c2FsdHNhbHRzYWx0c2FsdA", "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"not argon2id", "$argon2i$v=19$m=256,t=1,p=1$" + salt + "$" + key},
+		{"missing segment", "$argon2id$v=19$m=256,t=1,p=1$" + salt},
+		{"other version", "$argon2id$v=16$m=256,t=1,p=1$" + salt + "$" + key},
+		{"zero parallelism", "$argon2id$v=19$m=256,t=1,p=0$" + salt + "$" + key},
+		{"parallelism overflow", "$argon2id$v=19$m=256,t=1,p=256$" + salt + "$" + key},
+		{"zero time", "$argon2id$v=19$m=256,t=0,p=1$" + salt + "$" + key},
+		{"absurd time", "$argon2id$v=19$m=256,t=100000,p=1$" + salt + "$" + key},
+		{"memory below 8 per lane", "$argon2id$v=19$m=15,t=1,p=2$" + salt + "$" + key},
+		{"absurd memory", "$argon2id$v=19$m=4294967295,t=1,p=1$" + salt + "$" + key},
+		{"bad salt", "$argon2id$v=19$m=256,t=1,p=1$!!$" + key},
+		{"short salt", "$argon2id$v=19$m=256,t=1,p=1$c2FsdA$" + key},
+		{"empty key", "$argon2id$v=19$m=256,t=1,p=1$" + salt + "$"},
+	}
+	argon := useTestHashers(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeArgon2id(tt.encoded); err == nil {
+				t.Fatal("expected an error")
+			}
+			// Must fail instead of panicking inside argon2.IDKey
+			if ok, err := argon.Verify("password", tt.encoded); ok || err == nil {
+				t.Errorf("Verify = %v, %v, want an error", ok, err)
+			}
+			if !argon.NeedsRehash(tt.encoded) {
+				t.Error("an undecodable hash should need a rehash")
+			}
+		})
+	}
+}
+
+func TestArgon2idValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher Argon2idHasher
+		valid  bool
+	}{
+		{"defaults", Argon2idHasher{Memory: 64 * 1024, Time: 3, Threads: 2, SaltLen: 16, KeyLen: 32}, true},
+		{"zero threads", Argon2idHasher{Memory: 64 * 1024, Time: 3, Threads: 0, SaltLen: 16, KeyLen: 32}, false},
+		{"zero time", Argon2idHasher{Memory: 64 * 1024, Time: 0, Threads: 2, SaltLen: 16, KeyLen: 32}, false},
+		{"too little memory", Argon2idHasher{Memory: 8, Time: 3, Threads: 2, SaltLen: 16, KeyLen: 32}, false},
+		{"too much memory", Argon2idHasher{Memory: maxArgon2MemoryKiB + 1, Time: 3, Threads: 2, SaltLen: 16, KeyLen: 32}, false},
+		{"short salt", Argon2idHasher{Memory: 64 * 1024, Time: 3, Threads: 2, SaltLen: 4, KeyLen: 32}, false},
+		{"short key", Argon2idHasher{Memory: 64 * 1024, Time: 3, Threads: 2, SaltLen: 16, KeyLen: 8}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.hasher.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestArgon2idNeedsRehash(t *testing.T) {
+	argon := useTestHashers(t)
+	encoded, err := argon.Hash("correct-horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		hasher Argon2idHasher
+		want   bool
+	}{
+		{"same settings", *argon, false},
+		{"more memory", Argon2idHasher{Memory: 512, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}, true},
+		{"more time", Argon2idHasher{Memory: 256, Time: 2, Threads: 1, SaltLen: 16, KeyLen: 32}, true},
+		{"more threads", Argon2idHasher{Memory: 256, Time: 1, Threads: 2, SaltLen: 16, KeyLen: 32}, true},
+		{"longer salt", Argon2idHasher{Memory: 256, Time: 1, Threads: 1, SaltLen: 32, KeyLen: 32}, true},
+		{"longer key", Argon2idHasher{Memory: 256, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 64}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.hasher.NeedsRehash(encoded); got != tt.want {
+			t.Errorf("%s: NeedsRehash = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	argon := useTestHashers(t)
+	current, err := argon.Hash("correct-horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	weaker := &Argon2idHasher{Memory: 128, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+	outdated, err := weaker.Hash("correct-horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct-horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		password    string
+		encoded     string
+		ok          bool
+		needsRehash bool
+		wantErr     bool
+	}{
+		{"current argon2id", "correct-horse", current, true, false, false},
+		{"wrong password", "wrong", current, false, false, false},
+		{"outdated argon2id settings", "correct-horse", outdated, true, true, false},
+		{"legacy bcrypt upgrades", "correct-horse", string(legacy), true, true, false},
+		{"legacy bcrypt wrong password", "wrong", string(legacy), false, false, false},
+		{"unknown format", "correct-horse", "plaintext", false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash, err := VerifyPassword(tt.password, tt.encoded)
+			if (err != nil) != tt.wantErr || ok != tt.ok || needsRehash != tt.needsRehash {
+				t.Errorf("VerifyPassword = %v, %v, %v, want %v, %v, error %v", ok, needsRehash, err, tt.ok, tt.needsRehash, tt.wantErr)
+			}
+		})
+	}
+}
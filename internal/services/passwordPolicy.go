@@ -0,0 +1,249 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Rule identifiers returned to clients when a password fails validation
+const (
+	RuleMinLength = "min_length"
+	RuleMaxLength = "max_length"
+	RuleCommon    = "common_password"
+	RuleUsername  = "similar_to_username"
+	RuleEmail     = "similar_to_email"
+	RuleBreached  = "breached_password"
+)
+
+// Passwords that are always rejected, regardless of the blocklist file
+var defaultBlocklist = []string{
+	"password", "password1", "password123", "passw0rd", "12345678", "123456789",
+	"1234567890", "qwerty123", "qwertyuiop", "iloveyou", "11111111", "00000000",
+	"abc12345", "letmein1", "welcome1", "sunshine", "princess", "football",
+	"baseball", "dragon12", "monkey12", "trustno1", "superman", "starwars",
+	"grabit123", "changeme",
+}
+
+/*
+PasswordPolicy describes the rules a password must satisfy.
+It is loaded once at startup from environment variables, see InitPasswordPolicy.
+*/
+type PasswordPolicy struct {
+	MinLength         int
+	MaxLength         int
+	Blocklist         map[string]struct{}
+	MaxSimilarity     float64 // 0..1, passwords closer than this to the username/email are rejected
+	BreachedRangeDir  string  // Directory of HIBP-style range files named <PREFIX>.txt
+	BreachedThreshold int     // Minimum breach count for a password to be rejected
+}
+
+// PolicyViolation is a single failed rule
+type PolicyViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PolicyError lists every rule a password failed
+type PolicyError struct {
+	Violations []PolicyViolation
+}
+
+func (e *PolicyError) Error() string {
+	rules := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return "password policy violated: " + strings.Join(rules, ", ")
+}
+
+var Policy *PasswordPolicy // Active password policy
+
+func InitPasswordPolicy() {
+	Policy = &PasswordPolicy{
+		MinLength:         envInt("PASSWORD_MIN_LENGTH", 8),
+		MaxLength:         envInt("PASSWORD_MAX_LENGTH", 128),
+		Blocklist:         make(map[string]struct{}),
+		MaxSimilarity:     envSimilarity("PASSWORD_MAX_SIMILARITY", 0.7),
+		BreachedRangeDir:  os.Getenv("PASSWORD_BREACHED_RANGE_DIR"),
+		BreachedThreshold: envInt("PASSWORD_BREACHED_THRESHOLD", 1),
+	}
+
+	for _, p := range defaultBlocklist {
+		Policy.Blocklist[p] = struct{}{}
+	}
+
+	// Optional blocklist file, one password per line
+	if path := os.Getenv("PASSWORD_BLOCKLIST_FILE"); path != "" {
+		if err := Policy.loadBlocklist(path); err != nil {
+			log.Printf("Failed to load password blocklist: %v", err)
+		}
+	}
+
+	log.Println("Password policy loaded successfully")
+}
+
+func (p *PasswordPolicy) loadBlocklist(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line != "" && !strings.HasPrefix(line, "#") {
+			p.Blocklist[line] = struct{}{}
+		}
+	}
+	return scanner.Err()
+}
+
+/*
+Validate checks a password against every rule of the policy.
+It returns a *PolicyError listing all failed rules, or nil if the password is acceptable.
+*/
+func (p *PasswordPolicy) Validate(password, username, email string) error {
+	var violations []PolicyViolation
+	length := utf8.RuneCountInString(password)
+	lower := strings.ToLower(password)
+
+	if length < p.MinLength {
+		violations = append(violations, PolicyViolation{RuleMinLength, fmt.Sprintf("Password must be at least %d characters long", p.MinLength)})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, PolicyViolation{RuleMaxLength, fmt.Sprintf("Password must be at most %d characters long", p.MaxLength)})
+	}
+	if _, found := p.Blocklist[lower]; found {
+		violations = append(violations, PolicyViolation{RuleCommon, "Password is too common"})
+	}
+	if p.tooSimilar(lower, strings.ToLower(username)) {
+		violations = append(violations, PolicyViolation{RuleUsername, "Password is too similar to your username"})
+	}
+	localPart, _, _ := strings.Cut(strings.ToLower(email), "@")
+	if p.tooSimilar(lower, localPart) || (email != "" && strings.Contains(lower, strings.ToLower(email))) {
+		violations = append(violations, PolicyViolation{RuleEmail, "Password is too similar to your email address"})
+	}
+
+	breached, err := p.isBreached(password)
+	if err != nil {
+		// Never block signups because the dataset is unavailable
+		log.Printf("Breached password check failed: %v", err)
+	}
+	if breached {
+		violations = append(violations, PolicyViolation{RuleBreached, "Password has appeared in a known data breach"})
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func (p *PasswordPolicy) tooSimilar(password, value string) bool {
+	if utf8.RuneCountInString(value) < 3 {
+		return false
+	}
+	if strings.Contains(password, value) || strings.Contains(value, password) {
+		return true
+	}
+	return similarity(password, value) >= p.MaxSimilarity
+}
+
+/*
+isBreached performs a k-anonymity lookup: only the first 5 hex characters of the
+SHA-1 hash select a range file, and the remaining suffix is searched within it.
+Range files use the HIBP format of "SUFFIX:COUNT" per line.
+*/
+func (p *PasswordPolicy) isBreached(password string) (bool, error) {
+	if p.BreachedRangeDir == "" {
+		return false, nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(p.BreachedRangeDir, prefix+".txt"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entrySuffix, countStr, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !strings.EqualFold(entrySuffix, suffix) {
+			continue
+		}
+		count, err := strconv.Atoi(countStr)
+		if err != nil {
+			count = 1
+		}
+		return count >= p.BreachedThreshold, nil
+	}
+	return false, scanner.Err()
+}
+
+// similarity returns 1 - normalised Levenshtein distance between two strings
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return 1 - float64(prev[len(rb)])/float64(longest)
+}
+
+func envInt(key string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+// envSimilarity reads a similarity threshold, which must be above 0 and at most 1
+func envSimilarity(key string, fallback float64) float64 {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || !(value > 0 && value <= 1) {
+		log.Printf("Invalid %s %q, using %v", key, raw, fallback)
+		return fallback
+	}
+	return value
+}
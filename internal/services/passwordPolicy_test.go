@@ -0,0 +1,193 @@
+package services
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testPolicy() *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength:         8,
+		MaxLength:         16,
+		Blocklist:         map[string]struct{}{"password1": {}},
+		MaxSimilarity:     0.7,
+		BreachedThreshold: 1,
+	}
+}
+
+// violatedRules returns the rules of a Validate error, nil when the password passed
+func violatedRules(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("expected *PolicyError, got %T", err)
+	}
+	rules := make([]string, 0, len(policyErr.Violations))
+	for _, v := range policyErr.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		username string
+		email    string
+		want     []string
+	}{
+		{"acceptable", "correct-horse", "jdoe", "jane@example.com", nil},
+		{"too short", "short1", "jdoe", "jane@example.com", []string{RuleMinLength}},
+		{"length counts runes not bytes", "ééééééé", "", "", []string{RuleMinLength}},
+		{"multibyte at min length", "éééééééé", "", "", nil},
+		{"multibyte at max length", strings.Repeat("ü", 16), "", "", nil},
+		{"too long", strings.Repeat("a", 17), "", "", []string{RuleMaxLength}},
+		{"blocklisted, case insensitive", "PassWord1", "", "", []string{RuleCommon}},
+		{"contains username", "xxjdoe2024xx", "jdoe", "", []string{RuleUsername}},
+		{"close to username", "margaret12", "margaret1", "", []string{RuleUsername}},
+		{"short username ignored", "ab-correct-horse", "ab", "", nil},
+		{"contains email local part", "janesmith99", "", "janesmith@example.com", []string{RuleEmail}},
+		{"contains full email", "a-jo@ex.io-b", "", "jo@ex.io", []string{RuleEmail}},
+		{"several rules at once", "jdoe", "jdoe", "", []string{RuleMinLength, RuleUsername}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := violatedRules(t, testPolicy().Validate(tt.password, tt.username, tt.email))
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Validate(%q) violated %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"", "", 1},
+		{"abc", "abc", 1},
+		{"abc", "", 0},
+		{"abc", "xyz", 0},
+		{"kitten", "sitting", 1 - 3.0/7},
+		{"héllo", "hello", 0.8}, // One substituted rune, not two bytes
+		{"margaret12", "margaret1", 0.9},
+	}
+	for _, tt := range tests {
+		if got := similarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("similarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestTooSimilarThreshold(t *testing.T) {
+	policy := testPolicy()
+	// 7 of 10 characters match: exactly at the threshold is rejected
+	if !policy.tooSimilar("abcdefgxyz", "abcdefghij") {
+		t.Error("similarity equal to MaxSimilarity should be rejected")
+	}
+	// 6 of 10 characters match
+	if policy.tooSimilar("abcdefwxyz", "abcdefghij") {
+		t.Error("similarity below MaxSimilarity should be accepted")
+	}
+}
+
+// writeRange writes an HIBP range file for password with the given count
+func writeRange(t *testing.T, dir, password, count string) {
+	t.Helper()
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	lines := "0000000000000000000000000000000000A:3\r\n" + strings.ToLower(hash[5:]) + ":" + count + "\r\n"
+	if err := os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte(lines), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsBreached(t *testing.T) {
+	dir := t.TempDir()
+	writeRange(t, dir, "breached-once", "1")
+	writeRange(t, dir, "breached-often", "250")
+	writeRange(t, dir, "bad-count", "lots")
+
+	tests := []struct {
+		name      string
+		password  string
+		threshold int
+		want      bool
+	}{
+		{"suffix matched case insensitively", "breached-once", 1, true},
+		{"below threshold", "breached-once", 10, false},
+		{"above threshold", "breached-often", 10, true},
+		{"unparsable count counts once", "bad-count", 1, true},
+		{"missing range file", "never-breached", 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := testPolicy()
+			policy.BreachedRangeDir, policy.BreachedThreshold = dir, tt.threshold
+			got, err := policy.isBreached(tt.password)
+			if err != nil {
+				t.Fatalf("isBreached: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("isBreached(%q) = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSurvivesBreachedDatasetOutage(t *testing.T) {
+	// A file where the range directory should be makes every lookup fail
+	notADir := filepath.Join(t.TempDir(), "ranges")
+	if err := os.WriteFile(notADir, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy := testPolicy()
+	policy.BreachedRangeDir = notADir
+
+	if _, err := policy.isBreached("correct-horse"); err == nil {
+		t.Fatal("expected the lookup to fail")
+	}
+	if err := policy.Validate("correct-horse", "jdoe", "jane@example.com"); err != nil {
+		t.Errorf("Validate rejected a password because the dataset is unavailable: %v", err)
+	}
+}
+
+func TestIsBreachedDisabled(t *testing.T) {
+	breached, err := testPolicy().isBreached("password1")
+	if breached || err != nil {
+		t.Errorf("isBreached without a dataset = %v, %v, want false, nil", breached, err)
+	}
+}
+
+func TestEnvSimilarity(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+	}{
+		{"", 0.7},
+		{"0.5", 0.5},
+		{"1", 1},
+		{"0", 0.7},
+		{"-0.2", 0.7},
+		{"1.5", 0.7},
+		{"NaN", 0.7},
+		{"high", 0.7},
+	}
+	for _, tt := range tests {
+		t.Setenv("PASSWORD_MAX_SIMILARITY", tt.value)
+		if got := envSimilarity("PASSWORD_MAX_SIMILARITY", 0.7); got != tt.want {
+			t.Errorf("envSimilarity(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
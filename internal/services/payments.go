@@ -0,0 +1,265 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Payment event types sent by providers to the webhook
+const (
+	PaymentSucceeded = "payment.succeeded"
+	PaymentFailed    = "payment.failed"
+	PaymentRefunded  = "payment.refunded"
+)
+
+const webhookTolerance = 5 * time.Minute // Oldest webhook signature accepted, against replays
+
+var (
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+	ErrPaymentState            = errors.New("payment can't be moved from its current state")
+)
+
+// PaymentIntent is a payment opened with the provider for the buyer to complete at CheckoutURL
+type PaymentIntent struct {
+	Reference   string
+	CheckoutURL string
+}
+
+// PaymentEvent is a verified webhook notification from the provider
+type PaymentEvent struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	Reference string `json:"reference"`
+}
+
+/*
+PaymentProvider holds buyers' payments in escrow. A payment is either paid out to the seller
+or refunded to the buyer in full; promotion fees are kept unless refunded. Providers report
+payment outcomes through signed webhooks. purpose describes what is paid for, such as "order 12".
+*/
+type PaymentProvider interface {
+	Name() string
+	CreatePayment(purpose string, amount int64) (PaymentIntent, error)
+	Payout(paymentRef string, sellerID uint) (string, error)
+	Refund(paymentRef string) (string, error)
+	ParseWebhook(payload []byte, signature string) (PaymentEvent, error)
+}
+
+// SignWebhook returns a "t=<unix>,v1=<hex>" signature header of payload sent at timestamp
+func SignWebhook(secret []byte, timestamp time.Time, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%d.", timestamp.Unix())
+	mac.Write(payload)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp.Unix(), hex.EncodeToString(mac.Sum(nil)))
+}
+
+// VerifyWebhookSignature checks a signature made by SignWebhook, rejecting those older than webhookTolerance
+func VerifyWebhookSignature(secret []byte, payload []byte, header string) error {
+	var timestamp int64
+	var signature []byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signature, _ = hex.DecodeString(value)
+		}
+	}
+	if timestamp == 0 || signature == nil {
+		return ErrInvalidWebhookSignature
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); age > webhookTolerance || age < -webhookTolerance {
+		return ErrInvalidWebhookSignature
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return ErrInvalidWebhookSignature
+	}
+	return nil
+}
+
+// Fake payment states
+const (
+	fakePaymentPending  = "pending"
+	fakePaymentCaptured = "captured"
+	fakePaymentPaidOut  = "paid_out"
+	fakePaymentRefunded = "refunded"
+)
+
+type fakePayment struct {
+	purpose       string
+	amount        int64
+	status        string
+	settlementRef string // Payout or refund reference, returned again on retries
+}
+
+/*
+FakePaymentProvider keeps payments in memory, for development and tests. Like real providers,
+repeating a payout or refund returns the first one instead of moving money twice.
+Simulate produces the signed webhook a real provider would send once the buyer pays.
+*/
+type FakePaymentProvider struct {
+	Secret []byte
+
+	mu       sync.Mutex
+	sequence int
+	payments map[string]*fakePayment
+}
+
+func NewFakePaymentProvider(secret []byte) *FakePaymentProvider {
+	return &FakePaymentProvider{Secret: secret, payments: map[string]*fakePayment{}}
+}
+
+func (p *FakePaymentProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakePaymentProvider) nextID(prefix string) string {
+	p.sequence++
+	return fmt.Sprintf("%s_%d", prefix, p.sequence)
+}
+
+func (p *FakePaymentProvider) CreatePayment(purpose string, amount int64) (PaymentIntent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	reference := p.nextID("fake_pay")
+	p.payments[reference] = &fakePayment{purpose: purpose, amount: amount, status: fakePaymentPending}
+	return PaymentIntent{
+		Reference:   reference,
+		CheckoutURL: fmt.Sprintf("%s/payments/fake/%s/%s", os.Getenv("APP_BASE_URL"), reference, PaymentSucceeded),
+	}, nil
+}
+
+// move changes the state of a payment from one of the given states
+func (p *FakePaymentProvider) move(reference, to string, from ...string) error {
+	payment, ok := p.payments[reference]
+	if !ok {
+		return fmt.Errorf("unknown payment %s", reference)
+	}
+	for _, state := range from {
+		if payment.status == state {
+			payment.status = to
+			return nil
+		}
+	}
+	return ErrPaymentState
+}
+
+// settle pays out or refunds a captured payment once
+func (p *FakePaymentProvider) settle(paymentRef, to, prefix string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if payment, ok := p.payments[paymentRef]; ok && payment.status == to {
+		return payment.settlementRef, nil
+	}
+	if err := p.move(paymentRef, to, fakePaymentCaptured); err != nil {
+		return "", err
+	}
+	payment := p.payments[paymentRef]
+	payment.settlementRef = p.nextID(prefix)
+	return payment.settlementRef, nil
+}
+
+func (p *FakePaymentProvider) Payout(paymentRef string, sellerID uint) (string, error) {
+	reference, err := p.settle(paymentRef, fakePaymentPaidOut, "fake_payout")
+	if err == nil {
+		log.Printf("Fake payout %s of payment %s to user %d", reference, paymentRef, sellerID)
+	}
+	return reference, err
+}
+
+func (p *FakePaymentProvider) Refund(paymentRef string) (string, error) {
+	return p.settle(paymentRef, fakePaymentRefunded, "fake_refund")
+}
+
+func (p *FakePaymentProvider) ParseWebhook(payload []byte, signature string) (PaymentEvent, error) {
+	var event PaymentEvent
+	if err := VerifyWebhookSignature(p.Secret, payload, signature); err != nil {
+		return event, err
+	}
+	err := json.Unmarshal(payload, &event)
+	return event, err
+}
+
+// Simulate settles a payment as a buyer would and returns the signed webhook payload and signature
+func (p *FakePaymentProvider) Simulate(eventType, paymentRef string) ([]byte, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var err error
+	switch eventType {
+	case PaymentSucceeded:
+		err = p.move(paymentRef, fakePaymentCaptured, fakePaymentPending)
+	case PaymentFailed:
+		err = p.move(paymentRef, fakePaymentPending, fakePaymentPending)
+	case PaymentRefunded:
+		err = p.move(paymentRef, fakePaymentRefunded, fakePaymentCaptured)
+		if err == nil {
+			p.payments[paymentRef].settlementRef = p.nextID("fake_refund")
+		}
+	default:
+		err = fmt.Errorf("unknown payment event %s", eventType)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	payload, err := json.Marshal(PaymentEvent{ID: p.nextID("fake_evt"), Type: eventType, Reference: paymentRef})
+	if err != nil {
+		return nil, "", err
+	}
+	return payload, SignWebhook(p.Secret, time.Now(), payload), nil
+}
+
+var (
+	Payments          PaymentProvider = NewFakePaymentProvider(nil) // Active payment provider
+	PaymentSimulation bool                                          // Whether payers may settle fake payments themselves, for development
+)
+
+/*
+InitPayments selects the payment provider from PAYMENT_PROVIDER, which must be set so a
+misconfigured deploy never takes fake payments. Providers are registered here as they are
+integrated. PAYMENT_SIMULATION=true lets payers settle fake payments themselves.
+Webhooks are signed with PAYMENT_WEBHOOK_SECRET, or a random secret when it isn't set.
+*/
+func InitPayments() {
+	secret := []byte(os.Getenv("PAYMENT_WEBHOOK_SECRET"))
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatalf("Failed to generate webhook secret: %v", err)
+		}
+	}
+
+	switch provider := os.Getenv("PAYMENT_PROVIDER"); provider {
+	case "fake":
+		Payments = NewFakePaymentProvider(secret)
+		log.Println("Using fake payment provider, no real money will move")
+	case "":
+		log.Fatal("PAYMENT_PROVIDER is not set, use fake for development")
+	default:
+		log.Fatalf("Unknown PAYMENT_PROVIDER: %s", provider)
+	}
+
+	PaymentSimulation = os.Getenv("PAYMENT_SIMULATION") == "true"
+	if _, fake := Payments.(*FakePaymentProvider); PaymentSimulation && !fake {
+		log.Fatal("PAYMENT_SIMULATION needs PAYMENT_PROVIDER=fake")
+	}
+}
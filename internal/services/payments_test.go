@@ -0,0 +1,44 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	secret := []byte("whsec_test")
+	payload := []byte(`{"payment_ref":"pay_1","status":"succeeded"}`)
+	now := time.Now()
+	valid := SignWebhook(secret, now, payload)
+
+	tests := []struct {
+		name    string
+		secret  []byte
+		payload []byte
+		header  string
+		wantErr bool
+	}{
+		{"valid", secret, payload, valid, false},
+		{"valid with spaces", secret, payload, strings.Replace(valid, ",", ", ", 1), false},
+		{"wrong secret", []byte("other"), payload, valid, true},
+		{"tampered payload", secret, []byte(`{"payment_ref":"pay_1","status":"failed"}`), valid, true},
+		{"stale timestamp", secret, payload, SignWebhook(secret, now.Add(-webhookTolerance-time.Minute), payload), true},
+		{"future timestamp", secret, payload, SignWebhook(secret, now.Add(webhookTolerance+time.Minute), payload), true},
+		{"missing timestamp", secret, payload, strings.SplitN(valid, ",", 2)[1], true},
+		{"missing signature", secret, payload, fmt.Sprintf("t=%d", now.Unix()), true},
+		{"bad hex", secret, payload, fmt.Sprintf("t=%d,v1=zz", now.Unix()), true},
+		{"empty", secret, payload, "", true},
+	}
+	for _, tt := range tests {
+		err := VerifyWebhookSignature(tt.secret, tt.payload, tt.header)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: VerifyWebhookSignature() error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidWebhookSignature) {
+			t.Errorf("%s: VerifyWebhookSignature() error = %v, want ErrInvalidWebhookSignature", tt.name, err)
+		}
+	}
+}
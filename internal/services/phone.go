@@ -0,0 +1,63 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+var ErrInvalidPhoneNumber = errors.New("invalid phone number")
+
+// Calling codes for countries accepted in national format, keyed by ISO 3166-1 alpha-2 code
+var callingCodes = map[string]string{
+	"GB": "44", "IE": "353", "US": "1", "CA": "1", "FR": "33", "DE": "49",
+	"ES": "34", "IT": "39", "PT": "351", "NL": "31", "BE": "32", "PL": "48",
+	"SE": "46", "NO": "47", "DK": "45", "FI": "358", "AT": "43", "CH": "41",
+	"AU": "61", "NZ": "64", "IN": "91",
+}
+
+/*
+NormalizePhoneNumber converts a phone number to E.164 (+<country code><subscriber number>).
+Numbers without an international prefix are interpreted in the given country
+(ISO alpha-2 code), falling back to PHONE_DEFAULT_COUNTRY, and lose their trunk "0".
+*/
+func NormalizePhoneNumber(raw, country string) (string, error) {
+	var digits strings.Builder
+	trimmed := strings.TrimSpace(raw)
+	for i, r := range trimmed {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", ErrInvalidPhoneNumber
+		}
+	}
+
+	number := digits.String()
+	switch {
+	case strings.HasPrefix(trimmed, "+"):
+	case strings.HasPrefix(number, "00"):
+		number = number[2:]
+	default:
+		code := callingCodeFor(country)
+		if code == "" {
+			return "", ErrInvalidPhoneNumber
+		}
+		number = code + strings.TrimPrefix(number, "0")
+	}
+
+	// E.164 allows at most 15 digits, and no country code starts with 0
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return "", ErrInvalidPhoneNumber
+	}
+	return "+" + number, nil
+}
+
+func callingCodeFor(country string) string {
+	if code, found := callingCodes[strings.ToUpper(strings.TrimSpace(country))]; found {
+		return code
+	}
+	return callingCodes[strings.ToUpper(os.Getenv("PHONE_DEFAULT_COUNTRY"))]
+}
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Coordinates is a point in decimal degrees
+type Coordinates struct {
+	Latitude  float64
+	Longitude float64
+}
+
+//go:embed data/postcode_districts.csv
+var bundledPostcodeDistricts []byte
+
+var postcodeDistricts = map[string]Coordinates{} // Centroids keyed by outward code
+
+/*
+InitPostcodes loads the centroids of postcode districts and selects the geocoder from
+GEOCODER_PROVIDER. The bundled dataset only covers the main districts: either point
+POSTCODE_CENTROIDS_FILE to a complete "outcode,latitude,longitude" CSV, for example one
+derived from the ONS Postcode Directory, or use "postcodes_io" to look up the others.
+*/
+func InitPostcodes() {
+	data := bundledPostcodeDistricts
+	if path := os.Getenv("POSTCODE_CENTROIDS_FILE"); path != "" {
+		file, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Failed to read postcode centroids, using the bundled dataset: %v", err)
+		} else {
+			data = file
+		}
+	}
+
+	districts, err := loadPostcodeDistricts(data)
+	if err != nil {
+		log.Printf("Failed to load postcode centroids: %v", err)
+	} else {
+		postcodeDistricts = districts
+		log.Printf("Postcode centroids loaded successfully (%d districts)", len(postcodeDistricts))
+	}
+
+	switch provider := os.Getenv("GEOCODER_PROVIDER"); provider {
+	case "", "table":
+		Geocoding = DistrictTableGeocoder{}
+	case "postcodes_io":
+		baseURL := os.Getenv("POSTCODES_IO_URL")
+		if baseURL == "" {
+			baseURL = "https://api.postcodes.io"
+		}
+		Geocoding = NewPostcodesIOGeocoder(baseURL)
+	default:
+		log.Fatalf("Unknown GEOCODER_PROVIDER: %s", provider)
+	}
+}
+
+func loadPostcodeDistricts(data []byte) (map[string]Coordinates, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	districts := map[string]Coordinates{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("line %d: expected 3 columns", line)
+		}
+
+		latitude, errLat := strconv.ParseFloat(record[1], 64)
+		longitude, errLng := strconv.ParseFloat(record[2], 64)
+		if errLat != nil || errLng != nil {
+			continue // Skip headers and malformed rows
+		}
+		districts[strings.ToUpper(strings.TrimSpace(record[0]))] = Coordinates{Latitude: latitude, Longitude: longitude}
+	}
+	return districts, nil
+}
+
+var (
+	outwardCodePattern = regexp.MustCompile(`^[A-Z]{1,2}[0-9][A-Z0-9]?$`)
+	postcodePattern    = regexp.MustCompile(`^[A-Z]{1,2}[0-9][A-Z0-9]?[0-9][A-Z]{2}$`)
+)
+
+// ValidPostcode reports whether postcode is shaped like a full UK postcode, spaces and case aside
+func ValidPostcode(postcode string) bool {
+	return postcodePattern.MatchString(strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(postcode), " ", "")))
+}
+
+// PostcodeDistrict returns the outward code of a full postcode such as "SW1A 1AA", or of an outward code on its own
+func PostcodeDistrict(postcode string) string {
+	compact := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(postcode), " ", ""))
+	// The inward code is always a digit followed by two letters
+	if n := len(compact); n >= 5 && compact[n-3] >= '0' && compact[n-3] <= '9' {
+		return compact[:n-3]
+	}
+	return compact
+}
+
+/*
+Geocoder finds the centroid of a postcode district from its outward code. ok is false for
+districts it doesn't know, err is only set when the lookup itself failed.
+*/
+type Geocoder interface {
+	Name() string
+	Geocode(district string) (point Coordinates, ok bool, err error)
+}
+
+// DistrictTableGeocoder looks districts up in the centroids loaded by InitPostcodes
+type DistrictTableGeocoder struct{}
+
+func (DistrictTableGeocoder) Name() string {
+	return "table"
+}
+
+func (DistrictTableGeocoder) Geocode(district string) (Coordinates, bool, error) {
+	point, ok := postcodeDistricts[district]
+	return point, ok, nil
+}
+
+/*
+PostcodesIOGeocoder looks up districts missing from the centroid table with the postcodes.io
+API, remembering the districts it found.
+*/
+type PostcodesIOGeocoder struct {
+	BaseURL string
+	Client  *http.Client
+
+	mu    sync.Mutex
+	found map[string]Coordinates
+}
+
+func NewPostcodesIOGeocoder(baseURL string) *PostcodesIOGeocoder {
+	return &PostcodesIOGeocoder{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Client:  &http.Client{Timeout: 5 * time.Second},
+		found:   map[string]Coordinates{},
+	}
+}
+
+func (g *PostcodesIOGeocoder) Name() string {
+	return "postcodes_io"
+}
+
+func (g *PostcodesIOGeocoder) Geocode(district string) (Coordinates, bool, error) {
+	if point, ok := postcodeDistricts[district]; ok {
+		return point, true, nil
+	}
+	g.mu.Lock()
+	point, ok := g.found[district]
+	g.mu.Unlock()
+	if ok {
+		return point, true, nil
+	}
+
+	resp, err := g.Client.Get(g.BaseURL + "/outcodes/" + url.PathEscape(district))
+	if err != nil {
+		return Coordinates{}, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return Coordinates{}, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Coordinates{}, false, fmt.Errorf("postcodes.io returned %s", resp.Status)
+	}
+
+	var body struct {
+		Result struct {
+			Latitude  *float64 `json:"latitude"`
+			Longitude *float64 `json:"longitude"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Coordinates{}, false, err
+	}
+	// Non-geographic districts, such as PO boxes, have no location
+	if body.Result.Latitude == nil || body.Result.Longitude == nil {
+		return Coordinates{}, false, nil
+	}
+
+	point = Coordinates{Latitude: *body.Result.Latitude, Longitude: *body.Result.Longitude}
+	g.mu.Lock()
+	g.found[district] = point
+	g.mu.Unlock()
+	return point, true, nil
+}
+
+var Geocoding Geocoder = DistrictTableGeocoder{} // Active geocoder
+
+// GeocodePostcode returns the centroid of the postcode's district
+func GeocodePostcode(postcode string) (Coordinates, bool) {
+	district := PostcodeDistrict(postcode)
+	if !outwardCodePattern.MatchString(district) {
+		return Coordinates{}, false
+	}
+	point, ok, err := Geocoding.Geocode(district)
+	if err != nil {
+		log.Printf("Failed to geocode district %s with %s: %v", district, Geocoding.Name(), err)
+		return Coordinates{}, false
+	}
+	return point, ok
+}
+
+// DistanceKm returns the great-circle distance between two points
+func DistanceKm(a, b Coordinates) float64 {
+	const earthRadiusKm = 6371.0
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(b.Latitude - a.Latitude)
+	dLng := toRad(b.Longitude - a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(a.Latitude))*math.Cos(toRad(b.Latitude))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// FuzzCoordinates rounds a point to about a kilometre so responses never pinpoint a seller
+func FuzzCoordinates(point Coordinates) Coordinates {
+	return Coordinates{
+		Latitude:  math.Round(point.Latitude*100) / 100,
+		Longitude: math.Round(point.Longitude*100) / 100,
+	}
+}
+
+// AdsWithinRadius is a query scope keeping ads located within radiusKm of the point, using the earthdistance index
+func AdsWithinRadius(point Coordinates, radiusKm float64) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		meters := radiusKm * 1000
+		return db.Where("earth_box(ll_to_earth(?, ?), ?) @> ll_to_earth(ads.latitude, ads.longitude)", point.Latitude, point.Longitude, meters).
+			Where("earth_distance(ll_to_earth(?, ?), ll_to_earth(ads.latitude, ads.longitude)) <= ?", point.Latitude, point.Longitude, meters)
+	}
+}
+
+// OrderAdsByDistance is a query scope sorting ads nearest first, ads without a location last
+func OrderAdsByDistance(point Coordinates) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:                "earth_distance(ll_to_earth(?, ?), ll_to_earth(ads.latitude, ads.longitude)) NULLS LAST",
+			Vars:               []interface{}{point.Latitude, point.Longitude},
+			WithoutParentheses: true,
+		}})
+	}
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidPostcode(t *testing.T) {
+	tests := []struct {
+		postcode string
+		want     bool
+	}{
+		{"SW1A 1AA", true},
+		{"sw1a1aa", true},
+		{" M1 1AE ", true},
+		{"B33 8TH", true},
+		{"CR2 6XH", true},
+		{"DN55 1PT", true},
+		{"SW1A", false},
+		{"SW1A 1A", false},
+		{"1AA 1AA", false},
+		{"SW1A 1AAA", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ValidPostcode(tt.postcode); got != tt.want {
+			t.Errorf("ValidPostcode(%q) = %v, want %v", tt.postcode, got, tt.want)
+		}
+	}
+}
+
+func TestPostcodesIOGeocoder(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/outcodes/ZE2":
+			w.Write([]byte(`{"status":200,"result":{"outcode":"ZE2","latitude":60.3,"longitude":-1.2}}`))
+		case "/outcodes/BX1":
+			w.Write([]byte(`{"status":200,"result":{"outcode":"BX1","latitude":null,"longitude":null}}`))
+		case "/outcodes/ZZ9":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	geocoder := NewPostcodesIOGeocoder(server.URL + "/")
+
+	tests := []struct {
+		district string
+		want     bool
+		wantErr  bool
+	}{
+		{"ZE2", true, false},
+		{"BX1", false, false}, // Non-geographic
+		{"ZZ9", false, false},
+		{"XX1", false, true},
+	}
+	for _, tt := range tests {
+		point, ok, err := geocoder.Geocode(tt.district)
+		if ok != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("Geocode(%q) = %v, %v, %v, want %v, error %v", tt.district, point, ok, err, tt.want, tt.wantErr)
+		}
+	}
+
+	// Found districts are remembered
+	before := requests
+	if point, ok, _ := geocoder.Geocode("ZE2"); !ok || point.Latitude != 60.3 || requests != before {
+		t.Errorf("Geocode(ZE2) = %v, %v after %d requests, want the cached point", point, ok, requests-before)
+	}
+}
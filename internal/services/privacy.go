@@ -0,0 +1,71 @@
+package services
+
+import (
+	"log"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+)
+
+var visibilityLevels = map[string]bool{
+	models.VisibilityEveryone: true,
+	models.VisibilityMembers:  true,
+	models.VisibilityNobody:   true,
+}
+
+// Fields accepted by a privacy settings PATCH, keyed by JSON name
+var PrivacyPatchFields = map[string]ProfileField{
+	"city_visibility":    {Column: "city_visibility", Required: true, Validate: validateVisibility},
+	"country_visibility": {Column: "country_visibility", Required: true, Validate: validateVisibility},
+	"phone_visibility":   {Column: "phone_visibility", Required: true, Validate: validateVisibility},
+	"email_visibility":   {Column: "email_visibility", Required: true, Validate: validateVisibility},
+	"allow_messages":     {Column: "allow_messages", Bool: true},
+}
+
+func validateVisibility(value string) string {
+	if !visibilityLevels[value] {
+		return "Must be one of everyone, members or nobody"
+	}
+	return ""
+}
+
+// PrivacyFor returns a user's privacy settings, or the defaults if they never changed them
+func PrivacyFor(userID uint) models.PrivacySettings {
+	return LoadPrivacySettings(userID)[userID]
+}
+
+// LoadPrivacySettings returns the privacy settings of several users in one query
+func LoadPrivacySettings(userIDs ...uint) map[uint]models.PrivacySettings {
+	settings := make(map[uint]models.PrivacySettings, len(userIDs))
+	for _, userID := range userIDs {
+		settings[userID] = models.DefaultPrivacySettings(userID)
+	}
+	if len(userIDs) == 0 {
+		return settings
+	}
+
+	var stored []models.PrivacySettings
+	if err := initializers.DB.Where("user_id IN ?", userIDs).Find(&stored).Error; err != nil {
+		// Fall back to the defaults, which never expose phone or email
+		log.Printf("Failed to load privacy settings: %v", err)
+		return settings
+	}
+	for _, s := range stored {
+		settings[s.UserID] = s
+	}
+	return settings
+}
+
+// CanSee reports whether viewerID (0 for anonymous visitors) may see a field of ownerID
+func CanSee(visibility string, ownerID, viewerID uint) bool {
+	if viewerID != 0 && viewerID == ownerID {
+		return true
+	}
+	switch visibility {
+	case models.VisibilityEveryone:
+		return true
+	case models.VisibilityMembers:
+		return viewerID != 0
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ProfileField describes how a patchable profile field is validated and stored
+type ProfileField struct {
+	Column   string
+	Bool     bool // Boolean fields accept true or false, and null resets them to false
+	Required bool // Required fields can't be removed with null or set to ""
+	MaxLen   int
+	Validate func(value string) string // Returns an error message, or "" if valid
+	Clean    func(value string) string // Applied before validation
+}
+
+// Fields accepted by a profile PATCH, keyed by JSON name
+var ProfilePatchFields = map[string]ProfileField{
+	"first_name": {Column: "first_name", Required: true, MaxLen: 50, Validate: validatePersonName, Clean: strings.TrimSpace},
+	"last_name":  {Column: "last_name", Required: true, MaxLen: 50, Validate: validatePersonName, Clean: strings.TrimSpace},
+	"city":       {Column: "city", MaxLen: 100, Validate: validatePlaceName, Clean: strings.TrimSpace},
+	"country":    {Column: "country", MaxLen: 2, Validate: validateCountry, Clean: cleanCountry},
+	"bio":        {Column: "bio", MaxLen: 500, Validate: validateFreeText, Clean: strings.TrimSpace},
+}
+
+/*
+ApplyMergePatch converts a JSON Merge Patch (RFC 7396) document into column updates.
+Only members present in the patch are returned; null removes an optional value.
+Every invalid member is reported in fieldErrors, keyed by its JSON name.
+*/
+func ApplyMergePatch(patch map[string]json.RawMessage, fields map[string]ProfileField) (updates map[string]interface{}, fieldErrors map[string]string) {
+	updates = make(map[string]interface{})
+	fieldErrors = make(map[string]string)
+
+	for name, raw := range patch {
+		field, known := fields[name]
+		if !known {
+			fieldErrors[name] = "Unknown or read-only field"
+			continue
+		}
+
+		// null removes the value
+		if string(raw) == "null" {
+			if field.Required {
+				fieldErrors[name] = "Field is required and can't be removed"
+				continue
+			}
+			if field.Bool {
+				updates[field.Column] = false
+			} else {
+				updates[field.Column] = ""
+			}
+			continue
+		}
+
+		if field.Bool {
+			var flag bool
+			if err := json.Unmarshal(raw, &flag); err != nil {
+				fieldErrors[name] = "Must be a boolean"
+				continue
+			}
+			updates[field.Column] = flag
+			continue
+		}
+
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			fieldErrors[name] = "Must be a string"
+			continue
+		}
+		if field.Clean != nil {
+			value = field.Clean(value)
+		}
+
+		switch {
+		case value == "" && field.Required:
+			fieldErrors[name] = "Field is required"
+		case field.MaxLen > 0 && utf8.RuneCountInString(value) > field.MaxLen:
+			fieldErrors[name] = fmt.Sprintf("Must be at most %d characters", field.MaxLen)
+		case value != "" && field.Validate != nil && field.Validate(value) != "":
+			fieldErrors[name] = field.Validate(value)
+		default:
+			updates[field.Column] = value
+		}
+	}
+
+	return updates, fieldErrors
+}
+
+func validatePersonName(value string) string {
+	for _, r := range value {
+		if !unicode.IsLetter(r) && !unicode.Is(unicode.Mn, r) && r != ' ' && r != '-' && r != '\'' && r != '.' {
+			return "May only contain letters, spaces, hyphens, apostrophes and periods"
+		}
+	}
+	return ""
+}
+
+func validatePlaceName(value string) string {
+	for _, r := range value {
+		if !unicode.IsLetter(r) && !unicode.Is(unicode.Mn, r) && !unicode.IsDigit(r) &&
+			r != ' ' && r != '-' && r != '\'' && r != '.' && r != ',' && r != '(' && r != ')' {
+			return "Contains characters that aren't allowed in a place name"
+		}
+	}
+	return ""
+}
+
+func validateCountry(value string) string {
+	if !IsCountryCode(value) {
+		return "Must be an ISO 3166-1 alpha-2 country code"
+	}
+	return ""
+}
+
+func cleanCountry(value string) string {
+	return strings.ToUpper(strings.TrimSpace(value))
+}
+
+func validateFreeText(value string) string {
+	for _, r := range value {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' && r != '\r' {
+			return "Contains control characters"
+		}
+	}
+	return ""
+}
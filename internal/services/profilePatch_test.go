@@ -0,0 +1,56 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestApplyMergePatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		fields      map[string]ProfileField
+		patch       string
+		wantUpdates map[string]interface{}
+		wantErrors  []string // JSON names of the rejected members
+	}{
+		{"absent fields are left alone", ProfilePatchFields, `{}`, map[string]interface{}{}, nil},
+		{"trimmed value", ProfilePatchFields, `{"first_name":"  Zoë "}`, map[string]interface{}{"first_name": "Zoë"}, nil},
+		{"null removes an optional value", ProfilePatchFields, `{"bio":null}`, map[string]interface{}{"bio": ""}, nil},
+		{"null can't remove a required value", ProfilePatchFields, `{"last_name":null}`, map[string]interface{}{}, []string{"last_name"}},
+		{"empty required value", ProfilePatchFields, `{"first_name":"  "}`, map[string]interface{}{}, []string{"first_name"}},
+		{"wrong type", ProfilePatchFields, `{"city":42}`, map[string]interface{}{}, []string{"city"}},
+		{"over length", ProfilePatchFields, `{"bio":"` + strings.Repeat("é", 501) + `"}`, map[string]interface{}{}, []string{"bio"}},
+		{"at length", ProfilePatchFields, `{"bio":"` + strings.Repeat("é", 500) + `"}`, map[string]interface{}{"bio": strings.Repeat("é", 500)}, nil},
+		{"disallowed characters", ProfilePatchFields, `{"first_name":"<b>Jo</b>"}`, map[string]interface{}{}, []string{"first_name"}},
+		{"country is normalized", ProfilePatchFields, `{"country":" gb "}`, map[string]interface{}{"country": "GB"}, nil},
+		{"unknown country", ProfilePatchFields, `{"country":"XX"}`, map[string]interface{}{}, []string{"country"}},
+		{"read-only field", ProfilePatchFields, `{"email":"jo@example.com"}`, map[string]interface{}{}, []string{"email"}},
+		{"valid members apply beside invalid ones", ProfilePatchFields, `{"city":"Leeds","bio":1}`, map[string]interface{}{"city": "Leeds"}, []string{"bio"}},
+		{"boolean", PrivacyPatchFields, `{"allow_messages":false}`, map[string]interface{}{"allow_messages": false}, nil},
+		{"null resets a boolean", PrivacyPatchFields, `{"allow_messages":null}`, map[string]interface{}{"allow_messages": false}, nil},
+		{"boolean of the wrong type", PrivacyPatchFields, `{"allow_messages":"yes"}`, map[string]interface{}{}, []string{"allow_messages"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+				t.Fatal(err)
+			}
+			updates, fieldErrors := ApplyMergePatch(patch, tt.fields)
+			if !reflect.DeepEqual(updates, tt.wantUpdates) {
+				t.Errorf("updates = %v, want %v", updates, tt.wantUpdates)
+			}
+			var rejected []string
+			for name := range fieldErrors {
+				rejected = append(rejected, name)
+			}
+			sort.Strings(rejected)
+			if strings.Join(rejected, ",") != strings.Join(tt.wantErrors, ",") {
+				t.Errorf("rejected %v (%v), want %v", rejected, fieldErrors, tt.wantErrors)
+			}
+		})
+	}
+}
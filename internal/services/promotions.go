@@ -0,0 +1,305 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"gorm.io/gorm"
+)
+
+// PromotionDailyRates is the price of each promotion type per day, in pence
+var PromotionDailyRates = map[string]int64{
+	models.PromotionTopOfCategory: 199,
+	models.PromotionHomepage:      499,
+	models.PromotionHighlight:     99,
+}
+
+// PromotionSlots is how many promotions of a type can run at once, per category for top of category. Zero is unlimited
+var PromotionSlots = map[string]int64{
+	models.PromotionTopOfCategory: 3,
+	models.PromotionHomepage:      8,
+	models.PromotionHighlight:     0,
+}
+
+var (
+	ErrPromotionSlotsFull = errors.New("no promotion slots left for this period")
+	ErrPromotionOverlap   = errors.New("the ad already has a promotion of this type for this period")
+	ErrPromotionEnded     = errors.New("the promotion already ended")
+)
+
+const promotionPaymentWindow = 30 * time.Minute // How long an unpaid promotion holds its slot
+
+// bookedPromotionStatuses are the statuses of promotions taking a slot
+var bookedPromotionStatuses = []string{
+	models.PromotionStatusPendingPayment,
+	models.PromotionStatusScheduled,
+	models.PromotionStatusActive,
+}
+
+const promotionImpressionsDirtyKey = "promotion_impressions_dirty" // Set of promotions with unflushed impressions
+
+func promotionImpressionsKey(promotionID uint) string {
+	return fmt.Sprintf("promotion_impressions:%d", promotionID)
+}
+
+/*
+BookPromotion saves a promotion if a slot of its type is free for its whole period.
+Bookings of a type are serialised with an advisory lock so two sellers can't take the last slot.
+Unpaid promotions hold their slot for promotionPaymentWindow.
+*/
+func BookPromotion(promotion *models.Promotion) error {
+	return initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "promotion_slots:"+promotion.Type).Error; err != nil {
+			return err
+		}
+
+		overlapping := tx.Model(&models.Promotion{}).
+			Where("type = ? AND status IN ?", promotion.Type, bookedPromotionStatuses).
+			Where("starts_at < ? AND ends_at > ?", promotion.EndsAt, promotion.StartsAt)
+
+		var sameAd int64
+		if err := overlapping.Session(&gorm.Session{}).Where("ad_id = ?", promotion.AdID).Count(&sameAd).Error; err != nil {
+			return err
+		}
+		if sameAd > 0 {
+			return ErrPromotionOverlap
+		}
+
+		if slots := PromotionSlots[promotion.Type]; slots > 0 {
+			if promotion.Type == models.PromotionTopOfCategory {
+				overlapping = overlapping.Where("category_id = ?", promotion.CategoryID)
+			}
+			var taken int64
+			if err := overlapping.Count(&taken).Error; err != nil {
+				return err
+			}
+			if taken >= slots {
+				return ErrPromotionSlotsFull
+			}
+		}
+
+		return tx.Omit("Ad", "User").Create(promotion).Error
+	})
+}
+
+/*
+HandlePromotionPayment applies a verified provider webhook to the promotion it pays for.
+A payment arriving after the promotion was cancelled or its payment window ended is refunded.
+*/
+func HandlePromotionPayment(promotion models.Promotion, event PaymentEvent) error {
+	switch event.Type {
+	case PaymentSucceeded:
+		if promotion.PaidAt != nil {
+			return nil
+		}
+		now := time.Now()
+		status := models.PromotionStatusScheduled
+		if !promotion.StartsAt.After(now) {
+			status = models.PromotionStatusActive
+		}
+		result := initializers.DB.Model(&promotion).Where("status = ?", models.PromotionStatusPendingPayment).
+			Updates(map[string]interface{}{"status": status, "paid_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			log.Printf("Refunding payment %s of ended promotion %d", event.Reference, promotion.ID)
+			return refundPromotion(promotion, now)
+		}
+	case PaymentRefunded:
+		// Refunded through the provider, the promotion stops
+		return initializers.DB.Model(&promotion).Where("status IN ?", bookedPromotionStatuses).
+			Updates(map[string]interface{}{"status": models.PromotionStatusCancelled, "cancelled_at": time.Now()}).Error
+	case PaymentFailed:
+		log.Printf("Payment %s of promotion %d failed", event.Reference, promotion.ID)
+	}
+	return nil
+}
+
+/*
+CancelPromotion stops a promotion before it ends. Paid promotions cancelled before they start
+are refunded in full, those already running are not.
+*/
+func CancelPromotion(promotion *models.Promotion) error {
+	now := time.Now()
+	wasStarted := promotion.Status == models.PromotionStatusActive || !promotion.StartsAt.After(now)
+	result := initializers.DB.Model(promotion).
+		Where("status IN ?", bookedPromotionStatuses).
+		Updates(map[string]interface{}{
+			"status":       models.PromotionStatusCancelled,
+			"cancelled_at": now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPromotionEnded
+	}
+	promotion.Status = models.PromotionStatusCancelled
+	promotion.CancelledAt = &now
+
+	// Failed refunds are retried by RefundCancelledPromotions
+	if promotion.PaidAt != nil && !wasStarted {
+		if err := refundPromotion(*promotion, now); err != nil {
+			log.Printf("Failed to refund cancelled promotion %d: %v", promotion.ID, err)
+		}
+	}
+	return nil
+}
+
+// RefundCancelledPromotions refunds paid promotions cancelled before they started whose refund failed
+func RefundCancelledPromotions() (int, error) {
+	var promotions []models.Promotion
+	if err := initializers.DB.
+		Where("status = ? AND paid_at IS NOT NULL AND refund_ref = '' AND cancelled_at < starts_at", models.PromotionStatusCancelled).
+		Find(&promotions).Error; err != nil {
+		return 0, err
+	}
+
+	refunded := 0
+	for _, promotion := range promotions {
+		if err := refundPromotion(promotion, time.Now()); err != nil {
+			log.Printf("Failed to refund cancelled promotion %d: %v", promotion.ID, err)
+			continue
+		}
+		refunded++
+	}
+	return refunded, nil
+}
+
+// refundPromotion refunds the payment of a promotion, once
+func refundPromotion(promotion models.Promotion, now time.Time) error {
+	refundRef, err := Payments.Refund(promotion.PaymentRef)
+	if err != nil {
+		return err
+	}
+	return initializers.DB.Model(&promotion).Updates(map[string]interface{}{"refund_ref": refundRef, "updated_at": now}).Error
+}
+
+// HasBookedPromotion reports whether the ad has a promotion of the type that is unpaid, scheduled or running
+func HasBookedPromotion(adID uint, promotionType string) (bool, error) {
+	var count int64
+	err := initializers.DB.Model(&models.Promotion{}).
+		Where("ad_id = ? AND type = ? AND status IN ?", adID, promotionType, bookedPromotionStatuses).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// PromotedAds is a query scope keeping ads with an active promotion of the given type
+func PromotedAds(promotionType string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("ads.id IN (SELECT ad_id FROM promotions WHERE type = ? AND status = ? AND deleted_at IS NULL)",
+			promotionType, models.PromotionStatusActive)
+	}
+}
+
+// ActivePromotions maps each of the ads with an active promotion of the given type to that promotion
+func ActivePromotions(promotionType string, adIDs []uint) (map[uint]uint, error) {
+	promotions := map[uint]uint{}
+	if len(adIDs) == 0 {
+		return promotions, nil
+	}
+
+	var rows []models.Promotion
+	if err := initializers.DB.Select("id, ad_id").
+		Where("type = ? AND status = ? AND ad_id IN ?", promotionType, models.PromotionStatusActive, adIDs).
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		promotions[row.AdID] = row.ID
+	}
+	return promotions, nil
+}
+
+// RecordPromotionImpressions counts one impression of each promotion, buffered in Redis
+func RecordPromotionImpressions(promotionIDs []uint) {
+	if len(promotionIDs) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	pipe := initializers.RedisClient.Pipeline()
+	members := make([]interface{}, 0, len(promotionIDs))
+	for _, id := range promotionIDs {
+		pipe.Incr(ctx, promotionImpressionsKey(id))
+		members = append(members, id)
+	}
+	pipe.SAdd(ctx, promotionImpressionsDirtyKey, members...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to record promotion impressions: %v", err)
+	}
+}
+
+/*
+FlushPromotionImpressions adds the impressions buffered in Redis to the promotions table.
+Counters are only decreased by what was written, so impressions recorded meanwhile or lost
+to a failed write are flushed on the next run.
+*/
+func FlushPromotionImpressions() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	members, err := initializers.RedisClient.SMembers(ctx, promotionImpressionsDirtyKey).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		id, err := strconv.ParseUint(member, 10, 64)
+		// Removed from the set first, impressions recorded meanwhile add it back
+		initializers.RedisClient.SRem(ctx, promotionImpressionsDirtyKey, member)
+		if err != nil {
+			continue
+		}
+
+		key := promotionImpressionsKey(uint(id))
+		count, err := initializers.RedisClient.Get(ctx, key).Int64()
+		if err != nil || count == 0 {
+			continue
+		}
+		if err := initializers.DB.Model(&models.Promotion{}).Where("id = ?", id).
+			UpdateColumn("impressions", gorm.Expr("impressions + ?", count)).Error; err != nil {
+			log.Printf("Failed to flush %d impressions of promotion %d: %v", count, id, err)
+			initializers.RedisClient.SAdd(ctx, promotionImpressionsDirtyKey, member)
+			continue
+		}
+		if err := initializers.RedisClient.DecrBy(ctx, key, count).Err(); err != nil {
+			log.Printf("Failed to clear %d flushed impressions of promotion %d: %v", count, id, err)
+		}
+	}
+	return nil
+}
+
+// ActivateScheduledPromotions starts the scheduled promotions whose start time has come
+func ActivateScheduledPromotions() (int64, error) {
+	now := time.Now()
+	result := initializers.DB.Model(&models.Promotion{}).
+		Where("status = ? AND starts_at <= ? AND ends_at > ?", models.PromotionStatusScheduled, now, now).
+		Update("status", models.PromotionStatusActive)
+	return result.RowsAffected, result.Error
+}
+
+/*
+ExpirePromotions ends promotions past their end time, over their impression budget, left unpaid
+past the payment window, or whose ad is no longer listed.
+*/
+func ExpirePromotions() (int64, error) {
+	now := time.Now()
+	result := initializers.DB.Model(&models.Promotion{}).
+		Where("status IN ?", bookedPromotionStatuses).
+		Where(initializers.DB.Where("ends_at <= ?", now).
+			Or("status = ? AND created_at <= ?", models.PromotionStatusPendingPayment, now.Add(-promotionPaymentWindow)).
+			Or("max_impressions IS NOT NULL AND impressions >= max_impressions").
+			Or("ad_id NOT IN (SELECT id FROM ads WHERE status IN ? AND deleted_at IS NULL)",
+				[]string{models.AdStatusActive, models.AdStatusReserved})).
+		Update("status", models.PromotionStatusExpired)
+	return result.RowsAffected, result.Error
+}
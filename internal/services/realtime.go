@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/redis/go-redis/v9"
+)
+
+// Real-time event types
+const (
+	EventMessageNew  = "message.new"
+	EventMessageRead = "message.read"
+	EventTyping      = "typing"
+	EventOfferNew    = "offer.new"
+	EventOfferUpdate = "offer.updated"
+	EventSearchMatch = "saved_search.matches"
+	EventFavoriteAd  = "favorite.alert"
+	EventOrderUpdate = "order.updated"
+)
+
+const (
+	eventStreamMaxLen = 500                // Events kept per user for resuming
+	eventStreamTTL    = 7 * 24 * time.Hour // Idle streams expire
+	realtimeTicketTTL = 30 * time.Second   // Lifetime of an unused real-time ticket
+)
+
+/*
+Event is delivered to every connection of a user. Persisted events carry the ID of
+their Redis stream entry, which clients send back as Last-Event-ID to resume.
+Ephemeral events such as typing indicators have no ID and are never replayed.
+*/
+type Event struct {
+	ID   string          `json:"id,omitempty"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+func userEventChannel(userID uint) string {
+	return fmt.Sprintf("user_events:%d", userID)
+}
+
+func userEventStream(userID uint) string {
+	return fmt.Sprintf("user_event_stream:%d", userID)
+}
+
+/*
+PublishEvent sends an event to every API replica holding a connection of the user.
+Persisted events are also appended to the user's stream so they can be replayed.
+*/
+func PublishEvent(userID uint, eventType string, data interface{}, persist bool) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Failed to marshal %s event: %v", eventType, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	event := Event{Type: eventType, Data: payload}
+	if persist {
+		stream := userEventStream(userID)
+		event.ID, err = initializers.RedisClient.XAdd(ctx, &redis.XAddArgs{
+			Stream: stream,
+			MaxLen: eventStreamMaxLen,
+			Approx: true,
+			Values: map[string]interface{}{"type": eventType, "data": string(payload)},
+		}).Result()
+		if err != nil {
+			log.Printf("Failed to store %s event for user %d: %v", eventType, userID, err)
+			return
+		}
+		initializers.RedisClient.Expire(ctx, stream, eventStreamTTL)
+	}
+
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	if err := initializers.RedisClient.Publish(ctx, userEventChannel(userID), encoded).Err(); err != nil {
+		log.Printf("Failed to publish %s event for user %d: %v", eventType, userID, err)
+	}
+}
+
+/*
+RealtimeTicket authenticates a single WebSocket or EventSource connection. Browsers can't
+set headers on those, and a JWT in the query string would end up in access logs, so clients
+exchange their token for a short-lived ticket first. Session is the hash of that token.
+*/
+type RealtimeTicket struct {
+	UserID  uint   `json:"user_id"`
+	Session string `json:"session"`
+}
+
+func realtimeTicketKey(ticket string) string {
+	return fmt.Sprintf("realtime_ticket:%s", TokenHash(ticket))
+}
+
+// IssueRealtimeTicket creates a single-use ticket for a session of the user
+func IssueRealtimeTicket(userID uint, session string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(buf)
+
+	data, err := json.Marshal(RealtimeTicket{UserID: userID, Session: session})
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := initializers.RedisClient.Set(ctx, realtimeTicketKey(ticket), data, realtimeTicketTTL).Err(); err != nil {
+		return "", err
+	}
+	return ticket, nil
+}
+
+// RedeemRealtimeTicket consumes a ticket, reporting false when it is unknown, expired or already used
+func RedeemRealtimeTicket(ticket string) (RealtimeTicket, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	data, err := initializers.RedisClient.GetDel(ctx, realtimeTicketKey(ticket)).Bytes()
+	if err == redis.Nil {
+		return RealtimeTicket{}, false, nil
+	}
+	if err != nil {
+		return RealtimeTicket{}, false, err
+	}
+
+	var redeemed RealtimeTicket
+	if err := json.Unmarshal(data, &redeemed); err != nil {
+		return RealtimeTicket{}, false, err
+	}
+	return redeemed, true, nil
+}
+
+// SubscribeUserEvents subscribes to a user's live events. The caller must close the subscription
+func SubscribeUserEvents(ctx context.Context, userID uint) (*redis.PubSub, error) {
+	pubsub := initializers.RedisClient.Subscribe(ctx, userEventChannel(userID))
+
+	// Wait for the subscription to be confirmed so no event published after this call is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+	return pubsub, nil
+}
+
+// ReplayEvents returns the persisted events of a user after lastEventID
+func ReplayEvents(ctx context.Context, userID uint, lastEventID string) ([]Event, error) {
+	entries, err := initializers.RedisClient.XRange(ctx, userEventStream(userID), "("+lastEventID, "+").Result()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]Event, 0, len(entries))
+	for _, entry := range entries {
+		eventType, _ := entry.Values["type"].(string)
+		data, _ := entry.Values["data"].(string)
+		events = append(events, Event{ID: entry.ID, Type: eventType, Data: json.RawMessage(data)})
+	}
+	return events, nil
+}
+
+// ParseEvent decodes a message received from a user's event channel
+func ParseEvent(payload string) (Event, error) {
+	var event Event
+	err := json.Unmarshal([]byte(payload), &event)
+	return event, err
+}
+
+// EventAfter reports whether a stream event ID is strictly greater than lastID
+func EventAfter(id, lastID string) bool {
+	if lastID == "" || id == "" {
+		return true
+	}
+	var idMs, idSeq, lastMs, lastSeq uint64
+	fmt.Sscanf(id, "%d-%d", &idMs, &idSeq)
+	fmt.Sscanf(lastID, "%d-%d", &lastMs, &lastSeq)
+	return idMs > lastMs || (idMs == lastMs && idSeq > lastSeq)
+}
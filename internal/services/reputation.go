@@ -0,0 +1,38 @@
+package services
+
+import (
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+)
+
+const responseTimeWindow = 90 * 24 * time.Hour // Conversations considered for response time
+
+/*
+TypicalResponseTime returns the median time a seller took to first reply to a buyer
+in recent conversations, or nil when they haven't replied to any yet.
+*/
+func TypicalResponseTime(sellerID uint) (*time.Duration, error) {
+	var seconds *float64
+	err := initializers.DB.Raw(`
+		SELECT percentile_cont(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM reply.created_at - first.created_at))
+		FROM conversations c
+		JOIN LATERAL (
+			SELECT MIN(created_at) AS created_at FROM messages m
+			WHERE m.conversation_id = c.id AND m.sender_id = c.buyer_id AND m.deleted_at IS NULL
+		) first ON true
+		JOIN LATERAL (
+			SELECT MIN(created_at) AS created_at FROM messages m
+			WHERE m.conversation_id = c.id AND m.sender_id = c.seller_id AND m.deleted_at IS NULL
+			AND m.created_at >= first.created_at
+		) reply ON true
+		WHERE c.seller_id = ? AND c.created_at >= ? AND c.deleted_at IS NULL AND reply.created_at IS NOT NULL`,
+		sellerID, time.Now().Add(-responseTimeWindow)).
+		Scan(&seconds).Error
+	if err != nil || seconds == nil {
+		return nil, err
+	}
+
+	duration := time.Duration(*seconds * float64(time.Second))
+	return &duration, nil
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+)
+
+const ratingCacheTTL = time.Hour // Rating summaries are recomputed at least this often
+
+// RatingSummary is the average of the visible reviews a user received
+type RatingSummary struct {
+	Average *float64 // nil without reviews
+	Count   int64
+}
+
+func userRatingKey(userID uint) string {
+	return fmt.Sprintf("user_rating:%d", userID)
+}
+
+// UserRating returns the cached rating summary of a user, computing it on a cache miss
+func UserRating(userID uint) (RatingSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	key := userRatingKey(userID)
+	if cached, err := initializers.RedisClient.HGetAll(ctx, key).Result(); err == nil && len(cached) > 0 {
+		var summary RatingSummary
+		summary.Count, _ = strconv.ParseInt(cached["count"], 10, 64)
+		if average, err := strconv.ParseFloat(cached["average"], 64); err == nil {
+			summary.Average = &average
+		}
+		return summary, nil
+	}
+
+	var summary RatingSummary
+	if err := initializers.DB.Model(&models.Review{}).
+		Select("AVG(rating) AS average, COUNT(*) AS count").
+		Where("reviewee_id = ? AND hidden_at IS NULL", userID).
+		Scan(&summary).Error; err != nil {
+		return RatingSummary{}, err
+	}
+
+	average := ""
+	if summary.Average != nil {
+		average = strconv.FormatFloat(*summary.Average, 'f', -1, 64)
+	}
+	pipe := initializers.RedisClient.TxPipeline()
+	pipe.HSet(ctx, key, "average", average, "count", summary.Count)
+	pipe.Expire(ctx, key, ratingCacheTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to cache rating of user %d: %v", userID, err)
+	}
+	return summary, nil
+}
+
+// InvalidateUserRating drops the cached rating summary after a review of the user changed
+func InvalidateUserRating(userID uint) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	if err := initializers.RedisClient.Del(ctx, userRatingKey(userID)).Err(); err != nil {
+		log.Printf("Failed to invalidate rating of user %d: %v", userID, err)
+	}
+}
+
+/*
+SetReviewHidden hides or restores a review, for moderation. Hidden reviews no longer count
+towards the reviewee's rating. actorID is nil when the system hides a review automatically.
+*/
+func SetReviewHidden(review *models.Review, hidden bool, reason string, actorID *uint) error {
+	var hiddenAt *time.Time
+	if hidden {
+		now := time.Now()
+		hiddenAt = &now
+	} else {
+		reason = ""
+	}
+
+	if err := initializers.DB.Model(review).Updates(map[string]interface{}{
+		"hidden_at":     hiddenAt,
+		"hidden_reason": reason,
+	}).Error; err != nil {
+		return err
+	}
+	review.HiddenAt = hiddenAt
+	review.HiddenReason = reason
+	InvalidateUserRating(review.RevieweeID)
+
+	action := AuditReviewUnhidden
+	if hidden {
+		action = AuditReviewHidden
+	}
+	Audit(action, actorID, "review", review.ID, map[string]interface{}{"reason": reason})
+	return nil
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+)
+
+/*
+MatchSavedSearches records the ad as a pending match of every active saved search it satisfies.
+Keywords must all appear in the title or description. The owner's own searches are skipped,
+as are the searches of users the owner blocked and of accounts pending deletion or suspended.
+*/
+func MatchSavedSearches(ad models.Ad) (int64, error) {
+	result := initializers.DB.Exec(`
+		INSERT INTO saved_search_matches (saved_search_id, ad_id, created_at)
+		SELECT s.id, ?, NOW() FROM saved_searches s
+		WHERE s.deleted_at IS NULL AND s.paused_at IS NULL AND s.user_id <> ?
+		AND (s.category_id IS NULL OR s.category_id = ?)
+		AND (s.condition = '' OR s.condition = ?)
+		AND (s.city = '' OR LOWER(s.city) = LOWER(?))
+		AND (s.min_price IS NULL OR s.min_price <= ?)
+		AND (s.max_price IS NULL OR s.max_price >= ?)
+		AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = ? AND b.blocked_id = s.user_id)
+		AND NOT EXISTS (SELECT 1 FROM users u WHERE u.id = s.user_id AND (u.deactivated_at IS NOT NULL OR u.suspended_at IS NOT NULL))
+		AND (s.keywords = '' OR to_tsvector('simple', ? || ' ' || ?) @@ plainto_tsquery('simple', s.keywords))
+		ON CONFLICT DO NOTHING`,
+		ad.ID, ad.UserID, ad.CategoryID, ad.Condition, ad.City, ad.Price, ad.Price, ad.UserID, ad.Title, ad.Description)
+	return result.RowsAffected, result.Error
+}
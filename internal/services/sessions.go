@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+)
+
+const redisTimeout = 5 * time.Second // Timeout for Redis operations
+
+// TokenHash is the Redis key of the session belonging to a JWT
+func TokenHash(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// SessionExists reports whether a token still has an active Redis session
+func SessionExists(token string) (bool, error) {
+	return SessionHashExists(TokenHash(token))
+}
+
+// SessionHashExists reports whether the session stored under a token hash is still active
+func SessionHashExists(tokenHash string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	count, err := initializers.RedisClient.Exists(ctx, tokenHash).Result()
+	return count > 0, err
+}
+
+// UserSessionKey is the Redis sorted set of a user's session token hashes
+func UserSessionKey(userID uint) string {
+	return fmt.Sprintf("user_sessions:%d", userID)
+}
+
+// MagicLinkRateKey is the Redis counter rate limiting magic links sent to an email address
+func MagicLinkRateKey(email string) string {
+	return fmt.Sprintf("magic_link_rate:%s", strings.ToLower(email))
+}
+
+// userRedisKeys lists the per-user Redis keys that must not outlive the account
+func userRedisKeys(user models.User) []string {
+	return []string{
+		UserSessionKey(user.ID),
+		fmt.Sprintf("phone_otp:%d", user.ID),
+		fmt.Sprintf("phone_otp_attempts:%d", user.ID),
+		fmt.Sprintf("contact_reveal_rate:%d", user.ID),
+		MagicLinkRateKey(user.Email),
+		userRatingKey(user.ID),
+	}
+}
+
+// RevokeUserSessions deletes every active session of a user
+func RevokeUserSessions(userID uint) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	sessionKey := UserSessionKey(userID)
+	tokenHashes, err := initializers.RedisClient.ZRange(ctx, sessionKey, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := initializers.RedisClient.TxPipeline()
+	for _, tokenHash := range tokenHashes {
+		pipe.Del(ctx, tokenHash)
+	}
+	pipe.Del(ctx, sessionKey)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// PurgeUserRedisKeys revokes all sessions and removes every per-user Redis key
+func PurgeUserRedisKeys(user models.User) error {
+	if err := RevokeUserSessions(user.ID); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return initializers.RedisClient.Del(ctx, userRedisKeys(user)...).Err()
+}
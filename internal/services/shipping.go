@@ -0,0 +1,174 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/Desk888/api/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDeliveryUnavailable = errors.New("the seller doesn't offer this delivery method")
+	ErrDeliveryPostcode    = errors.New("delivery needs a valid postcode of the buyer")
+	ErrOutsideDeliveryArea = errors.New("the postcode is outside the seller's local delivery area")
+)
+
+/*
+ShippingRateCalculator prices sending a parcel between two postcodes.
+toPostcode is empty for the starting price shown on listings.
+*/
+type ShippingRateCalculator interface {
+	Name() string
+	Quote(parcelSize, fromPostcode, toPostcode string) (int64, error)
+}
+
+// TableRateCalculator charges a flat rate per parcel size, with a surcharge when either end is in a remote area
+type TableRateCalculator struct {
+	Rates           map[string]int64 // In pence, by parcel size
+	RemoteSurcharge int64            // In pence
+	RemoteAreas     []string         // Postcode areas, the letters starting a postcode
+}
+
+func (t *TableRateCalculator) Name() string {
+	return "table"
+}
+
+func (t *TableRateCalculator) Quote(parcelSize, fromPostcode, toPostcode string) (int64, error) {
+	rate, ok := t.Rates[parcelSize]
+	if !ok {
+		return 0, fmt.Errorf("no shipping rate for parcel size %q", parcelSize)
+	}
+	if t.isRemote(fromPostcode) || t.isRemote(toPostcode) {
+		rate += t.RemoteSurcharge
+	}
+	return rate, nil
+}
+
+func (t *TableRateCalculator) isRemote(postcode string) bool {
+	area := postcodeArea(postcode)
+	for _, remote := range t.RemoteAreas {
+		if area != "" && area == remote {
+			return true
+		}
+	}
+	return false
+}
+
+// postcodeArea returns the letters starting a postcode, e.g. "ZE" for "ZE1 0AA"
+func postcodeArea(postcode string) string {
+	district := PostcodeDistrict(postcode)
+	end := 0
+	for end < len(district) && district[end] >= 'A' && district[end] <= 'Z' {
+		end++
+	}
+	return district[:end]
+}
+
+// DefaultShippingRates are the standard courier rates, with a surcharge for the Highlands and Islands, Northern Ireland and the Crown Dependencies
+var DefaultShippingRates = &TableRateCalculator{
+	Rates: map[string]int64{
+		models.ParcelSmall:      299,
+		models.ParcelMedium:     449,
+		models.ParcelLarge:      699,
+		models.ParcelExtraLarge: 1499,
+	},
+	RemoteSurcharge: 500,
+	RemoteAreas:     []string{"BT", "GY", "HS", "IM", "IV", "JE", "KW", "ZE"},
+}
+
+var Shipping ShippingRateCalculator = DefaultShippingRates // Active shipping rate calculator
+
+/*
+InitShipping selects the shipping rate calculator from SHIPPING_RATES_PROVIDER.
+Carrier APIs are registered here as they are integrated; "table" is the default.
+*/
+func InitShipping() {
+	switch provider := os.Getenv("SHIPPING_RATES_PROVIDER"); provider {
+	case "", "table":
+		Shipping = DefaultShippingRates
+	default:
+		log.Fatalf("Unknown SHIPPING_RATES_PROVIDER: %s", provider)
+	}
+}
+
+// Delivery is how an item reaches the buyer and what it costs them
+type Delivery struct {
+	Method   string
+	Postcode string // Buyer's postcode, empty for pickup
+	Cost     int64  // In pence
+}
+
+// QuoteDelivery prices delivering the ad to postcode by one of the methods its seller offers
+func QuoteDelivery(ad models.Ad, method, postcode string) (Delivery, error) {
+	if !ad.OffersDelivery(method) {
+		return Delivery{}, ErrDeliveryUnavailable
+	}
+	delivery := Delivery{Method: method}
+	if method == models.DeliveryPickup {
+		return delivery, nil
+	}
+
+	postcode = strings.ToUpper(strings.TrimSpace(postcode))
+	if !ValidPostcode(postcode) {
+		return Delivery{}, ErrDeliveryPostcode
+	}
+	delivery.Postcode = postcode
+
+	switch method {
+	case models.DeliveryLocal:
+		// Local delivery is checked against the district centroid, parcels can go to any postcode
+		point, ok := GeocodePostcode(postcode)
+		if !ok {
+			return Delivery{}, ErrDeliveryPostcode
+		}
+		if ad.Latitude == nil || ad.Longitude == nil ||
+			DistanceKm(point, Coordinates{Latitude: *ad.Latitude, Longitude: *ad.Longitude}) > float64(ad.LocalDeliveryKm) {
+			return Delivery{}, ErrOutsideDeliveryArea
+		}
+		delivery.Cost = ad.LocalDeliveryPrice
+	case models.DeliveryShipping:
+		cost, err := Shipping.Quote(ad.ParcelSize, ad.Postcode, postcode)
+		if err != nil {
+			return Delivery{}, err
+		}
+		delivery.Cost = cost
+	}
+	return delivery, nil
+}
+
+/*
+AdsOfferingDelivery is a query scope keeping ads that offer any of the delivery methods.
+Local delivery only matches ads whose delivery radius reaches point, which it requires.
+*/
+func AdsOfferingDelivery(methods map[string]bool, point *Coordinates) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		var conditions []string
+		var args []interface{}
+		for _, method := range models.DeliveryMethods {
+			if !methods[method] {
+				continue
+			}
+			switch method {
+			case models.DeliveryPickup:
+				conditions = append(conditions, "ads.pickup_available")
+			case models.DeliveryShipping:
+				conditions = append(conditions, "ads.parcel_size <> ''")
+			case models.DeliveryLocal:
+				if point == nil {
+					continue
+				}
+				conditions = append(conditions, "(ads.local_delivery_km > 0 AND "+
+					"earth_distance(ll_to_earth(?, ?), ll_to_earth(ads.latitude, ads.longitude)) <= ads.local_delivery_km * 1000)")
+				args = append(args, point.Latitude, point.Longitude)
+			}
+		}
+		if len(conditions) == 0 {
+			return db.Where("FALSE")
+		}
+		return db.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+}
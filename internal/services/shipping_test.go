@@ -0,0 +1,44 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/Desk888/api/internal/models"
+)
+
+func TestTableRateCalculatorQuote(t *testing.T) {
+	calculator := &TableRateCalculator{
+		Rates: map[string]int64{
+			models.ParcelSmall: 299,
+			models.ParcelLarge: 699,
+		},
+		RemoteSurcharge: 500,
+		RemoteAreas:     []string{"BT", "ZE"},
+	}
+
+	tests := []struct {
+		name       string
+		parcelSize string
+		from       string
+		to         string
+		want       int64
+		wantErr    bool
+	}{
+		{"small", models.ParcelSmall, "SW1A 1AA", "M1 1AE", 299, false},
+		{"large", models.ParcelLarge, "SW1A 1AA", "M1 1AE", 699, false},
+		{"unknown parcel size", models.ParcelMedium, "SW1A 1AA", "M1 1AE", 0, true},
+		{"empty parcel size", "", "SW1A 1AA", "M1 1AE", 0, true},
+		{"remote sender", models.ParcelSmall, "ZE1 0AA", "M1 1AE", 799, false},
+		{"remote buyer", models.ParcelSmall, "SW1A 1AA", "bt1 1aa", 799, false},
+		{"both remote", models.ParcelSmall, "ZE1 0AA", "BT1 1AA", 799, false},
+		{"area prefix isn't remote", models.ParcelSmall, "B33 8TH", "Z1 1AA", 299, false},
+		{"starting price", models.ParcelSmall, "SW1A 1AA", "", 299, false},
+		{"starting price from remote", models.ParcelSmall, "ZE1 0AA", "", 799, false},
+	}
+	for _, tt := range tests {
+		got, err := calculator.Quote(tt.parcelSize, tt.from, tt.to)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("%s: Quote(%q, %q, %q) = %d, %v, want %d, error %v", tt.name, tt.parcelSize, tt.from, tt.to, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
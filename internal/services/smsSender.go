@@ -0,0 +1,35 @@
+package services
+
+import (
+	"log"
+	"os"
+)
+
+// SMSSender delivers text messages through an SMS gateway
+type SMSSender interface {
+	Send(to, message string) error
+}
+
+// LogSMSSender writes messages to the log instead of sending them, for development and tests
+type LogSMSSender struct{}
+
+func (LogSMSSender) Send(to, message string) error {
+	log.Printf("SMS to %s: %s", to, message)
+	return nil
+}
+
+var SMS SMSSender = LogSMSSender{} // Active SMS gateway
+
+/*
+InitSMS selects the SMS gateway from SMS_PROVIDER.
+Gateways are registered here as they are integrated; "log" is the default.
+*/
+func InitSMS() {
+	switch provider := os.Getenv("SMS_PROVIDER"); provider {
+	case "", "log":
+		SMS = LogSMSSender{}
+		log.Println("Using log SMS sender, text messages will not be delivered")
+	default:
+		log.Fatalf("Unknown SMS_PROVIDER: %s", provider)
+	}
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	storageTimeout  = 30 * time.Second // Timeout for S3 operations
+	signedURLExpiry = time.Hour        // Lifetime of presigned download URLs
+)
+
+// PutObject uploads a file to the configured bucket
+func PutObject(key string, data []byte, contentType string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+
+	_, err := initializers.S3Client.PutObject(ctx, initializers.S3Bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType:  contentType,
+		CacheControl: "public, max-age=31536000, immutable",
+	})
+	return err
+}
+
+// GetObject downloads a file from the configured bucket
+func GetObject(key string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+
+	object, err := initializers.S3Client.GetObject(ctx, initializers.S3Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+	return io.ReadAll(object)
+}
+
+// ListObjectKeys returns the keys of every file whose key starts with prefix
+func ListObjectKeys(prefix string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+
+	var keys []string
+	for object := range initializers.S3Client.ListObjects(ctx, initializers.S3Bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		keys = append(keys, object.Key)
+	}
+	return keys, nil
+}
+
+// DeleteObjects removes files from the configured bucket, logging failures
+func DeleteObjects(keys ...string) {
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+
+	for _, key := range keys {
+		if err := initializers.S3Client.RemoveObject(ctx, initializers.S3Bucket, key, minio.RemoveObjectOptions{}); err != nil {
+			log.Printf("Failed to delete S3 object %s: %v", key, err)
+		}
+	}
+}
+
+// DeletePrefix removes every file whose key starts with prefix
+func DeletePrefix(prefix string) {
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+
+	objects := initializers.S3Client.ListObjects(ctx, initializers.S3Bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true})
+	for err := range initializers.S3Client.RemoveObjects(ctx, initializers.S3Bucket, objects, minio.RemoveObjectsOptions{}) {
+		log.Printf("Failed to delete S3 object %s: %v", err.ObjectName, err.Err)
+	}
+}
+
+// PresignedURL returns a private download URL valid for expiry, regardless of S3_PUBLIC_URL
+func PresignedURL(key string, expiry time.Duration, downloadName string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+
+	params := url.Values{}
+	if downloadName != "" {
+		params.Set("response-content-disposition", `attachment; filename="`+downloadName+`"`)
+	}
+
+	signed, err := initializers.S3Client.PresignedGetObject(ctx, initializers.S3Bucket, key, expiry, params)
+	if err != nil {
+		return "", err
+	}
+	return signed.String(), nil
+}
+
+/*
+ObjectURL returns a URL clients can load a file from. When S3_PUBLIC_URL is set the
+bucket is assumed to be publicly readable behind it, otherwise a presigned URL is issued.
+*/
+func ObjectURL(key string) string {
+	if base := os.Getenv("S3_PUBLIC_URL"); base != "" {
+		return strings.TrimRight(base, "/") + "/" + initializers.S3Bucket + "/" + key
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+
+	signed, err := initializers.S3Client.PresignedGetObject(ctx, initializers.S3Bucket, key, signedURLExpiry, url.Values{})
+	if err != nil {
+		log.Printf("Failed to presign S3 object %s: %v", key, err)
+		return ""
+	}
+	return signed.String()
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+)
+
+// DeviceInfo is the result of parsing a User-Agent header
+type DeviceInfo struct {
+	Device  string `json:"device"`
+	Browser string `json:"browser"`
+	OS      string `json:"os"`
+}
+
+// userAgentTokens splits a lowercased User-Agent into its alphanumeric words
+func userAgentTokens(lower string) map[string]bool {
+	tokens := map[string]bool{}
+	for _, token := range strings.FieldsFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		tokens[token] = true
+	}
+	return tokens
+}
+
+/*
+ParseUserAgent extracts the device type, browser and operating system from a User-Agent.
+Matching order matters: Edge and Opera also announce Chrome, and Chrome announces Safari.
+*/
+func ParseUserAgent(ua string) DeviceInfo {
+	info := DeviceInfo{Device: "Desktop", Browser: "Unknown", OS: "Unknown"}
+	lower := strings.ToLower(ua)
+	if lower == "" {
+		info.Device = "Unknown"
+		return info
+	}
+
+	switch {
+	case strings.Contains(lower, "bot"), strings.Contains(lower, "spider"), strings.Contains(lower, "crawl"):
+		info.Device = "Bot"
+	case strings.Contains(lower, "ipad"), strings.Contains(lower, "tablet"),
+		strings.Contains(lower, "android") && !strings.Contains(lower, "mobile"):
+		info.Device = "Tablet"
+	case strings.Contains(lower, "mobi"), strings.Contains(lower, "iphone"):
+		info.Device = "Mobile"
+	}
+
+	switch {
+	case strings.Contains(lower, "edg/"), strings.Contains(lower, "edge/"):
+		info.Browser = "Edge"
+	case strings.Contains(lower, "opr/"), strings.Contains(lower, "opera"):
+		info.Browser = "Opera"
+	case strings.Contains(lower, "samsungbrowser"):
+		info.Browser = "Samsung Internet"
+	case strings.Contains(lower, "firefox/"), strings.Contains(lower, "fxios/"):
+		info.Browser = "Firefox"
+	case strings.Contains(lower, "chrome/"), strings.Contains(lower, "crios/"):
+		info.Browser = "Chrome"
+	case strings.Contains(lower, "safari/"):
+		info.Browser = "Safari"
+	case strings.Contains(lower, "curl/"), strings.Contains(lower, "postman"), strings.Contains(lower, "okhttp"):
+		info.Browser = "API Client"
+	}
+
+	// Operating systems are matched on whole words, "cros" also appears inside "microsoft"
+	tokens := userAgentTokens(lower)
+	switch {
+	case tokens["iphone"], tokens["ipad"], tokens["ipod"], tokens["ios"]:
+		info.OS = "iOS"
+	case tokens["android"]:
+		info.OS = "Android"
+	case tokens["windows"]:
+		info.OS = "Windows"
+	case tokens["macintosh"], strings.Contains(lower, "mac os x"):
+		info.OS = "macOS"
+	case tokens["cros"]:
+		info.OS = "ChromeOS"
+	case tokens["linux"]:
+		info.OS = "Linux"
+	}
+
+	return info
+}
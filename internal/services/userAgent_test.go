@@ -0,0 +1,25 @@
+package services
+
+import "testing"
+
+func TestParseUserAgentOS(t *testing.T) {
+	tests := []struct {
+		ua   string
+		want string
+	}{
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Version/17.0 Mobile/15E148 Safari/604.1", "iOS"},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36", "Android"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36 Edg/120.0", "Windows"},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 Version/17.0 Safari/605.1.15", "macOS"},
+		{"Mozilla/5.0 (X11; CrOS x86_64 15633.69.0) AppleWebKit/537.36 Chrome/119.0 Safari/537.36", "ChromeOS"},
+		{"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0", "Linux"},
+		{"Mozilla/5.0 (compatible; MSIE 10.0; Microsoft Outlook 16.0)", "Unknown"},       // "cros" inside "microsoft"
+		{"Mozilla/5.0 (X11; Linux x86_64) Chrome/120.0 Safari/537.36 Bios/1.2", "Linux"}, // "ios" inside "bios"
+		{"", "Unknown"},
+	}
+	for _, tt := range tests {
+		if got := ParseUserAgent(tt.ua).OS; got != tt.want {
+			t.Errorf("ParseUserAgent(%q).OS = %q, want %q", tt.ua, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package workers
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+)
+
+const accountPurgeBatchSize = 50 // Accounts purged per run
+
+// StartAccountPurger permanently deletes accounts whose deletion grace period has ended
+func StartAccountPurger() {
+	runPeriodically("account_purger", time.Hour, purgeDeletedAccounts)
+}
+
+func purgeDeletedAccounts() {
+	var users []models.User
+	if err := initializers.DB.Unscoped().
+		Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", time.Now()).
+		// Accounts with money held in escrow wait until their orders are settled
+		Where("NOT EXISTS (SELECT 1 FROM orders o WHERE (o.buyer_id = users.id OR o.seller_id = users.id) AND o.status IN ?)",
+			models.OrderHeldStatuses).
+		Limit(accountPurgeBatchSize).
+		Find(&users).Error; err != nil {
+		log.Printf("Failed to find accounts to purge: %v", err)
+		return
+	}
+
+	for _, user := range users {
+		if err := purgeAccount(user); err != nil {
+			log.Printf("Failed to purge account %d: %v", user.ID, err)
+		}
+	}
+}
+
+func purgeAccount(user models.User) error {
+	// Redis first, so no session survives the account
+	if err := services.PurgeUserRedisKeys(user); err != nil {
+		return fmt.Errorf("redis: %w", err)
+	}
+
+	// Uploaded media and data exports
+	for _, prefix := range services.UserStoragePrefixes(user.ID) {
+		services.DeletePrefix(prefix)
+	}
+
+	// Database rows, dependent rows are removed by ON DELETE CASCADE and orders keep their snapshots
+	if err := initializers.DB.Unscoped().Delete(&models.User{}, user.ID).Error; err != nil {
+		return fmt.Errorf("database: %w", err)
+	}
+
+	// Keep no personal data in the audit entry
+	services.Audit(services.AuditAccountPurged, nil, "user", user.ID, map[string]interface{}{
+		"requested_at": user.DeactivatedAt,
+		"scheduled_at": user.DeletionScheduledAt,
+	})
+	log.Printf("Purged account %d", user.ID)
+	return nil
+}
@@ -0,0 +1,88 @@
+package workers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+)
+
+const adExpiryNotice = 72 * time.Hour // Favoriters are alerted this long before an ad expires
+
+// StartAdExpirer alerts favoriters of ads about to expire, unlists expired ads and ends lapsed reservations
+func StartAdExpirer() {
+	runPeriodically("ad_expirer", time.Hour, func() {
+		backfillAdExpiry()
+		alertExpiringAds()
+		expireAds()
+		releaseLapsedReservations()
+	})
+}
+
+// backfillAdExpiry gives listed ads published before ads expired a full lifetime from now
+func backfillAdExpiry() {
+	result := initializers.DB.Model(&models.Ad{}).
+		Where("expires_at IS NULL AND status IN ?", []string{models.AdStatusActive, models.AdStatusReserved}).
+		Update("expires_at", time.Now().Add(services.AdLifetime()))
+	if result.Error != nil {
+		log.Printf("Failed to backfill ad expiry: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Set the expiry of %d legacy ads", result.RowsAffected)
+	}
+}
+
+func alertExpiringAds() {
+	now := time.Now()
+	var ads []models.Ad
+	if err := initializers.DB.Where("status = ? AND expires_at > ? AND expires_at <= ?", models.AdStatusActive, now, now.Add(adExpiryNotice)).
+		Find(&ads).Error; err != nil {
+		log.Printf("Failed to find expiring ads: %v", err)
+		return
+	}
+
+	for _, ad := range ads {
+		// Keyed by expiry date so a renewed ad alerts again before its new expiry
+		services.NotifyFavoriters(ad, models.FavoriteAlertExpiring, ad.ExpiresAt.Format("2006-01-02"), fmt.Sprintf(
+			"\"%s\" from your favorites will no longer be listed after %s.", ad.Title, ad.ExpiresAt.Format("2 January 2006"),
+		))
+	}
+}
+
+func expireAds() {
+	result := initializers.DB.Model(&models.Ad{}).
+		Where("status = ? AND expires_at <= ?", models.AdStatusActive, time.Now()).
+		Update("status", models.AdStatusExpired)
+	if result.Error != nil {
+		log.Printf("Failed to expire ads: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Expired %d ads", result.RowsAffected)
+	}
+}
+
+// releaseLapsedReservations puts back on sale the reserved ads whose buyer didn't pay in time
+func releaseLapsedReservations() {
+	var adIDs []uint
+	if err := initializers.DB.Model(&models.Ad{}).
+		Where("status = ? AND reserved_until <= ?", models.AdStatusReserved, time.Now()).
+		Where("NOT EXISTS (SELECT 1 FROM orders o WHERE o.ad_id = ads.id AND o.status IN ?)",
+			append(models.OrderHeldStatuses, models.OrderStatusReleased)).
+		Pluck("id", &adIDs).Error; err != nil {
+		log.Printf("Failed to find lapsed reservations: %v", err)
+		return
+	}
+
+	for _, adID := range adIDs {
+		if _, err := services.ReleaseReservation(adID, "The reservation lapsed before the sale was completed."); err != nil &&
+			!errors.Is(err, services.ErrAdNotReserved) && !errors.Is(err, services.ErrReservationPaid) {
+			log.Printf("Failed to release reservation of ad %d: %v", adID, err)
+		}
+	}
+}
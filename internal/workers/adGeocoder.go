@@ -0,0 +1,57 @@
+package workers
+
+import (
+	"log"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+)
+
+const adGeocodeBatchSize = 500 // Ads loaded at a time
+
+/*
+StartAdGeocoder locates ads saved without coordinates, those listed before ads were geocoded
+or whose district was unknown at the time, so they show up in distance searches.
+*/
+func StartAdGeocoder() {
+	runPeriodically("ad_geocoder", time.Hour, geocodeAds)
+}
+
+func geocodeAds() {
+	located := 0
+	for lastID := uint(0); ; {
+		var ads []models.Ad
+		if err := initializers.DB.Select("id, postcode").
+			Where("id > ? AND latitude IS NULL AND postcode <> '' AND status <> ?", lastID, models.AdStatusRemoved).
+			Order("id").
+			Limit(adGeocodeBatchSize).
+			Find(&ads).Error; err != nil {
+			log.Printf("Failed to find ads to geocode: %v", err)
+			return
+		}
+
+		for _, ad := range ads {
+			point, ok := services.GeocodePostcode(ad.Postcode)
+			if !ok {
+				continue
+			}
+			if err := initializers.DB.Model(&models.Ad{}).Where("id = ? AND latitude IS NULL", ad.ID).
+				Updates(map[string]interface{}{"latitude": point.Latitude, "longitude": point.Longitude}).Error; err != nil {
+				log.Printf("Failed to geocode ad %d: %v", ad.ID, err)
+				continue
+			}
+			located++
+		}
+
+		if len(ads) < adGeocodeBatchSize {
+			break
+		}
+		lastID = ads[len(ads)-1].ID
+	}
+
+	if located > 0 {
+		log.Printf("Geocoded %d ads", located)
+	}
+}
@@ -0,0 +1,19 @@
+package workers
+
+import (
+	"log"
+	"time"
+
+	"github.com/Desk888/api/internal/services"
+)
+
+// StartAdStatsFlusher copies ad view and engagement counters from Redis to Postgres
+func StartAdStatsFlusher() {
+	runPeriodically("ad_stats_flusher", 5*time.Minute, flushAdStats)
+}
+
+func flushAdStats() {
+	if err := services.FlushAdStats(); err != nil {
+		log.Printf("Failed to flush ad stats: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package workers
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DataExportRetention = 7 * 24 * time.Hour // Archives are deleted after this time
+	dataExportTimeout   = 30 * time.Minute   // Running exports older than this were interrupted
+)
+
+// StartDataExporter builds pending GDPR exports and deletes expired archives
+func StartDataExporter() {
+	runPeriodically("data_exporter", 30*time.Second, processDataExports)
+}
+
+func processDataExports() {
+	failStaleExports()
+
+	for {
+		export, found := claimPendingExport()
+		if !found {
+			break
+		}
+		runDataExport(export)
+	}
+
+	expireDataExports()
+}
+
+// claimPendingExport marks the oldest pending export as running and returns it
+func claimPendingExport() (models.DataExport, bool) {
+	var exports []models.DataExport
+	result := initializers.DB.Model(&exports).
+		Clauses(clause.Returning{}).
+		Where("id = (?)", initializers.DB.Model(&models.DataExport{}).
+			Select("id").
+			Where("status = ?", models.ExportStatusPending).
+			Order("created_at").
+			Limit(1)).
+		Update("status", models.ExportStatusRunning)
+	if result.Error != nil {
+		log.Printf("Failed to claim data export: %v", result.Error)
+		return models.DataExport{}, false
+	}
+	if len(exports) == 0 {
+		return models.DataExport{}, false
+	}
+	return exports[0], true
+}
+
+/*
+failStaleExports fails exports left running by a worker that crashed or was restarted,
+so the user can request a new one. Claiming an export sets its updated_at.
+*/
+func failStaleExports() {
+	result := initializers.DB.Model(&models.DataExport{}).
+		Where("status = ? AND updated_at <= ?", models.ExportStatusRunning, time.Now().Add(-dataExportTimeout)).
+		Updates(map[string]interface{}{
+			"status": models.ExportStatusFailed,
+			"error":  "Export timed out",
+		})
+	if result.Error != nil {
+		log.Printf("Failed to fail stale data exports: %v", result.Error)
+	} else if result.RowsAffected > 0 {
+		log.Printf("Failed %d stale data exports", result.RowsAffected)
+	}
+}
+
+func runDataExport(export models.DataExport) {
+	fail := func(err error) {
+		log.Printf("Data export %d failed: %v", export.ID, err)
+		initializers.DB.Model(&export).Where("status = ?", models.ExportStatusRunning).Updates(map[string]interface{}{
+			"status": models.ExportStatusFailed,
+			"error":  "Export could not be generated",
+		})
+	}
+
+	archive, err := services.BuildDataExport(export.UserID)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	key := fmt.Sprintf("exports/%d/%d-%s.zip", export.UserID, export.ID, time.Now().UTC().Format("20060102-150405"))
+	if err := services.PutObject(key, archive, "application/zip"); err != nil {
+		fail(err)
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(DataExportRetention)
+	result := initializers.DB.Model(&export).Where("status = ?", models.ExportStatusRunning).Updates(map[string]interface{}{
+		"status":       models.ExportStatusCompleted,
+		"object_key":   key,
+		"completed_at": now,
+		"expires_at":   expiresAt,
+	})
+	if result.Error != nil {
+		services.DeleteObjects(key)
+		fail(result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		// Timed out meanwhile, the user was told to request a new export
+		services.DeleteObjects(key)
+		return
+	}
+
+	notifyExportReady(export, key, expiresAt)
+}
+
+func notifyExportReady(export models.DataExport, key string, expiresAt time.Time) {
+	var user models.User
+	if err := initializers.DB.First(&user, export.UserID).Error; err != nil {
+		log.Printf("Failed to load user %d for data export email: %v", export.UserID, err)
+		return
+	}
+
+	link, err := services.PresignedURL(key, services.DataExportLinkExpiry, "grabit-data-export.zip")
+	if err != nil {
+		log.Printf("Failed to sign data export %d: %v", export.ID, err)
+		return
+	}
+
+	services.SendEmailAsync(user.Email, "Your Grabit data export is ready", services.EmailBody(
+		fmt.Sprintf("Hi %s,", user.FirstName),
+		"",
+		fmt.Sprintf("Your data export is ready. Download it within %d hours using the link below:", int(services.DataExportLinkExpiry.Hours())),
+		"",
+		link,
+		"",
+		fmt.Sprintf("You can request a new link from your account settings until %s.", expiresAt.Format("2 January 2006")),
+	))
+}
+
+// expireDataExports deletes archives past their retention period
+func expireDataExports() {
+	var expired []models.DataExport
+	if err := initializers.DB.Where("status = ? AND expires_at <= ?", models.ExportStatusCompleted, time.Now()).
+		Find(&expired).Error; err != nil {
+		log.Printf("Failed to find expired data exports: %v", err)
+		return
+	}
+
+	for _, export := range expired {
+		services.DeleteObjects(export.ObjectKey)
+		initializers.DB.Model(&export).Updates(map[string]interface{}{
+			"status":     models.ExportStatusExpired,
+			"object_key": "",
+		})
+	}
+}
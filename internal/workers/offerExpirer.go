@@ -0,0 +1,24 @@
+package workers
+
+import (
+	"log"
+	"time"
+
+	"github.com/Desk888/api/internal/services"
+)
+
+// StartOfferExpirer expires pending offers once their deadline has passed
+func StartOfferExpirer() {
+	runPeriodically("offer_expirer", time.Minute, expireOffers)
+}
+
+func expireOffers() {
+	expired, err := services.ExpirePendingOffers()
+	if err != nil {
+		log.Printf("Failed to expire offers: %v", err)
+		return
+	}
+	if len(expired) > 0 {
+		log.Printf("Expired %d offers", len(expired))
+	}
+}
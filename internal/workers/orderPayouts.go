@@ -0,0 +1,51 @@
+package workers
+
+import (
+	"log"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+)
+
+/*
+StartOrderPayouts settles escrow payments nobody acted on: orders never sent by post are refunded,
+sent orders the buyer never confirmed or disputed are released, and failed payouts are retried.
+*/
+func StartOrderPayouts() {
+	runPeriodically("order_payouts", 10*time.Minute, func() {
+		settleOverdueOrders()
+		retryPayouts()
+	})
+}
+
+func settleOverdueOrders() {
+	refunded, err := services.RefundUnsentOrders()
+	if err != nil {
+		log.Printf("Failed to find unsent orders: %v", err)
+	} else if refunded > 0 {
+		log.Printf("Refunded %d unsent orders", refunded)
+	}
+
+	released, err := services.ReleaseUnconfirmedOrders()
+	if err != nil {
+		log.Printf("Failed to find unconfirmed orders: %v", err)
+	} else if released > 0 {
+		log.Printf("Released %d unconfirmed orders", released)
+	}
+}
+
+func retryPayouts() {
+	var orders []models.Order
+	if err := initializers.DB.Where("status = ?", models.OrderStatusDelivered).Limit(100).Find(&orders).Error; err != nil {
+		log.Printf("Failed to find delivered orders: %v", err)
+		return
+	}
+
+	for i := range orders {
+		if err := services.ReleaseOrder(&orders[i]); err != nil {
+			log.Printf("Failed to release order %d: %v", orders[i].ID, err)
+		}
+	}
+}
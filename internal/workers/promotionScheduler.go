@@ -0,0 +1,41 @@
+package workers
+
+import (
+	"log"
+	"time"
+
+	"github.com/Desk888/api/internal/services"
+)
+
+// StartPromotionScheduler activates and expires promotions, records their impressions and retries refunds
+func StartPromotionScheduler() {
+	runPeriodically("promotion_scheduler", time.Minute, schedulePromotions)
+}
+
+func schedulePromotions() {
+	// Impressions first so spent budgets expire on this run
+	if err := services.FlushPromotionImpressions(); err != nil {
+		log.Printf("Failed to flush promotion impressions: %v", err)
+	}
+
+	expired, err := services.ExpirePromotions()
+	if err != nil {
+		log.Printf("Failed to expire promotions: %v", err)
+	} else if expired > 0 {
+		log.Printf("Expired %d promotions", expired)
+	}
+
+	activated, err := services.ActivateScheduledPromotions()
+	if err != nil {
+		log.Printf("Failed to activate promotions: %v", err)
+	} else if activated > 0 {
+		log.Printf("Activated %d promotions", activated)
+	}
+
+	refunded, err := services.RefundCancelledPromotions()
+	if err != nil {
+		log.Printf("Failed to refund cancelled promotions: %v", err)
+	} else if refunded > 0 {
+		log.Printf("Refunded %d cancelled promotions", refunded)
+	}
+}
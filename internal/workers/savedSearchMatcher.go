@@ -0,0 +1,165 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+	"github.com/Desk888/api/internal/models"
+	"github.com/Desk888/api/internal/services"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	savedSearchCheckpointKey = "saved_search_matcher:checkpoint" // Creation time of the newest ad evaluated against saved searches
+	savedSearchOverlap       = 5 * time.Minute                   // Ads this much older than the checkpoint are evaluated again
+	savedSearchBatchSize     = 500                               // Ads loaded per query
+	savedSearchAlertAds      = 10                                // Ads listed in an alert email
+)
+
+// StartSavedSearchMatcher matches newly published ads against saved searches and sends batched alerts
+func StartSavedSearchMatcher() {
+	runPeriodically("saved_search_matcher", time.Minute, func() {
+		matchNewAds()
+		sendSavedSearchAlerts()
+	})
+}
+
+// savedSearchAlertInterval reads SAVED_SEARCH_ALERT_MINUTES, the minimum time between alerts of a search, defaulting to 60 minutes
+func savedSearchAlertInterval() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("SAVED_SEARCH_ALERT_MINUTES"))
+	if err != nil || minutes < 1 {
+		minutes = 60
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+/*
+matchNewAds evaluates the ads published since the last run. An ad's created_at is set before its
+transaction commits, so ads created shortly before the checkpoint are evaluated again in case they
+committed late. Matching is idempotent, an ad already matched by a search is skipped.
+*/
+func matchNewAds() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	checkpoint, err := initializers.RedisClient.Get(ctx, savedSearchCheckpointKey).Time()
+	if err == redis.Nil {
+		// First run, only ads published from now on trigger alerts
+		initializers.RedisClient.Set(ctx, savedSearchCheckpointKey, time.Now(), 0)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read saved search checkpoint: %v", err)
+		return
+	}
+
+	newest := checkpoint
+	afterCreatedAt, afterID := checkpoint.Add(-savedSearchOverlap), uint(0)
+	for {
+		var ads []models.Ad
+		if err := initializers.DB.Scopes(services.HideAdsOfInactiveOwners).
+			Where("ads.status = ? AND (ads.created_at, ads.id) > (?, ?)", models.AdStatusActive, afterCreatedAt, afterID).
+			Order("ads.created_at, ads.id").
+			Limit(savedSearchBatchSize).
+			Find(&ads).Error; err != nil {
+			log.Printf("Failed to load new ads for saved searches: %v", err)
+			break
+		}
+
+		failed := false
+		for _, ad := range ads {
+			if _, err := services.MatchSavedSearches(ad); err != nil {
+				log.Printf("Failed to match ad %d against saved searches: %v", ad.ID, err)
+				failed = true // Retried from this ad on the next run
+				break
+			}
+			afterCreatedAt, afterID = ad.CreatedAt, ad.ID
+			if ad.CreatedAt.After(newest) {
+				newest = ad.CreatedAt
+			}
+		}
+		if failed || len(ads) < savedSearchBatchSize {
+			break
+		}
+	}
+	initializers.RedisClient.Set(ctx, savedSearchCheckpointKey, newest, 0)
+}
+
+// sendSavedSearchAlerts sends one alert per search with pending matches, at most once per interval
+func sendSavedSearchAlerts() {
+	var searches []models.SavedSearch
+	if err := initializers.DB.Preload("User").
+		Where("paused_at IS NULL AND (last_alerted_at IS NULL OR last_alerted_at <= ?)", time.Now().Add(-savedSearchAlertInterval())).
+		// Accounts pending deletion or suspended get no alerts, their matches wait until they return
+		Where("user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL OR suspended_at IS NOT NULL)").
+		Where("id IN (?)", initializers.DB.Model(&models.SavedSearchMatch{}).Select("saved_search_id").Where("notified_at IS NULL")).
+		Find(&searches).Error; err != nil {
+		log.Printf("Failed to find saved searches to alert: %v", err)
+		return
+	}
+
+	for _, search := range searches {
+		alertSavedSearch(search)
+	}
+}
+
+func alertSavedSearch(search models.SavedSearch) {
+	var matches []models.SavedSearchMatch
+	if err := initializers.DB.Preload("Ad").
+		Where("saved_search_id = ? AND notified_at IS NULL", search.ID).
+		Order("created_at DESC").
+		Find(&matches).Error; err != nil {
+		log.Printf("Failed to load matches of saved search %d: %v", search.ID, err)
+		return
+	}
+
+	now := time.Now()
+	matchIDs := make([]uint, 0, len(matches))
+	adIDs := make([]uint, 0, len(matches))
+	lines := []string{}
+	for _, match := range matches {
+		matchIDs = append(matchIDs, match.ID)
+		// Ads sold or removed since they matched aren't worth an alert
+		if match.Ad.Status != models.AdStatusActive {
+			continue
+		}
+		adIDs = append(adIDs, match.AdID)
+		if len(lines) < savedSearchAlertAds {
+			lines = append(lines, fmt.Sprintf("- %s, £%d.%02d: %s/ads/%d",
+				match.Ad.Title, match.Ad.Price/100, match.Ad.Price%100, os.Getenv("APP_BASE_URL"), match.AdID))
+		}
+	}
+
+	if err := initializers.DB.Model(&models.SavedSearchMatch{}).Where("id IN ?", matchIDs).Update("notified_at", now).Error; err != nil {
+		log.Printf("Failed to mark matches of saved search %d as notified: %v", search.ID, err)
+		return
+	}
+	if len(adIDs) == 0 {
+		return
+	}
+	initializers.DB.Model(&search).Update("last_alerted_at", now)
+
+	services.PublishEvent(search.UserID, services.EventSearchMatch, map[string]interface{}{
+		"saved_search_id": search.ID,
+		"name":            search.Name,
+		"ad_ids":          adIDs,
+	}, true)
+
+	if search.EmailAlerts {
+		body := append([]string{
+			fmt.Sprintf("Hi %s,", search.User.FirstName),
+			"",
+			fmt.Sprintf("%d new items match your saved search \"%s\":", len(adIDs), search.Name),
+			"",
+		}, lines...)
+		if len(adIDs) > len(lines) {
+			body = append(body, "", fmt.Sprintf("…and %d more.", len(adIDs)-len(lines)))
+		}
+		services.SendEmailAsync(search.User.Email, fmt.Sprintf("New matches for \"%s\"", search.Name), services.EmailBody(body...))
+	}
+}
@@ -0,0 +1,40 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Desk888/api/internal/initializers"
+)
+
+/*
+runPeriodically calls job every interval until the process exits.
+A Redis lock makes sure only one API replica runs a given job at a time.
+*/
+func runPeriodically(name string, interval time.Duration, job func()) {
+	lockKey := fmt.Sprintf("worker_lock:%s", name)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for ; ; <-ticker.C {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			acquired, err := initializers.RedisClient.SetNX(ctx, lockKey, time.Now().Unix(), interval).Result()
+			cancel()
+			if err != nil {
+				log.Printf("Worker %s failed to acquire lock: %v", name, err)
+				continue
+			}
+			if !acquired {
+				continue // Another replica is running this job
+			}
+
+			job()
+		}
+	}()
+
+	log.Printf("Worker %s started (every %s)", name, interval)
+}